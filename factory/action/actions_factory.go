@@ -22,7 +22,7 @@ import (
 //go:generate mockgen -source actions_factory.go -destination ./mocks/actions_factory_mock.go -package actions_factory_mock
 
 type ActionsFactory interface {
-	NewActions(list *parser.Action, agentName string, config interface{}, wizardFacts map[string]interface{}, timeout int, register string) actions.Action
+	NewActions(list *parser.Action, agentName string, config interface{}, wizardFacts map[string]interface{}, timeout int, register string, opts actions.Options) actions.Action
 }
 
 type actionsFactory struct{}
@@ -31,24 +31,21 @@ func NewActionsFactory() ActionsFactory {
 	return &actionsFactory{}
 }
 
-func (a *actionsFactory) NewActions(action *parser.Action, agentName string, config interface{}, wizardFacts map[string]interface{}, timeout int, register string) actions.Action {
-	var actionDo actions.Action
+// NewActions returns the registered action with the name of the JSON action, nil if no action is registered with the name
+func (a *actionsFactory) NewActions(action *parser.Action, agentName string, config interface{}, wizardFacts map[string]interface{}, timeout int, register string, opts actions.Options) actions.Action {
+	newAction, ok := constructor(action.Action)
+	if !ok {
+		return nil
+	}
 	if timeout == 0 {
 		timeout = 10
 	}
-	switch action.Action {
-	case "copy":
-		actionDo = actions.NewCopyAction(agentName, timeout, register)
-	case "template":
-		actionDo = actions.NewTemplateAction(agentName, config, wizardFacts, timeout, register)
-	case "file":
-		actionDo = actions.NewFileAction(agentName, timeout, register)
-	case "cmd":
-		actionDo = actions.NewCmdAction(timeout, register)
-	case "user":
-		actionDo = actions.NewUserAction(timeout, register)
-	case "systemd":
-		actionDo = actions.NewSystemDAction(timeout, register)
-	}
-	return actionDo
+	return newAction(Params{
+		AgentName:   agentName,
+		Config:      config,
+		WizardFacts: wizardFacts,
+		Timeout:     timeout,
+		Register:    register,
+		Options:     opts,
+	})
 }
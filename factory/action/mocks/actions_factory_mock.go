@@ -19,10 +19,11 @@
 package actions_factory_mock
 
 import (
-	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
-	"github.com/acceldata-io/wizard/internal/parser"
-	"github.com/acceldata-io/wizard/pkg/actions"
+
+	parser "github.com/acceldata-io/wizard/internal/parser"
+	actions "github.com/acceldata-io/wizard/pkg/actions"
+	gomock "github.com/golang/mock/gomock"
 )
 
 // MockActionsFactory is a mock of ActionsFactory interface.
@@ -49,15 +50,15 @@ func (m *MockActionsFactory) EXPECT() *MockActionsFactoryMockRecorder {
 }
 
 // NewActions mocks base method.
-func (m *MockActionsFactory) NewActions(list *parser.Action, agentName string, config interface{}, wizardFacts map[string]interface{}, timeout int, register string) actions.Action {
+func (m *MockActionsFactory) NewActions(list *parser.Action, agentName string, config interface{}, wizardFacts map[string]interface{}, timeout int, register string, opts actions.Options) actions.Action {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "NewActions", list, agentName, config, wizardFacts, timeout, register)
+	ret := m.ctrl.Call(m, "NewActions", list, agentName, config, wizardFacts, timeout, register, opts)
 	ret0, _ := ret[0].(actions.Action)
 	return ret0
 }
 
 // NewActions indicates an expected call of NewActions.
-func (mr *MockActionsFactoryMockRecorder) NewActions(list, agentName, config, wizardFacts, timeout, register interface{}) *gomock.Call {
+func (mr *MockActionsFactoryMockRecorder) NewActions(list, agentName, config, wizardFacts, timeout, register, opts interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewActions", reflect.TypeOf((*MockActionsFactory)(nil).NewActions), list, agentName, config, wizardFacts, timeout, register)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewActions", reflect.TypeOf((*MockActionsFactory)(nil).NewActions), list, agentName, config, wizardFacts, timeout, register, opts)
 }
@@ -0,0 +1,126 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/actions"
+)
+
+// Params are given to the Constructor of an action for each action performed
+type Params struct {
+	// AgentName is the name of the task performing the action
+	AgentName string
+	// Config is the TemplateConfig of the task
+	Config interface{}
+	// WizardFacts are the wizard facts, nil unless EnableWizardFacts is set
+	WizardFacts map[string]interface{}
+	// Timeout is the timeout of the action in seconds, 10 if not set in the JSON
+	Timeout int
+	// Register is the name of the register of the action in Options.Registers
+	Register string
+	Options  actions.Options
+}
+
+// Constructor returns a new action, it is called every time an action with its name is performed
+type Constructor func(params Params) actions.Action
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Constructor{
+		"copy": func(p Params) actions.Action {
+			return actions.NewCopyAction(p.AgentName, p.Timeout, p.Register, p.Options)
+		},
+		"template": func(p Params) actions.Action {
+			return actions.NewTemplateAction(p.AgentName, p.Config, p.WizardFacts, p.Timeout, p.Register, p.Options)
+		},
+		"file": func(p Params) actions.Action {
+			return actions.NewFileAction(p.AgentName, p.Timeout, p.Register, p.Options)
+		},
+		"cmd": func(p Params) actions.Action {
+			return actions.NewCmdAction(p.Timeout, p.Register, p.Options)
+		},
+		"user": func(p Params) actions.Action {
+			return actions.NewUserAction(p.Timeout, p.Register, p.Options)
+		},
+		"systemd": func(p Params) actions.Action {
+			return actions.NewSystemDAction(p.Timeout, p.Register, p.Options)
+		},
+	}
+)
+
+// RegisterAction adds an action which can be used in the JSON with its name, e.g. "kafka_topic"
+// It should be called before the config is parsed by task.New, usually from an init func
+// The name of a built-in or already registered action returns an error
+func RegisterAction(name string, constructor Constructor) error {
+	if name == "" {
+		return fmt.Errorf("RegisterAction: empty action name")
+	}
+	if constructor == nil {
+		return fmt.Errorf("RegisterAction: nil constructor for action %q", name)
+	}
+	if name == parser.ActionBlock {
+		return fmt.Errorf("RegisterAction: action %q is reserved", name)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("RegisterAction: action %q is already registered", name)
+	}
+	registry[name] = constructor
+	return nil
+}
+
+// Registered reports if an action is registered with the name
+func Registered(name string) bool {
+	_, ok := constructor(name)
+	return ok
+}
+
+// RegisteredActions returns the sorted names of the registered actions
+func RegisteredActions() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that the action is registered and validates it if it implements actions.Validator
+func Validate(action *parser.Action) error {
+	newAction, ok := constructor(action.Action)
+	if !ok {
+		return fmt.Errorf("unknown action %q, registered actions: %s", action.Action, strings.Join(RegisteredActions(), ", "))
+	}
+	if validator, ok := newAction(Params{}).(actions.Validator); ok {
+		return validator.Validate(action)
+	}
+	return nil
+}
+
+func constructor(name string) (Constructor, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := registry[name]
+	return c, ok
+}
@@ -0,0 +1,67 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/actions"
+)
+
+type kafkaTopicAction struct {
+	params Params
+}
+
+func (k *kafkaTopicAction) Do(_ context.Context, _ *parser.Action, _ chan interface{}) error {
+	return nil
+}
+
+func TestRegisterAction(t *testing.T) {
+	err := RegisterAction("kafka_topic", func(params Params) actions.Action {
+		return &kafkaTopicAction{params: params}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Registered("kafka_topic") || !Registered("cmd") || Registered("hdfs_dir") {
+		t.Fatalf("unexpected registered actions: %v", RegisteredActions())
+	}
+
+	factory := NewActionsFactory()
+	newAction := factory.NewActions(&parser.Action{Action: "kafka_topic"}, "kafka", nil, nil, 0, "topic", actions.Options{})
+	kafkaTopic, ok := newAction.(*kafkaTopicAction)
+	if !ok {
+		t.Fatalf("expected the registered action, got %T", newAction)
+	}
+	if kafkaTopic.params.AgentName != "kafka" || kafkaTopic.params.Register != "topic" || kafkaTopic.params.Timeout != 10 {
+		t.Fatalf("unexpected params: %+v", kafkaTopic.params)
+	}
+	if factory.NewActions(&parser.Action{Action: "hdfs_dir"}, "hdfs", nil, nil, 0, "", actions.Options{}) != nil {
+		t.Fatal("expected nil for an unknown action")
+	}
+
+	for _, name := range []string{"kafka_topic", "cmd"} {
+		err = RegisterAction(name, func(params Params) actions.Action { return nil })
+		if err == nil || !strings.Contains(err.Error(), "already registered") {
+			t.Fatalf("%s: expected already registered error, got: %v", name, err)
+		}
+	}
+	if err = RegisterAction("hdfs_dir", nil); err == nil {
+		t.Fatal("expected nil constructor error")
+	}
+}
@@ -0,0 +1,68 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_gen
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// RenderString executes s as a template with the funcMap and the data
+// A string without "{{" is returned as it is
+func RenderString(s string, funcMap template.FuncMap, data interface{}) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	t, err := template.New("value").Funcs(funcMap).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := t.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// RenderValue renders the strings of value, maps and slices decoded from the JSON config are rendered recursively
+// The value is not modified, a rendered copy is returned
+func RenderValue(value interface{}, funcMap template.FuncMap, data interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return RenderString(v, funcMap, data)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			r, err := RenderValue(val, funcMap, data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err.Error())
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, val := range v {
+			r, err := RenderValue(val, funcMap, data)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %s", i, err.Error())
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	}
+	return value, nil
+}
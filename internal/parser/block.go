@@ -0,0 +1,62 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import "fmt"
+
+// ActionBlock is the action grouping the actions of its block, rescue and always lists
+const ActionBlock = "block"
+
+// validateBlock checks that only a block has the block, rescue and always lists, and that a block has actions
+func validateBlock(action *Action) error {
+	if action.Action != ActionBlock {
+		if len(action.Block) > 0 || len(action.Rescue) > 0 || len(action.Always) > 0 {
+			return fmt.Errorf("block, rescue and always are only used by a %q action", ActionBlock)
+		}
+		return nil
+	}
+	if len(action.Block) == 0 {
+		return fmt.Errorf("a %q action should have a block", ActionBlock)
+	}
+	if action.Loop != nil || action.Retries > 0 || action.Until != "" {
+		return fmt.Errorf("loop, retries and until are not supported by a %q action", ActionBlock)
+	}
+	return nil
+}
+
+// nestedActions returns the actions of the block, rescue and always lists with their JSON path
+func nestedActions(path string, action *Action) []actionPath {
+	var nested []actionPath
+	for _, list := range []struct {
+		name    string
+		actions []*Action
+	}{{"block", action.Block}, {"rescue", action.Rescue}, {"always", action.Always}} {
+		for i, a := range list.actions {
+			p := fmt.Sprintf("%s.%s[%d]", path, list.name, i)
+			nested = append(nested, actionPath{path: p, action: a})
+			nested = append(nested, nestedActions(p, a)...)
+		}
+	}
+	return nested
+}
+
+// Nested returns the actions of the block, rescue and always lists of the action and of their own lists
+func (a *Action) Nested() []*Action {
+	var nested []*Action
+	for _, n := range nestedActions("", a) {
+		nested = append(nested, n.action)
+	}
+	return nested
+}
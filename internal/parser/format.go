@@ -0,0 +1,255 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// FormatAuto detects the format of the config, JSON if it starts with "{", YAML otherwise
+	FormatAuto = ""
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// position is the line and the column in the YAML config of the value starting at offset in the converted JSON
+type position struct {
+	offset, line, column int
+}
+
+// detectFormat returns FormatJSON for a config starting with "{", FormatYAML otherwise
+func detectFormat(config []byte) string {
+	if bytes.HasPrefix(bytes.TrimSpace(config), []byte("{")) {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// yamlToJSON converts the YAML config to JSON, the anchors, aliases and merge keys are resolved
+// The positions of the values are returned to report the errors of the JSON at their YAML line and column
+func yamlToJSON(config []byte) ([]byte, []position, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(config, &doc); err != nil {
+		return nil, nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, nil, fmt.Errorf("empty config")
+	}
+	c := &yamlConverter{active: map[*yaml.Node]bool{}}
+	if err := c.convert(doc.Content[0]); err != nil {
+		return nil, nil, err
+	}
+	return c.buf.Bytes(), c.positions, nil
+}
+
+type yamlConverter struct {
+	buf       bytes.Buffer
+	positions []position
+	// active are the mappings and sequences being converted, an alias to one of them is a cycle
+	active map[*yaml.Node]bool
+	// nodes is the number of converted nodes, aliased the ones converted through an alias, aliasDepth > 0 in an alias
+	nodes, aliased, aliasDepth int
+}
+
+// allowedAliasRatio is the ratio of the nodes converted through an alias allowed for a number of converted nodes,
+// the limit of yaml.v3 against the alias bombs like the billion laughs
+func allowedAliasRatio(nodes int) float64 {
+	switch {
+	case nodes <= 400000:
+		return 0.99
+	case nodes >= 4000000:
+		return 0.10
+	}
+	return 0.10 + 0.89*(1-float64(nodes-400000)/3600000)
+}
+
+func (c *yamlConverter) convert(node *yaml.Node) error {
+	if node.Kind == yaml.AliasNode {
+		if c.active[node.Alias] {
+			return fmt.Errorf("line %d, column %d: alias *%s references itself", node.Line, node.Column, node.Value)
+		}
+		c.aliasDepth++
+		defer func() { c.aliasDepth-- }()
+		return c.convert(node.Alias)
+	}
+	c.nodes++
+	if c.aliasDepth > 0 {
+		c.aliased++
+	}
+	if c.aliased > 100 && c.nodes > 1000 && float64(c.aliased)/float64(c.nodes) > allowedAliasRatio(c.nodes) {
+		return fmt.Errorf("line %d, column %d: too many aliases expanded", node.Line, node.Column)
+	}
+	c.positions = append(c.positions, position{offset: c.buf.Len(), line: node.Line, column: node.Column})
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		c.active[node] = true
+		defer delete(c.active, node)
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		keys, values, err := c.mappingEntries(node)
+		if err != nil {
+			return err
+		}
+		c.buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				c.buf.WriteByte(',')
+			}
+			keyJSON, _ := json.Marshal(key)
+			c.buf.Write(keyJSON)
+			c.buf.WriteByte(':')
+			if err := c.convert(values[i]); err != nil {
+				return err
+			}
+		}
+		c.buf.WriteByte('}')
+	case yaml.SequenceNode:
+		c.buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				c.buf.WriteByte(',')
+			}
+			if err := c.convert(item); err != nil {
+				return err
+			}
+		}
+		c.buf.WriteByte(']')
+	case yaml.ScalarNode:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return fmt.Errorf("line %d, column %d: %s", node.Line, node.Column, err)
+		}
+		valueJSON, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("line %d, column %d: %s", node.Line, node.Column, err)
+		}
+		c.buf.Write(valueJSON)
+	default:
+		return fmt.Errorf("line %d, column %d: unsupported YAML node", node.Line, node.Column)
+	}
+	return nil
+}
+
+// mappingEntries returns the keys and values of a mapping in order, the "<<" merge keys add the entries
+// of the merged mappings which are not defined by the mapping itself. A mapping merging itself or a mapping
+// it is in is a cycle
+func (c *yamlConverter) mappingEntries(node *yaml.Node) ([]string, []*yaml.Node, error) {
+	var keys []string
+	var values []*yaml.Node
+	index := make(map[string]int)
+	var merged []*yaml.Node
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		if keyNode.Kind == yaml.AliasNode {
+			keyNode = keyNode.Alias
+		}
+		if keyNode.Kind != yaml.ScalarNode {
+			return nil, nil, fmt.Errorf("line %d, column %d: a key should be a string", keyNode.Line, keyNode.Column)
+		}
+		if keyNode.Tag == "!!merge" {
+			merged = append(merged, valueNode)
+			continue
+		}
+		if j, ok := index[keyNode.Value]; ok {
+			values[j] = valueNode
+			continue
+		}
+		index[keyNode.Value] = len(keys)
+		keys = append(keys, keyNode.Value)
+		values = append(values, valueNode)
+	}
+
+	for _, mergeNode := range merged {
+		if mergeNode.Kind == yaml.AliasNode {
+			mergeNode = mergeNode.Alias
+		}
+		sources := []*yaml.Node{mergeNode}
+		if mergeNode.Kind == yaml.SequenceNode {
+			sources = mergeNode.Content
+		}
+		for _, source := range sources {
+			if source.Kind == yaml.AliasNode {
+				source = source.Alias
+			}
+			if source.Kind != yaml.MappingNode {
+				return nil, nil, fmt.Errorf("line %d, column %d: a merge key should reference a mapping", source.Line, source.Column)
+			}
+			if c.active[source] {
+				return nil, nil, fmt.Errorf("line %d, column %d: a merge key references a mapping it is in", mergeNode.Line, mergeNode.Column)
+			}
+			c.active[source] = true
+			sourceKeys, sourceValues, err := c.mappingEntries(source)
+			delete(c.active, source)
+			if err != nil {
+				return nil, nil, err
+			}
+			for i, key := range sourceKeys {
+				if _, ok := index[key]; ok {
+					continue
+				}
+				index[key] = len(keys)
+				keys = append(keys, key)
+				values = append(values, sourceValues[i])
+			}
+		}
+	}
+	return keys, values, nil
+}
+
+// errorPosition adds the line and the column of a JSON decoding error to its message
+// The offset of the error is in the JSON config, or in the JSON converted from YAML with the positions
+func errorPosition(err error, config []byte, positions []position) string {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err.Error()
+	}
+
+	if positions != nil {
+		// the value of a type error ends at offset, it is the last value starting before it
+		i := sort.Search(len(positions), func(i int) bool { return int64(positions[i].offset) >= offset })
+		if i == 0 {
+			return err.Error()
+		}
+		return fmt.Sprintf("line %d, column %d: %s", positions[i-1].line, positions[i-1].column, err)
+	}
+
+	if offset > int64(len(config)) {
+		offset = int64(len(config))
+	}
+	// the offset is after the last character read, the invalid character of a syntax error
+	before := config[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n') - 1
+	if column < 1 {
+		column = 1
+	}
+	return fmt.Sprintf("line %d, column %d: %s", line, column, err)
+}
@@ -0,0 +1,109 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TaskGraph returns the tasks of the priority list mapped to the tasks they depend on
+// If no task declares depends_on then each task depends on the task before it in the priority list,
+// which keeps the serial order of the priority list
+func (t TaskList) TaskGraph() map[string][]string {
+	graph := make(map[string][]string, len(t.Priority))
+	for i, taskName := range t.Priority {
+		if len(t.DependsOn) == 0 {
+			if i > 0 {
+				graph[taskName] = []string{t.Priority[i-1]}
+			} else {
+				graph[taskName] = nil
+			}
+			continue
+		}
+		graph[taskName] = t.DependsOn[taskName]
+	}
+	return graph
+}
+
+// validateGraph checks that every dependency is a task of the priority list and that there are no cycles
+func (t TaskList) validateGraph() error {
+	inPriority := make(map[string]bool, len(t.Priority))
+	for _, taskName := range t.Priority {
+		inPriority[taskName] = true
+	}
+
+	for taskName, deps := range t.DependsOn {
+		if _, ok := t.Tasks[taskName]; !ok {
+			return fmt.Errorf("depends_on: task %q not found", taskName)
+		}
+		for _, dep := range deps {
+			if _, ok := t.Tasks[dep]; !ok {
+				return fmt.Errorf("depends_on: task %q depends on %q which is not found", taskName, dep)
+			}
+			if inPriority[taskName] && !inPriority[dep] {
+				return fmt.Errorf("depends_on: task %q depends on %q which is not in the priority list", taskName, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(t.DependsOn))
+	var path []string
+
+	var visit func(taskName string) error
+	visit = func(taskName string) error {
+		switch state[taskName] {
+		case visiting:
+			start := 0
+			for i, name := range path {
+				if name == taskName {
+					start = i
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), taskName)
+			return fmt.Errorf("depends_on: cycle found - %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+		state[taskName] = visiting
+		path = append(path, taskName)
+		for _, dep := range t.DependsOn[taskName] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[taskName] = visited
+		return nil
+	}
+
+	// walk in the priority order first so the reported cycle is stable
+	for _, taskName := range t.Priority {
+		if err := visit(taskName); err != nil {
+			return err
+		}
+	}
+	for taskName := range t.DependsOn {
+		if err := visit(taskName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import "fmt"
+
+const (
+	// FlushHandlersRun runs the notified handlers once at the end of the run
+	FlushHandlersRun = "run"
+	// FlushHandlersTask runs the notified handlers at the end of the task which notified them
+	FlushHandlersTask = "task"
+)
+
+// validateHandlers checks that the handler names are unique and that every notified handler exists
+func (t TaskList) validateHandlers() error {
+	switch t.FlushHandlers {
+	case "", FlushHandlersRun, FlushHandlersTask:
+	default:
+		return fmt.Errorf("flush_handlers: unknown value %q, expected %q or %q", t.FlushHandlers, FlushHandlersRun, FlushHandlersTask)
+	}
+
+	handlers := make(map[string]bool, len(t.Handlers))
+	for _, handler := range t.Handlers {
+		if handler.Name == "" {
+			return fmt.Errorf("handlers: a handler of action %q has no name", handler.Action)
+		}
+		if handlers[handler.Name] {
+			return fmt.Errorf("handlers: handler %q is defined more than once", handler.Name)
+		}
+		handlers[handler.Name] = true
+	}
+
+	notifiers := map[string][]*Action{"handlers": t.Handlers}
+	for taskName, actions := range t.Tasks {
+		notifiers["task "+taskName] = actions
+	}
+	for source, actions := range notifiers {
+		for _, action := range actions {
+			all := append([]actionPath{{action: action}}, nestedActions("", action)...)
+			for _, a := range all {
+				for _, name := range a.action.Notify {
+					if !handlers[name] {
+						return fmt.Errorf("notify: %s action %q notifies %q which is not a handler", source, a.action.Name, name)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/acceldata-io/wizard/pkg/register"
+)
+
+// Include is a task list file included by the config, its tasks, handlers and registers are added to the task list
+// with their names prefixed by the namespace, e.g. "java.install" for the task "install" of the namespace "java"
+type Include struct {
+	// File is the path of the task list, JSON or YAML, in the embedded files or on the local disk
+	// A relative path of a nested include of the same source type is relative to the dir of the file including it
+	File string `json:"file" validate:"required"`
+	// SrcType is "embed" (the default) or "local"
+	SrcType string `json:"src_type"`
+	// Namespace prefixes the names of the included tasks and handlers, the file name without its extension by default
+	Namespace string `json:"namespace"`
+	// Vars are added to the vars of the included actions, they override the vars of the actions
+	Vars map[string]interface{} `json:"vars"`
+}
+
+// Loader reads an included file, srcType is "embed" or "local"
+type Loader func(file, srcType string) ([]byte, error)
+
+// resolveIncludes merges the included files into the task list, stack are the files including it to report the cycles
+// The namespace of an include in the priority list is replaced by the priority list of the included file,
+// in the dependencies of depends_on by all the tasks of its priority list, and as a task of depends_on by its
+// tasks without dependencies
+func (t *TaskList) resolveIncludes(load Loader, stack []string) error {
+	for i, include := range t.Include {
+		if include.File == "" {
+			return fmt.Errorf("include[%d]: file is required", i)
+		}
+		srcType := include.SrcType
+		if srcType == "" {
+			srcType = "embed"
+		}
+		if srcType != "embed" && srcType != "local" {
+			return fmt.Errorf("include %s: wrong source type %q", include.File, srcType)
+		}
+		key := srcType + ":" + include.File
+		for _, file := range stack {
+			if file == key {
+				return fmt.Errorf("include %s: include cycle found - %s -> %s", include.File, strings.Join(stack, " -> "), key)
+			}
+		}
+		if load == nil {
+			return fmt.Errorf("include %s: no loader for the included files", include.File)
+		}
+
+		data, err := load(include.File, srcType)
+		if err != nil {
+			return fmt.Errorf("include %s: %s", include.File, err.Error())
+		}
+		included, err := decodeConfig(data, fileFormat(include.File))
+		if err != nil {
+			return fmt.Errorf("include %s: %s", include.File, err.Error())
+		}
+		for _, nested := range included.Include {
+			nestedType := nested.SrcType
+			if nestedType == "" {
+				nestedType = "embed"
+			}
+			switch {
+			case srcType == "local" && nestedType == "local" && !filepath.IsAbs(nested.File):
+				nested.File = filepath.Join(filepath.Dir(include.File), nested.File)
+			case srcType == "embed" && nestedType == "embed" && !path.IsAbs(nested.File):
+				nested.File = path.Join(path.Dir(include.File), nested.File)
+			}
+		}
+		if err = included.resolveIncludes(load, append(stack, key)); err != nil {
+			return err
+		}
+
+		namespace := include.Namespace
+		if namespace == "" {
+			namespace = strings.TrimSuffix(path.Base(include.File), path.Ext(include.File))
+		}
+		if err = t.merge(included, namespace, include.Vars); err != nil {
+			return fmt.Errorf("include %s: %s", include.File, err.Error())
+		}
+	}
+	return nil
+}
+
+// merge adds the tasks and the handlers of the included task list with their names and registers prefixed by the namespace,
+// the references to the registers in when.rvar, until and the register template function are renamed too
+func (t *TaskList) merge(included TaskList, namespace string, vars map[string]interface{}) error {
+	if _, ok := t.Tasks[namespace]; ok {
+		return fmt.Errorf("namespace %q is also a task", namespace)
+	}
+	if len(included.DependsOn) > 0 && len(t.DependsOn) == 0 {
+		return fmt.Errorf("declares depends_on, the task list including it should declare depends_on too")
+	}
+	name := func(name string) string {
+		return namespace + "." + name
+	}
+
+	handlers := make(map[string]bool, len(included.Handlers))
+	for _, handler := range included.Handlers {
+		handlers[handler.Name] = true
+	}
+	registers := make(map[string]bool)
+	var collect func(actions []*Action)
+	collect = func(actions []*Action) {
+		for _, action := range actions {
+			registers[actionRegister(action)] = true
+			collect(action.Block)
+			collect(action.Rescue)
+			collect(action.Always)
+		}
+	}
+	for _, actions := range included.Tasks {
+		collect(actions)
+	}
+	collect(included.Handlers)
+	rename := func(reg string) string {
+		base, index := reg, ""
+		if i := strings.Index(reg, "["); i > 0 {
+			base, index = reg[:i], reg[i:]
+		}
+		if !registers[base] {
+			return reg
+		}
+		return name(base) + index
+	}
+
+	var prepare func(action *Action)
+	prepare = func(action *Action) {
+		action.Register = name(actionRegister(action))
+		action.Until = renameExpRegisters(action.Until, rename)
+		if action.When != nil {
+			action.When.RVar = renameExpRegisters(action.When.RVar, rename)
+			action.When.Command = renameFuncRegisters(action.When.Command, rename).(string)
+		}
+		action.Name = renameFuncRegisters(action.Name, rename).(string)
+		for i, arg := range action.Command {
+			action.Command[i] = renameFuncRegisters(arg, rename).(string)
+		}
+		if action.ActionVariables != nil {
+			action.ActionVariables = renameFuncRegisters(action.ActionVariables, rename).(map[string]interface{})
+		}
+		for i, handler := range action.Notify {
+			if handlers[handler] {
+				action.Notify[i] = name(handler)
+			}
+		}
+		if len(vars) > 0 {
+			merged := make(map[string]interface{}, len(action.Vars)+len(vars))
+			for k, v := range action.Vars {
+				merged[k] = v
+			}
+			for k, v := range vars {
+				merged[k] = v
+			}
+			action.Vars = merged
+		}
+		for _, list := range [][]*Action{action.Block, action.Rescue, action.Always} {
+			for _, nested := range list {
+				prepare(nested)
+			}
+		}
+	}
+
+	if t.Tasks == nil {
+		t.Tasks = make(map[string][]*Action)
+	}
+	for taskName, actions := range included.Tasks {
+		if _, ok := t.Tasks[name(taskName)]; ok {
+			return fmt.Errorf("task %q is already defined", name(taskName))
+		}
+		for _, action := range actions {
+			prepare(action)
+		}
+		t.Tasks[name(taskName)] = actions
+	}
+	for _, handler := range included.Handlers {
+		prepare(handler)
+		handler.Name = name(handler.Name)
+		t.Handlers = append(t.Handlers, handler)
+	}
+	for taskName, tags := range included.TaskTags {
+		if t.TaskTags == nil {
+			t.TaskTags = make(map[string][]string)
+		}
+		t.TaskTags[name(taskName)] = tags
+	}
+
+	priority := make([]string, 0, len(included.Priority))
+	for _, taskName := range included.Priority {
+		priority = append(priority, name(taskName))
+	}
+	var expanded []string
+	for _, taskName := range t.Priority {
+		if taskName == namespace {
+			expanded = append(expanded, priority...)
+		} else {
+			expanded = append(expanded, taskName)
+		}
+	}
+	t.Priority = expanded
+
+	if len(t.DependsOn) == 0 {
+		return nil
+	}
+	for taskName, deps := range t.DependsOn {
+		var expandedDeps []string
+		for _, dep := range deps {
+			if dep == namespace {
+				expandedDeps = append(expandedDeps, priority...)
+			} else {
+				expandedDeps = append(expandedDeps, dep)
+			}
+		}
+		t.DependsOn[taskName] = expandedDeps
+	}
+	graph := included.TaskGraph()
+	// the namespace as a key is replaced by the tasks of the included file which do not depend on another one
+	if deps, ok := t.DependsOn[namespace]; ok {
+		delete(t.DependsOn, namespace)
+		for _, taskName := range included.Priority {
+			if len(graph[taskName]) == 0 {
+				t.DependsOn[name(taskName)] = append([]string{}, deps...)
+			}
+		}
+	}
+	// the graph of the included file keeps its order, the serial order of its priority list without depends_on
+	for taskName, deps := range graph {
+		if len(deps) == 0 {
+			continue
+		}
+		namespaced := make([]string, 0, len(deps))
+		for _, dep := range deps {
+			namespaced = append(namespaced, name(dep))
+		}
+		t.DependsOn[name(taskName)] = namespaced
+	}
+	return nil
+}
+
+// actionRegister returns the register of the action, the hash of its name without the register field
+func actionRegister(action *Action) string {
+	if action.Register == "" {
+		return register.GetHash(action.Name)
+	}
+	return action.Register
+}
+
+// renameExpRegisters renames the registers of a register expression, e.g. "copy" of "copy.changed eq true"
+func renameExpRegisters(exp string, rename func(string) string) string {
+	if exp == "" {
+		return exp
+	}
+	tokens := strings.Split(exp, " ")
+	for i, token := range tokens {
+		if dot := strings.LastIndex(token, "."); dot > 0 {
+			tokens[i] = rename(token[:dot]) + token[dot:]
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// renameFuncRegisters renames the registers used with the register template function in the strings of value
+func renameFuncRegisters(value interface{}, rename func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return registerFuncRef.ReplaceAllStringFunc(v, func(match string) string {
+			reg := registerFuncRef.FindStringSubmatch(match)[1]
+			return strings.Replace(match, `"`+reg+`"`, `"`+rename(reg)+`"`, 1)
+		})
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			renamed[key] = renameFuncRegisters(val, rename)
+		}
+		return renamed
+	case []interface{}:
+		renamed := make([]interface{}, len(v))
+		for i, val := range v {
+			renamed[i] = renameFuncRegisters(val, rename)
+		}
+		return renamed
+	}
+	return value
+}
+
+// fileFormat returns the format of a file from its extension, FormatAuto if it is not known
+func fileFormat(file string) string {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatAuto
+}
@@ -19,13 +19,24 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/acceldata-io/goutils/netutils"
+	"github.com/acceldata-io/wizard/pkg/facts"
 )
 
 type TaskList struct {
-	Tasks    map[string][]*Action `json:"tasks"`
-	Priority []string             `json:"priority"`
+	Tasks     map[string][]*Action `json:"tasks"`
+	Priority  []string             `json:"priority"`
+	DependsOn map[string][]string  `json:"depends_on"`
+	// Handlers are the actions run when they are notified by a changed action, in the order of the list
+	Handlers []*Action `json:"handlers"`
+	// FlushHandlers is when the notified handlers run, "run" (the default) at the end of the run or "task" at the end of each task
+	FlushHandlers string `json:"flush_handlers"`
+	// TaskTags are the tags of each task, inherited by all the actions of the task
+	TaskTags map[string][]string `json:"task_tags"`
+	// Include are the task list files merged into the task list, see Include
+	Include []*Include `json:"include"`
 }
 
 type Action struct {
@@ -38,7 +49,27 @@ type Action struct {
 	ActionVariables map[string]interface{} `json:"action_var"`
 	Timeout         int                    `json:"timeout"`
 	Register        string                 `json:"register"`
-	BackupSrc       string
+	Notify          []string               `json:"notify"`
+	// Retries is the number of times the action is run again when it fails or its until condition is not met
+	Retries int `json:"retries"`
+	// Delay is the number of seconds to wait before a retry
+	Delay int `json:"delay"`
+	// Backoff multiplies the delay after each retry, 0 keeps the same delay
+	Backoff float64 `json:"backoff"`
+	// Until is a register expression, like the rvar of when, which should be true for the action to succeed
+	Until string `json:"until"`
+	// Loop is a list of items or the name of a TemplateConfig field holding a list, the action runs once per item
+	Loop interface{} `json:"loop"`
+	// Tags select the action with the tag filters of the run, with the tags of its task
+	Tags []string `json:"tags"`
+	// Vars are the variables of the action, used in its templates with the var function, e.g. {{ var "java_home" }}
+	// The vars of an include are added to the vars of the included actions
+	Vars map[string]interface{} `json:"vars"`
+	// Block are the actions of a "block" action, Rescue runs if one of them fails and Always runs in any case
+	Block     []*Action `json:"block"`
+	Rescue    []*Action `json:"rescue"`
+	Always    []*Action `json:"always"`
+	BackupSrc string
 }
 
 type when struct {
@@ -54,16 +85,74 @@ var wizardFacts = map[string]interface{}{
 	"fqdn_hostname": getFactFQDNHostname,
 	"cmd_hostname":  getFactCMDHostname,
 	"env":           func(envKey string) string { return env[envKey] },
+	"facts":         getFacts,
 }
 
-// ParseConfig populates the json data into the Tasks structure
+// getFacts gathers the system facts on the first call, e.g. {{ (facts).OS.Family }}
+var getFacts = sync.OnceValues(facts.Gather)
+
+// ParseConfig populates the json or yaml data into the Tasks structure, the format is detected
 func ParseConfig(Config []byte) (config TaskList, err error) {
-	if err = json.Unmarshal(Config, &config); err != nil {
-		err = fmt.Errorf("ParseConfig: error unmarshalling config json - %s", err.Error())
+	return ParseConfigFormat(Config, FormatAuto)
+}
+
+// ParseConfigFormat is the same as ParseConfig with the format of the config, FormatAuto, FormatJSON or FormatYAML
+// The errors report the line and the column of the invalid value
+func ParseConfigFormat(Config []byte, format string) (config TaskList, err error) {
+	return ParseConfigOptions(Config, ParseOptions{Format: format})
+}
+
+// ParseOptions are the options of ParseConfigOptions
+type ParseOptions struct {
+	// Format is FormatAuto, FormatJSON or FormatYAML
+	Format string
+	// Load reads the included files, a config with includes fails without it
+	Load Loader
+}
+
+// ParseConfigOptions is the same as ParseConfig with the options, the included files are merged into the TaskList
+func ParseConfigOptions(Config []byte, opts ParseOptions) (config TaskList, err error) {
+	if config, err = decodeConfig(Config, opts.Format); err != nil {
+		return config, fmt.Errorf("ParseConfig: %s", err.Error())
+	}
+	if err = config.resolveIncludes(opts.Load, nil); err != nil {
+		return config, fmt.Errorf("ParseConfig: %s", err.Error())
+	}
+	if err = config.validateGraph(); err != nil {
+		return config, fmt.Errorf("ParseConfig: %s", err.Error())
+	}
+	if err = config.validateHandlers(); err != nil {
+		return config, fmt.Errorf("ParseConfig: %s", err.Error())
+	}
+	if err = config.validateTags(); err != nil {
+		err = fmt.Errorf("ParseConfig: %s", err.Error())
 	}
 	return config, err
 }
 
+// decodeConfig decodes the JSON or YAML config without validating it
+func decodeConfig(Config []byte, format string) (config TaskList, err error) {
+	if format == FormatAuto {
+		format = detectFormat(Config)
+	}
+	jsonConfig := Config
+	var positions []position
+	switch format {
+	case FormatJSON:
+	case FormatYAML:
+		if jsonConfig, positions, err = yamlToJSON(Config); err != nil {
+			return config, fmt.Errorf("error unmarshalling config yaml - %s", err.Error())
+		}
+	default:
+		return config, fmt.Errorf("unknown config format %q", format)
+	}
+
+	if err = json.Unmarshal(jsonConfig, &config); err != nil {
+		return config, fmt.Errorf("error unmarshalling config %s - %s", format, errorPosition(err, Config, positions))
+	}
+	return config, nil
+}
+
 // ParseWizardFacts populated the yaml data into the TemplateConfig structure
 func ParseWizardFacts() (facts map[string]interface{}, err error) {
 	return GetWizardFacts(), err
@@ -84,6 +173,26 @@ func GetWizardFacts() map[string]interface{} {
 	return wizardFacts
 }
 
+// GetWizardFactsWithCustom returns the wizard facts with the custom facts in the Custom field of facts
+// The custom facts are loaded on the first call of facts, their errors are in the CustomErrors field
+func GetWizardFactsWithCustom(custom func() (map[string]interface{}, []error)) map[string]interface{} {
+	withCustom := MergeFuncMap(wizardFacts, nil)
+	withCustom["facts"] = sync.OnceValues(func() (*facts.Facts, error) {
+		system, err := getFacts()
+		if err != nil {
+			return nil, err
+		}
+		customFacts, errs := custom()
+		all := *system
+		all.Custom = customFacts
+		for _, err := range errs {
+			all.CustomErrors = append(all.CustomErrors, err.Error())
+		}
+		return &all, nil
+	})
+	return withCustom
+}
+
 func getFactOSHostname() string {
 	hostname, _ := netutils.GetHostName("OS", 10)
 	return hostname
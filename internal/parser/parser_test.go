@@ -15,7 +15,11 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -34,3 +38,402 @@ func TestParseConfigPass(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestParseConfigCycle(t *testing.T) {
+	file, _ := os.ReadFile("../../testdata/parser_config_cycle.json")
+	_, err := ParseConfig(file)
+	if err == nil || !strings.Contains(err.Error(), "cycle found - a -> c -> b -> a") {
+		t.Fatalf("expected cycle error, got: %v", err)
+	}
+}
+
+func TestParseConfigUnknownDependency(t *testing.T) {
+	_, err := ParseConfig([]byte(`{"tasks": {"a": []}, "depends_on": {"a": ["b"]}, "priority": ["a"]}`))
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestTaskGraphSerialPriority(t *testing.T) {
+	file, _ := os.ReadFile("../../testdata/parser_config_pass.json")
+	config, err := ParseConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph := config.TaskGraph()
+	for i, taskName := range config.Priority {
+		if i > 0 && (len(graph[taskName]) != 1 || graph[taskName][0] != config.Priority[i-1]) {
+			t.Fatalf("expected %s to depend on %s, got: %v", taskName, config.Priority[i-1], graph[taskName])
+		}
+	}
+}
+
+func TestParseConfigHandlers(t *testing.T) {
+	file, _ := os.ReadFile("../../testdata/task_handlers.json")
+	config, err := ParseConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Handlers) != 2 || config.Handlers[0].Name != "restart app" {
+		t.Fatalf("unexpected handlers: %v", config.Handlers)
+	}
+
+	_, err = ParseConfig([]byte(`{"tasks": {"a": [{"action": "cmd", "name": "ls", "notify": ["restart"]}]}, "priority": ["a"]}`))
+	if err == nil || !strings.Contains(err.Error(), `notifies "restart" which is not a handler`) {
+		t.Fatalf("expected unknown handler error, got: %v", err)
+	}
+}
+
+func TestParseConfigTags(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"tasks": {"a": [{"action": "cmd", "name": "ls", "tags": ["config"]}]},
+		"task_tags": {"a": ["agent"]}, "priority": ["a"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := config.ActionTags("a", config.Tasks["a"][0]); strings.Join(tags, ",") != "agent,config" {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+
+	_, err = ParseConfig([]byte(`{"tasks": {"a": []}, "task_tags": {"b": ["agent"]}, "priority": ["a"]}`))
+	if err == nil || !strings.Contains(err.Error(), `task "b" is not defined`) {
+		t.Fatalf("expected unknown task error, got: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"tasks": {
+		"a": [
+			{"action": "cmd", "name": "version", "register": "version"},
+			{"action": "cmd", "name": "install", "register": "version", "when": {"rvar": "versoin.stdout eq 1"}},
+			{"action": "bad", "name": "poll", "until": "poll.exit_code eq 0", "command": ["{{ (register \"users\").StdOut }}"]}
+		],
+		"b": [
+			{"action": "cmd", "name": "users", "register": "users", "loop": ["a", "b"]},
+			{"action": "cmd", "name": "check", "when": {"rvar": "users[1].changed eq true and version.changed eq false"}},
+			{"action": "cmd", "name": "check"}
+		]
+	}, "priority": ["a", "b", "c"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = config.Validate(func(action *Action) error {
+		if action.Action == "bad" {
+			return fmt.Errorf("unknown action %q", action.Action)
+		}
+		return nil
+	})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *ValidationError, got: %v", err)
+	}
+	expected := []Problem{
+		{Path: "$.priority[2]", Message: `task "c" is not defined in tasks`},
+		{Path: "$.tasks.a[1].register", Message: `register "version" is already used by $.tasks.a[0]`},
+		{Path: "$.tasks.b[2].name", Message: `name "check" is already used by $.tasks.b[1], set a register to tell their results apart`},
+		{Path: "$.tasks.a[1].when.rvar", Message: `register "versoin" is not defined`},
+		{Path: "$.tasks.a[2]", Message: `unknown action "bad"`},
+		{Path: "$.tasks.a[2].until", Message: `register "poll" is not defined`},
+	}
+	if !reflect.DeepEqual(verr.Problems, expected) {
+		t.Fatalf("unexpected problems:\n%s", err)
+	}
+}
+
+func TestParseConfigYAML(t *testing.T) {
+	jsonFile, _ := os.ReadFile("../../testdata/parser_config_pass.json")
+	expected, err := ParseConfig(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlFile, _ := os.ReadFile("../../testdata/parser_config_pass.yaml")
+	config, err := ParseConfig(yamlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("expected the YAML config to be the same as the JSON config, got: %+v", config)
+	}
+	if _, err = ParseConfigFormat(yamlFile, FormatJSON); err == nil {
+		t.Fatal("expected a YAML config parsed as JSON to fail")
+	}
+}
+
+func TestParseConfigErrorPosition(t *testing.T) {
+	tests := []struct {
+		name, config, format, expected string
+	}{
+		{
+			name:     "json syntax",
+			config:   "{\n  \"tasks\": {\n    \"a\": [}\n}",
+			expected: "line 3, column 11: invalid character '}'",
+		},
+		{
+			name:     "json type",
+			config:   "{\n  \"tasks\": {},\n  \"priority\": \"a\"\n}",
+			expected: "line 3, column 17: json: cannot unmarshal string",
+		},
+		{
+			name:     "yaml type",
+			config:   "tasks:\n  a:\n    - action: cmd\n      name: ls\n      retries: many\npriority: [a]\n",
+			expected: "line 5, column 16: json: cannot unmarshal string",
+		},
+		{
+			name:     "yaml fail",
+			config:   func() string { file, _ := os.ReadFile("../../testdata/parser_config_fail.yaml"); return string(file) }(),
+			expected: "yaml: line 2: did not find expected",
+		},
+	}
+	for _, test := range tests {
+		_, err := ParseConfigFormat([]byte(test.config), test.format)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("%s: expected %q, got: %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestParseConfigYAMLAliases(t *testing.T) {
+	// nine levels of ten aliases expand to a billion nodes
+	var bomb strings.Builder
+	bomb.WriteString("a: &a [lol, lol, lol, lol, lol, lol, lol, lol, lol, lol]\n")
+	for level := 'b'; level <= 'j'; level++ {
+		fmt.Fprintf(&bomb, "%c: &%c [", level, level)
+		for i := 0; i < 10; i++ {
+			if i > 0 {
+				bomb.WriteString(", ")
+			}
+			fmt.Fprintf(&bomb, "*%c", level-1)
+		}
+		bomb.WriteString("]\n")
+	}
+
+	tests := []struct {
+		name, config, expected string
+	}{
+		{
+			name:     "self reference",
+			config:   "tasks: &x\n  a: *x\npriority: [a]\n",
+			expected: "line 2, column 6: alias *x references itself",
+		},
+		{
+			name:     "nested reference",
+			config:   "tasks: &x\n  a:\n    - b: [*x]\npriority: [a]\n",
+			expected: "alias *x references itself",
+		},
+		{
+			name:     "merge reference",
+			config:   "tasks: &x\n  a:\n    <<: *x\npriority: [a]\n",
+			expected: "a merge key references a mapping it is in",
+		},
+		{
+			name:     "billion laughs",
+			config:   bomb.String(),
+			expected: "too many aliases expanded",
+		},
+	}
+	for _, test := range tests {
+		_, err := ParseConfigFormat([]byte(test.config), FormatYAML)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("%s: expected %q, got: %v", test.name, test.expected, err)
+		}
+	}
+
+	// an alias used many times within the limit is expanded
+	config := "defaults: &cmd {action: cmd, command: [\"true\"]}\ntasks:\n  a:\n"
+	for i := 0; i < 200; i++ {
+		config += fmt.Sprintf("    - {<<: *cmd, name: cmd%d}\n", i)
+	}
+	taskList, err := ParseConfigFormat([]byte(config+"priority: [a]\n"), FormatYAML)
+	if err != nil || len(taskList.Tasks["a"]) != 200 || taskList.Tasks["a"][199].Action != "cmd" {
+		t.Fatalf("expected the aliases to be expanded, got %v", err)
+	}
+}
+
+func TestParseConfigIncludeTwice(t *testing.T) {
+	shared := `
+tasks:
+  check:
+    - action: cmd
+      name: check service
+      command: [status]
+      register: status
+    - action: cmd
+      name: restart service
+      command: [restart, '{{ (register "status").StdOut }}']
+      register: restart
+      until: restart.exit_code eq 0 and status.changed eq false
+      when: {rvar: status.exit_code eq 1}
+    - action: cmd
+      name: report service
+      command: [report]
+priority: [check]
+`
+	load := func(file, srcType string) ([]byte, error) {
+		return []byte(shared), nil
+	}
+	config, err := ParseConfigOptions([]byte(`{"tasks": {},
+		"include": [{"file": "service.yaml", "namespace": "a"}, {"file": "service.yaml", "namespace": "b"}],
+		"priority": ["a", "b"]}`), ParseOptions{Load: load})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = config.Validate(func(*Action) error { return nil }); err != nil {
+		t.Fatalf("expected the registers to be namespaced, got %v", err)
+	}
+	restart := config.Tasks["b.check"][1]
+	if config.Tasks["b.check"][0].Register != "b.status" || restart.Register != "b.restart" {
+		t.Fatalf("unexpected registers: %q, %q", config.Tasks["b.check"][0].Register, restart.Register)
+	}
+	if restart.Until != "b.restart.exit_code eq 0 and b.status.changed eq false" {
+		t.Fatalf("unexpected until: %q", restart.Until)
+	}
+	if restart.When.RVar != "b.status.exit_code eq 1" {
+		t.Fatalf("unexpected when.rvar: %q", restart.When.RVar)
+	}
+	if restart.Command[1] != `{{ (register "b.status").StdOut }}` {
+		t.Fatalf("unexpected command: %q", restart.Command[1])
+	}
+}
+
+func TestParseConfigIncludes(t *testing.T) {
+	files := map[string]string{
+		"common/java.yaml": `
+tasks:
+  install:
+    - action: cmd
+      name: install java {{ var "version" }}
+      command: [install-java]
+      vars: {version: "8", home: /usr/lib/jvm}
+      notify: [java updated]
+  users:
+    - action: cmd
+      name: create java user
+      command: [useradd, java]
+priority: [install, users]
+handlers:
+  - action: cmd
+    name: java updated
+    command: ["true"]
+include:
+  - file: base.json
+`,
+		"common/base.json": `{"tasks": {"dirs": [{"action": "cmd", "name": "create dirs", "command": ["mkdir"]}]}, "priority": ["dirs"]}`,
+		"cycle/a.json":     `{"tasks": {}, "include": [{"file": "b.json"}]}`,
+		"cycle/b.json":     `{"tasks": {}, "include": [{"file": "a.json"}]}`,
+		"graph.json":       `{"tasks": {"a": [], "b": []}, "depends_on": {"b": ["a"]}, "priority": ["a", "b"]}`,
+	}
+	load := func(file, srcType string) ([]byte, error) {
+		data, ok := files[file]
+		if !ok || srcType != "embed" {
+			return nil, fmt.Errorf("%s not found", file)
+		}
+		return []byte(data), nil
+	}
+
+	config, err := ParseConfigOptions([]byte(`{"tasks": {"kafka": [{"action": "cmd", "name": "install kafka", "command": ["install-kafka"]}]},
+		"include": [{"file": "common/java.yaml", "vars": {"version": "11"}}],
+		"priority": ["java", "kafka"]}`), ParseOptions{Load: load})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"java.install", "java.users", "kafka"}; !reflect.DeepEqual(config.Priority, expected) {
+		t.Fatalf("expected the priority %v, got %v", expected, config.Priority)
+	}
+	if _, ok := config.Tasks["java.base.dirs"]; !ok {
+		t.Fatalf("expected the nested include, got the tasks %v", config.Tasks)
+	}
+	install := config.Tasks["java.install"][0]
+	if !reflect.DeepEqual(install.Vars, map[string]interface{}{"version": "11", "home": "/usr/lib/jvm"}) {
+		t.Fatalf("expected the include vars to override the action vars, got %v", install.Vars)
+	}
+	if len(config.Handlers) != 1 || config.Handlers[0].Name != "java.java updated" {
+		t.Fatalf("unexpected handlers: %v", config.Handlers)
+	}
+	if !reflect.DeepEqual(install.Notify, []string{"java.java updated"}) {
+		t.Fatalf("expected the notify to be namespaced, got %v", install.Notify)
+	}
+
+	tests := []struct {
+		name, config, expected string
+	}{
+		{
+			name:     "cycle",
+			config:   `{"tasks": {}, "include": [{"file": "cycle/a.json"}], "priority": []}`,
+			expected: "include cycle found - embed:cycle/a.json -> embed:cycle/b.json -> embed:cycle/a.json",
+		},
+		{
+			name:     "missing file",
+			config:   `{"tasks": {}, "include": [{"file": "missing.json"}], "priority": []}`,
+			expected: "include missing.json: missing.json not found",
+		},
+		{
+			name:     "depends_on",
+			config:   `{"tasks": {}, "include": [{"file": "graph.json"}], "priority": ["graph"]}`,
+			expected: "declares depends_on",
+		},
+		{
+			name:     "duplicate namespace",
+			config:   `{"tasks": {}, "include": [{"file": "common/base.json"}, {"file": "common/base.json"}], "priority": []}`,
+			expected: `task "base.dirs" is already defined`,
+		},
+	}
+	for _, test := range tests {
+		_, err := ParseConfigOptions([]byte(test.config), ParseOptions{Load: load})
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("%s: expected %q, got: %v", test.name, test.expected, err)
+		}
+	}
+
+	config, err = ParseConfigOptions([]byte(`{"tasks": {"kafka": []}, "include": [{"file": "graph.json", "namespace": "g"}],
+		"depends_on": {"kafka": ["g"]}, "priority": ["g", "kafka"]}`), ParseOptions{Load: load})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config.DependsOn["kafka"], []string{"g.a", "g.b"}) || !reflect.DeepEqual(config.DependsOn["g.b"], []string{"g.a"}) {
+		t.Fatalf("unexpected depends_on: %v", config.DependsOn)
+	}
+
+	// the namespace as a task of depends_on is its root tasks
+	config, err = ParseConfigOptions([]byte(`{"tasks": {"kafka": []}, "include": [{"file": "graph.json", "namespace": "g"}],
+		"depends_on": {"g": ["kafka"]}, "priority": ["kafka", "g"]}`), ParseOptions{Load: load})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"g.a": {"kafka"}, "g.b": {"g.a"}}
+	if !reflect.DeepEqual(config.DependsOn, expected) {
+		t.Fatalf("expected %v, got the depends_on %v", expected, config.DependsOn)
+	}
+}
+
+func TestValidateBlock(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"tasks": {"a": [
+		{"action": "block", "name": "install", "register": "install", "block": [
+			{"action": "cmd", "name": "start", "register": "start"},
+			{"action": "cmd", "name": "again", "register": "start", "rescue": [{"action": "cmd", "name": "stop"}]}
+		], "rescue": [
+			{"action": "cmd", "name": "rollback", "when": {"rvar": "install.failed eq true"}}
+		]},
+		{"action": "block", "name": "empty", "loop": ["a"]}
+	]}, "priority": ["a"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = config.Validate(func(action *Action) error { return nil })
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *ValidationError, got: %v", err)
+	}
+	for _, expected := range []string{
+		`$.tasks.a[0].block[1]: block, rescue and always are only used by a "block" action`,
+		`$.tasks.a[0].block[1].register: register "start" is already used by $.tasks.a[0].block[0]`,
+		`$.tasks.a[1]: a "block" action should have a block`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in:\n%s", expected, err)
+		}
+	}
+	if _, err := ParseConfig([]byte(`{"tasks": {"a": [{"action": "block", "name": "b", "block": [{"action": "cmd", "name": "c", "notify": ["missing"]}]}]}, "priority": ["a"]}`)); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("expected the notify of a nested action to be validated, got: %v", err)
+	}
+}
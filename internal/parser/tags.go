@@ -0,0 +1,34 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import "fmt"
+
+// validateTags checks that the task tags are of defined tasks
+func (t TaskList) validateTags() error {
+	for taskName := range t.TaskTags {
+		if _, ok := t.Tasks[taskName]; !ok {
+			return fmt.Errorf("task_tags: task %q is not defined in tasks", taskName)
+		}
+	}
+	return nil
+}
+
+// ActionTags returns the tags of the action with the tags of its task
+func (t TaskList) ActionTags(taskName string, action *Action) []string {
+	tags := make([]string, 0, len(t.TaskTags[taskName])+len(action.Tags))
+	tags = append(tags, t.TaskTags[taskName]...)
+	return append(tags, action.Tags...)
+}
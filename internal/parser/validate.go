@@ -0,0 +1,208 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/acceldata-io/wizard/pkg/register"
+)
+
+// registerFuncRef matches the register template function, e.g. {{ (register "version").StdOut }}
+var registerFuncRef = regexp.MustCompile(`register\s+"([^"]+)"`)
+
+// Problem is an invalid value of the config at a JSON path, e.g. "$.tasks.kafka[2].action_var"
+type Problem struct {
+	Path    string
+	Message string
+}
+
+// ValidationError is returned by Validate with all the problems of the config
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		lines = append(lines, fmt.Sprintf("%s: %s", problem.Path, problem.Message))
+	}
+	return fmt.Sprintf("%d problem(s) in config:\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+func (e *ValidationError) add(path, format string, args ...interface{}) {
+	message := strings.ReplaceAll(fmt.Sprintf(format, args...), "\n", "; ")
+	e.Problems = append(e.Problems, Problem{Path: path, Message: message})
+}
+
+// actionPath is an action of the config with its JSON path
+type actionPath struct {
+	path   string
+	action *Action
+}
+
+// actions returns the actions of the tasks, sorted by task name, and then the handlers, each followed by its nested actions
+func (t TaskList) actions() []actionPath {
+	taskNames := make([]string, 0, len(t.Tasks))
+	for taskName := range t.Tasks {
+		taskNames = append(taskNames, taskName)
+	}
+	sort.Strings(taskNames)
+
+	var all []actionPath
+	for _, taskName := range taskNames {
+		for i, action := range t.Tasks[taskName] {
+			path := fmt.Sprintf("$.tasks.%s[%d]", taskName, i)
+			all = append(all, actionPath{path: path, action: action})
+			all = append(all, nestedActions(path, action)...)
+		}
+	}
+	for i, handler := range t.Handlers {
+		path := fmt.Sprintf("$.handlers[%d]", i)
+		all = append(all, actionPath{path: path, action: handler})
+		all = append(all, nestedActions(path, handler)...)
+	}
+	return all
+}
+
+// Validate checks the whole config before it runs and returns a *ValidationError with all the problems found:
+// the priority entries should be tasks, the register names and the names of the actions without a register unique,
+// the registers used by when, until and the register template function defined, and validateAction should accept
+// every action, e.g. its action_var
+func (t TaskList) Validate(validateAction func(action *Action) error) error {
+	verr := &ValidationError{}
+
+	for i, taskName := range t.Priority {
+		if _, ok := t.Tasks[taskName]; !ok {
+			verr.add(fmt.Sprintf("$.priority[%d]", i), "task %q is not defined in tasks", taskName)
+		}
+	}
+
+	all := t.actions()
+	registers := make(map[string]string, len(all))
+	// an action without a register has the register of the hash of its name, two of them would share it
+	hashed := make(map[string]string, len(all))
+	for _, a := range all {
+		if a.action.Register == "" {
+			hash := register.GetHash(a.action.Name)
+			if path, ok := hashed[hash]; ok {
+				verr.add(a.path+".name", "name %q is already used by %s, set a register to tell their results apart", a.action.Name, path)
+				continue
+			}
+			hashed[hash] = a.path
+			continue
+		}
+		if path, ok := registers[a.action.Register]; ok {
+			verr.add(a.path+".register", "register %q is already used by %s", a.action.Register, path)
+			continue
+		}
+		registers[a.action.Register] = a.path
+	}
+	defined := func(name string) bool {
+		if i := strings.Index(name, "["); i > 0 && strings.HasSuffix(name, "]") {
+			name = name[:i]
+		}
+		if _, ok := registers[name]; ok {
+			return true
+		}
+		for _, a := range all {
+			if register.GetHash(a.action.Name) == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, a := range all {
+		if err := validateBlock(a.action); err != nil {
+			verr.add(a.path, "%s", err.Error())
+		} else if a.action.Action != ActionBlock {
+			if err := validateAction(a.action); err != nil {
+				verr.add(a.path, "%s", err.Error())
+			}
+		}
+		if a.action.When != nil {
+			for _, name := range expressionRegisters(a.action.When.RVar) {
+				if !defined(name) {
+					verr.add(a.path+".when.rvar", "register %q is not defined", name)
+				}
+			}
+		}
+		for _, name := range expressionRegisters(a.action.Until) {
+			if !defined(name) {
+				verr.add(a.path+".until", "register %q is not defined", name)
+			}
+		}
+		for _, name := range templateRegisters(a.action) {
+			if !defined(name) {
+				verr.add(a.path, "register %q used by the register template function is not defined", name)
+			}
+		}
+	}
+
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// expressionRegisters returns the registers of a register expression, e.g. "copy" for "copy.changed eq true"
+func expressionRegisters(exp string) []string {
+	var names []string
+	for _, token := range strings.Fields(exp) {
+		if dot := strings.LastIndex(token, "."); dot > 0 {
+			names = append(names, token[:dot])
+		}
+	}
+	return names
+}
+
+// templateRegisters returns the registers used with the register template function in the rendered fields of the action
+func templateRegisters(action *Action) []string {
+	values := []interface{}{action.Name, action.ActionVariables}
+	for _, arg := range action.Command {
+		values = append(values, arg)
+	}
+	if action.When != nil {
+		values = append(values, action.When.Command)
+	}
+
+	var names []string
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			for _, match := range registerFuncRef.FindAllStringSubmatch(v, -1) {
+				names = append(names, match[1])
+			}
+		case map[string]interface{}:
+			for _, val := range v {
+				walk(val)
+			}
+		case []interface{}:
+			for _, val := range v {
+				walk(val)
+			}
+		}
+	}
+	for _, value := range values {
+		walk(value)
+	}
+	sort.Strings(names)
+	return names
+}
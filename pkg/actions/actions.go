@@ -15,15 +15,81 @@
 package actions
 
 import (
+	"context"
 	"embed"
 
 	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
+	"github.com/acceldata-io/wizard/pkg/wlog"
 )
 
 //go:generate mockgen -source ./actions.go -destination ./mocks/mock_actions.go
 
+// Action is implemented by every action of the wizard
+// The ctx passed to Do is cancelled when the run is aborted, an action should stop its work and return as soon as possible
 type Action interface {
-	Do(actions *parser.Action, wizardLog chan interface{}) error
+	Do(ctx context.Context, actions *parser.Action, wizardLog chan interface{}) error
 }
 
+// Validator is implemented by the actions which can check their action_var before the run
+// Validate should not change the system, the action is built with empty settings to call it
+type Validator interface {
+	Validate(actions *parser.Action) error
+}
+
+// ActionVars returns a zero value of the action_var struct of each built-in action by action name
+// The JSON schema of the action_var is generated from it, a cmd action has no action_var
+func ActionVars() map[string]interface{} {
+	return map[string]interface{}{
+		"copy":     copyVars{},
+		"template": templateVars{},
+		"file":     fileVar{},
+		"user":     userVars{},
+		"systemd":  systemDVar{},
+	}
+}
+
+// Play is the action of the JSON given to Do, the custom actions outside the wizard use it to read their action_var
+type Play = parser.Action
+
 var PackageFiles embed.FS
+
+// Options are the run wide settings of a task passed to every action
+type Options struct {
+	// CheckMode makes the actions report what they would change without changing the system
+	CheckMode bool
+	// Diff makes copy and template log the unified diff of the files they change and store it in the register
+	Diff bool
+	// Transactional makes the actions record how to undo their changes, see Reverter
+	Transactional bool
+	// Registers are the registers of the run, the actions store their result in them
+	Registers *register.Store
+	// Transport is the machine the actions are applied to, the local machine when nil
+	// The src files of copy and template are always read from the local machine or the embedded files
+	Transport transport.Transport
+}
+
+// target returns the Transport of the actions
+func (o Options) target() transport.Transport {
+	return targetOf(o.Transport)
+}
+
+// targetOf returns the target, transport.Local if nil
+func targetOf(target transport.Transport) transport.Transport {
+	if target == nil {
+		return transport.Local
+	}
+	return target
+}
+
+// reportCheckMode logs the change an action would do and marks its register as changed
+// Returns true in check mode, the caller should then skip the change
+func reportCheckMode(opts Options, aRegister *register.Register, wizardLog chan interface{}, change string) bool {
+	if !opts.CheckMode {
+		return false
+	}
+	wizardLog <- wlog.WLInfo("check mode: would " + change)
+	aRegister.Changed = true
+	return true
+}
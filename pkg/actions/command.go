@@ -20,41 +20,46 @@ import (
 	"time"
 
 	"github.com/acceldata-io/wizard/internal/parser"
-	"github.com/acceldata-io/wizard/pkg/register"
 	"github.com/acceldata-io/wizard/pkg/wlog"
-
-	command "github.com/acceldata-io/goutils/shellutils/cmd"
 )
 
 type cmd struct {
 	timeout  int
 	register string
+	opts     Options
 }
 
-func NewCmdAction(timeout int, localRegister string) Action {
-	return &cmd{timeout: timeout, register: localRegister}
+func NewCmdAction(timeout int, localRegister string, opts Options) Action {
+	return &cmd{timeout: timeout, register: localRegister, opts: opts}
 }
 
-func (s *cmd) Do(actions *parser.Action, wizardLog chan interface{}) error {
-	sRegister := register.RMap[s.register]
+func (s *cmd) Do(ctx context.Context, actions *parser.Action, wizardLog chan interface{}) error {
+	sRegister := s.opts.Registers.Get(s.register)
 
 	if len(actions.Command) < 1 {
 		wizardLog <- wlog.WLError("wrong command found, length of the command is less than 1")
 		return fmt.Errorf("wrong command found")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.timeout)*time.Second)
+	// the outcome of a command is not known without running it
+	if reportCheckMode(s.opts, sRegister, wizardLog, fmt.Sprintf("run command: %q", actions.Command)) {
+		return nil
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, time.Duration(s.timeout)*time.Second)
 	defer cancel()
 
-	execCmd := command.New(ctx, actions.Command[0], actions.Command[1:])
-	wizardLog <- wlog.WLInfo("running command: " + execCmd.Command)
-	cmd, err := execCmd.Run()
+	wizardLog <- wlog.WLInfo("running command: " + actions.Command[0])
+	status, err := s.opts.target().Run(cmdCtx, actions.Command[0], actions.Command[1:]...)
+	if ctx.Err() != nil {
+		wizardLog <- wlog.WLError(fmt.Sprintf("command %q interrupted", actions.Command))
+		return fmt.Errorf("command %q interrupted: %w", actions.Command, ctx.Err())
+	}
 	if err != nil {
 		wizardLog <- wlog.WLError(fmt.Sprintf("unable to execute the command: %q. Because: %s", actions.Command, err.Error()))
 		return fmt.Errorf("unable to execute the command: %q. Because: %s", actions.Command, err.Error())
 	}
 
-	status := cmd.Status
 	sRegister.StdOut = status.StdOut
 	sRegister.ExitCode = status.ExitCode
 	if status.ExitCode != int(actions.ExitCode) {
@@ -15,20 +15,24 @@
 package actions
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/acceldata-io/wizard/internal/parser"
 	"github.com/acceldata-io/wizard/pkg/register"
 )
 
 func TestCommandLengthFail(t *testing.T) {
-	register.RMap["test"] = &register.Register{}
-	command := NewCmdAction(10, "test")
+	registers := register.NewStore()
+	registers.Set("test", &register.Register{})
+	command := NewCmdAction(10, "test", Options{Registers: registers})
 
 	var err error
 	wLog := make(chan interface{})
 	go func() {
-		err = command.Do(&parser.Action{
+		err = command.Do(context.Background(), &parser.Action{
 			Action:   "cmd",
 			Name:     "no command",
 			Command:  nil,
@@ -47,13 +51,14 @@ func TestCommandLengthFail(t *testing.T) {
 }
 
 func TestCommandExitCodeMatch(t *testing.T) {
-	register.RMap["test"] = &register.Register{}
-	command := NewCmdAction(10, "test")
+	registers := register.NewStore()
+	registers.Set("test", &register.Register{})
+	command := NewCmdAction(10, "test", Options{Registers: registers})
 
 	var err error
 	wLog := make(chan interface{})
 	go func() {
-		err = command.Do(&parser.Action{
+		err = command.Do(context.Background(), &parser.Action{
 			Action:   "cmd",
 			Name:     "ls",
 			Command:  []string{"ls", "-lha"},
@@ -73,12 +78,13 @@ func TestCommandExitCodeMatch(t *testing.T) {
 }
 
 func TestCommandExitCodeNotMatch(t *testing.T) {
-	register.RMap["test"] = &register.Register{}
-	command := NewCmdAction(10, "test")
+	registers := register.NewStore()
+	registers.Set("test", &register.Register{})
+	command := NewCmdAction(10, "test", Options{Registers: registers})
 	var err error
 	wLog := make(chan interface{})
 	go func() {
-		err = command.Do(&parser.Action{
+		err = command.Do(context.Background(), &parser.Action{
 			Action:   "cmd",
 			Name:     "ls",
 			Command:  []string{"ls", "-lha"},
@@ -96,3 +102,62 @@ func TestCommandExitCodeNotMatch(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestCommandInterrupted(t *testing.T) {
+	registers := register.NewStore()
+	registers.Set("test", &register.Register{})
+	command := NewCmdAction(10, "test", Options{Registers: registers})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	var err error
+	start := time.Now()
+	wLog := make(chan interface{})
+	go func() {
+		err = command.Do(ctx, &parser.Action{
+			Action:   "cmd",
+			Name:     "sleep",
+			Command:  []string{"sleep", "5"},
+			Register: register.GetHash("test"),
+		}, wLog)
+		close(wLog)
+	}()
+
+	// This is here to wait for the channel
+	for range wLog {
+	}
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+	if time.Since(start) > 4*time.Second {
+		t.Fatalf("command was not killed on cancel")
+	}
+}
+
+func TestCommandCheckMode(t *testing.T) {
+	registers := register.NewStore()
+	registers.Set("test", &register.Register{})
+	command := NewCmdAction(10, "test", Options{CheckMode: true, Registers: registers})
+
+	var err error
+	wLog := make(chan interface{})
+	go func() {
+		err = command.Do(context.Background(), &parser.Action{
+			Action:   "cmd",
+			Name:     "false",
+			Command:  []string{"false"},
+			ExitCode: 0,
+		}, wLog)
+		close(wLog)
+	}()
+
+	// This is here to wait for the channel
+	for range wLog {
+	}
+
+	if err != nil || !registers.Get("test").Changed {
+		t.Fatalf("command should not run in check mode, err: %v", err)
+	}
+}
@@ -15,6 +15,8 @@
 package actions
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"embed"
 	"encoding/base64"
@@ -25,7 +27,6 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"os"
-	"os/user"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -33,7 +34,7 @@ import (
 	"syscall"
 
 	"github.com/acceldata-io/wizard/internal/parser"
-	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
 	"github.com/acceldata-io/wizard/pkg/wlog"
 
 	"github.com/go-playground/validator/v10"
@@ -41,6 +42,9 @@ import (
 
 const BackupDir = "/tmp/backup"
 
+// srcTarget is the source type of a file read from the target, e.g. the backup of a destination file
+const srcTarget = "target"
+
 // A Hash is a directory hash function.
 // It accepts a list of files along with a function that opens the content of each file.
 // It opens, reads, hashes, and closes each file and returns the overall directory hash.
@@ -50,6 +54,8 @@ type copyAction struct {
 	agentName string
 	timeout   int
 	register  string
+	opts      Options
+	journal   journal
 }
 
 type copyVars struct {
@@ -64,11 +70,12 @@ type copyVars struct {
 	Backup      bool   `json:"backup"`
 	Parents     bool   `json:"parents"`
 	Recursive   bool   `json:"recursive"`
+	Sensitive   bool   `json:"sensitive"`
 	IsDestDir   bool
 }
 
-func NewCopyAction(agentName string, timeout int, localRegister string) Action {
-	return &copyAction{agentName: agentName, timeout: timeout, register: localRegister}
+func NewCopyAction(agentName string, timeout int, localRegister string, opts Options) Action {
+	return &copyAction{agentName: agentName, timeout: timeout, register: localRegister, opts: opts, journal: newJournal(agentName, opts)}
 }
 
 func newCopyVars(data map[string]interface{}) (*copyVars, error) {
@@ -107,25 +114,26 @@ func newCopyVars(data map[string]interface{}) (*copyVars, error) {
 }
 
 func (c *copyAction) BackupConfigFile(filePath, srcType string) (string, error) {
-	err := os.MkdirAll(BackupDir+"/"+c.agentName, 0o755)
+	err := c.opts.target().MkdirAll(BackupDir+"/"+c.agentName, 0o755)
 	if err != nil {
 		return "", fmt.Errorf("BackupConfigFile: unable to create backup dir - %s", err)
 	}
 	_, fileName := filepath.Split(filePath)
-	err = CopyFile(filePath, BackupDir+"/"+c.agentName+"/"+fileName, "0644", srcType)
+	err = copyFile(c.opts.target(), filePath, BackupDir+"/"+c.agentName+"/"+fileName, "0644", srcType)
 	if err != nil {
 		return "", fmt.Errorf("BackupConfigFile: %s", err)
 	}
 	return BackupDir + "/" + c.agentName + "/" + fileName, nil
 }
 
-func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) error {
-	cRegister := register.RMap[c.register]
+func (c *copyAction) Do(ctx context.Context, actions *parser.Action, wizardLog chan interface{}) error {
+	cRegister := c.opts.Registers.Get(c.register)
+	target := c.opts.target()
 
 	wizardLog <- wlog.WLInfo("running when condition")
 	if actions.When != nil {
-		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, c.timeout)
-		successfulExec, err := when.Execute()
+		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, c.timeout, c.opts.Registers).WithTransport(c.opts.Transport)
+		successfulExec, err := when.Execute(ctx)
 		if err != nil {
 			if actions.When.RVar != "" {
 				wizardLog <- wlog.WLError("register field validation error: " + err.Error())
@@ -153,6 +161,10 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 	masterDest := copyConfig.Destination
 
 	for _, src := range copyConfig.SourceFiles {
+		if err := ctx.Err(); err != nil {
+			wizardLog <- wlog.WLError("copy interrupted before: " + src)
+			return fmt.Errorf("copy interrupted before %s: %w", src, err)
+		}
 		copyConfig.Destination = masterDest
 
 		if copyConfig.SourceType == "embed" {
@@ -181,7 +193,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 			}
 		}
 
-		if stat, err := os.Stat(copyConfig.Destination); err == nil && stat.IsDir() {
+		if stat, err := target.Stat(copyConfig.Destination); err == nil && stat.IsDir() {
 			isDestDir = true
 		} else if os.IsNotExist(err) {
 			if copyConfig.Parents || isDestDir {
@@ -192,16 +204,19 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 				} else {
 					path = filepath.Dir(copyConfig.Destination)
 				}
-				err := CreateIfNotExists(path, copyConfig.Permission)
-				if err != nil {
-					if isSrcDir {
-						return fmt.Errorf("unable to create dir - %s for src - %s - %s", path, src, err)
+				if !reportCheckMode(c.opts, cRegister, wizardLog, "create dir: "+path) {
+					c.journal.recordDir(path)
+					err := createIfNotExists(target, path, copyConfig.Permission)
+					if err != nil {
+						if isSrcDir {
+							return fmt.Errorf("unable to create dir - %s for src - %s - %s", path, src, err)
+						}
+						return fmt.Errorf("unable to create parent dir - %s for src - %s - %s", path, src, err)
 					}
-					return fmt.Errorf("unable to create parent dir - %s for src - %s - %s", path, src, err)
 				}
 			} else if isSrcDir {
 				return fmt.Errorf("destination dir - %s not found: %s", copyConfig.Destination, err)
-			} else if _, err := os.Stat(filepath.Dir(copyConfig.Destination)); err != nil && os.IsNotExist(err) {
+			} else if _, err := target.Stat(filepath.Dir(copyConfig.Destination)); err != nil && os.IsNotExist(err) {
 				return fmt.Errorf("destination parent dir - %s not found: %s", filepath.Dir(copyConfig.Destination), err)
 			}
 		} else if err != nil {
@@ -217,11 +232,18 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 			}
 
 			// TODO -Ignoring any error for now - But should only ignore file not found error
-			destDirHash, _ := hashDir(copyConfig.Destination, "", hash1, copyConfig.SourceType)
+			destDirHash, _ := hashTargetDir(target, copyConfig.Destination, hash1)
 
 			if destDirHash != srcDirHash {
+				reportDirDiff(c.opts, cRegister, wizardLog, src, copyConfig.SourceType, copyConfig.Destination, copyConfig.Sensitive)
+				if reportCheckMode(c.opts, cRegister, wizardLog, "copy dir to dir: "+src+" to "+copyConfig.Destination) {
+					continue
+				}
 				wizardLog <- wlog.WLInfo("hash not matched, copying dir to dir: " + src + " to" + copyConfig.Destination)
-				err := CopyDirectory(src, copyConfig.Destination, copyConfig.Permission, copyConfig.Owner, copyConfig.Group, copyConfig.SourceType)
+				if err := c.journal.recordDirCopy(src, copyConfig.SourceType, copyConfig.Destination); err != nil {
+					return err
+				}
+				err := copyDirectory(ctx, target, src, copyConfig.Destination, copyConfig.Permission, copyConfig.Owner, copyConfig.Group, copyConfig.SourceType)
 				if err != nil {
 					return err
 				}
@@ -240,22 +262,31 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 		if !isSrcDir && isDestDir {
 			// Copy file into a directory with same name
 			wizardLog <- wlog.WLInfo("Identified copy file to dir: " + src + " to" + copyConfig.Destination)
-			backUp, err := c.BackupConfigFile(src, copyConfig.SourceType)
-			if err != nil {
-				return err
+			if !c.opts.CheckMode {
+				backUp, err := c.BackupConfigFile(src, copyConfig.SourceType)
+				if err != nil {
+					return err
+				}
+				actions.BackupSrc = backUp
 			}
-			actions.BackupSrc = backUp
 			_, fileName := filepath.Split(src)
 			copyConfig.Destination = copyConfig.Destination + "/" + fileName
-			if _, err := os.Stat(copyConfig.Destination); os.IsNotExist(err) {
+			if _, err := target.Stat(copyConfig.Destination); os.IsNotExist(err) {
+				reportDiff(c.opts, cRegister, wizardLog, src, copyConfig.SourceType, copyConfig.Destination, copyConfig.Sensitive)
+				if reportCheckMode(c.opts, cRegister, wizardLog, "copy file to dir: "+src+" to "+copyConfig.Destination) {
+					continue
+				}
 				wizardLog <- wlog.WLInfo("file not found at destination, copying file to dir: " + src + " to" + copyConfig.Destination)
 				// Normal Copy, no hash to be checked and update the changed status
 				// Directory exists but file not exist
-				if err := CopyFile(src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
+				if err := c.journal.recordPath(copyConfig.Destination); err != nil {
+					return err
+				}
+				if err := copyFile(target, src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
 					return err
 				}
 				// Change the group and owner of the file
-				fileUser, err := user.Lookup(copyConfig.Owner)
+				fileUser, err := target.LookupUser(copyConfig.Owner)
 				if err != nil {
 					return err
 				}
@@ -271,7 +302,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 						return err
 					}
 				} else {
-					fileGroup, err := user.LookupGroup(copyConfig.Group)
+					fileGroup, err := target.LookupGroup(copyConfig.Group)
 					if err != nil {
 						return err
 					}
@@ -281,7 +312,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 						return err
 					}
 				}
-				err = os.Chown(copyConfig.Destination, uid, gid)
+				err = target.Chown(copyConfig.Destination, uid, gid)
 				if err != nil {
 					return fmt.Errorf("unable to change owner to file - %s, with uid - %d, gid - %d, - %s", copyConfig.Destination, uid, gid, err)
 				}
@@ -289,15 +320,21 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 			} else if err == nil {
 				// Check overwrite func and the hash and update in condition the changed status
 				wizardLog <- wlog.WLInfo("file found at destination, checking hash")
-				if GetHashOfFile(src) == GetHashOfFile(copyConfig.Destination) {
+				if GetHashOfFile(src) == targetFileHash(target, copyConfig.Destination) {
 					// No need to change the file
 					if copyConfig.Force {
+						if reportCheckMode(c.opts, cRegister, wizardLog, "copy file to dir, force is true: "+src+" to "+copyConfig.Destination) {
+							continue
+						}
 						wizardLog <- wlog.WLInfo("hash match, but force is true, copying file to dir: " + src + " to" + copyConfig.Destination)
-						if err = CopyFile(src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
+						if err := c.journal.recordPath(copyConfig.Destination); err != nil {
+							return err
+						}
+						if err = copyFile(target, src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
 							return err
 						}
 						// Change the group and owner of the file
-						fileUser, err := user.Lookup(copyConfig.Owner)
+						fileUser, err := target.LookupUser(copyConfig.Owner)
 						if err != nil {
 							return err
 						}
@@ -313,7 +350,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 								return err
 							}
 						} else {
-							fileGroup, err := user.LookupGroup(copyConfig.Group)
+							fileGroup, err := target.LookupGroup(copyConfig.Group)
 							if err != nil {
 								return err
 							}
@@ -323,19 +360,26 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 								return err
 							}
 						}
-						err = os.Chown(copyConfig.Destination, uid, gid)
+						err = target.Chown(copyConfig.Destination, uid, gid)
 						if err != nil {
 							return fmt.Errorf("unable to change owner to file - %s, with uid - %d, gid - %d, - %s", copyConfig.Destination, uid, gid, err)
 						}
 						cRegister.Changed = true
 					}
 				} else {
+					reportDiff(c.opts, cRegister, wizardLog, src, copyConfig.SourceType, copyConfig.Destination, copyConfig.Sensitive)
+					if reportCheckMode(c.opts, cRegister, wizardLog, "copy file to dir, hash not matched: "+src+" to "+copyConfig.Destination) {
+						continue
+					}
 					wizardLog <- wlog.WLInfo("hash not match, copying file to dir: " + src + " to" + copyConfig.Destination)
-					if err = CopyFile(src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
+					if err := c.journal.recordPath(copyConfig.Destination); err != nil {
+						return err
+					}
+					if err = copyFile(target, src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
 						return err
 					}
 					// Change the group and owner of the file
-					fileUser, err := user.Lookup(copyConfig.Owner)
+					fileUser, err := target.LookupUser(copyConfig.Owner)
 					if err != nil {
 						return err
 					}
@@ -351,7 +395,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 							return err
 						}
 					} else {
-						fileGroup, err := user.LookupGroup(copyConfig.Group)
+						fileGroup, err := target.LookupGroup(copyConfig.Group)
 						if err != nil {
 							return err
 						}
@@ -361,7 +405,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 							return err
 						}
 					}
-					err = os.Chown(copyConfig.Destination, uid, gid)
+					err = target.Chown(copyConfig.Destination, uid, gid)
 					if err != nil {
 						return fmt.Errorf("unable to change owner to file - %s, with uid - %d, gid - %d, - %s", copyConfig.Destination, uid, gid, err)
 					}
@@ -373,15 +417,22 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 		if !isSrcDir && !isDestDir {
 			// FILE TO FILE and glob also
 			wizardLog <- wlog.WLInfo("Identified, copy file to file: " + src + " to" + copyConfig.Destination)
-			if _, err := os.Stat(copyConfig.Destination); os.IsNotExist(err) {
+			if _, err := target.Stat(copyConfig.Destination); os.IsNotExist(err) {
 				// Directory exists but file not exist
+				reportDiff(c.opts, cRegister, wizardLog, src, copyConfig.SourceType, copyConfig.Destination, copyConfig.Sensitive)
+				if reportCheckMode(c.opts, cRegister, wizardLog, "copy file to file: "+src+" to "+copyConfig.Destination) {
+					continue
+				}
 				wizardLog <- wlog.WLInfo("file not found at destination, copying file to file: " + src + " to" + copyConfig.Destination)
 				actions.BackupSrc = src
-				if err := CopyFile(src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
+				if err := c.journal.recordPath(copyConfig.Destination); err != nil {
+					return err
+				}
+				if err := copyFile(target, src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
 					return err
 				}
 				// Change the group and owner of the file
-				fileUser, err := user.Lookup(copyConfig.Owner)
+				fileUser, err := target.LookupUser(copyConfig.Owner)
 				if err != nil {
 					return err
 				}
@@ -397,7 +448,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 						return err
 					}
 				} else {
-					fileGroup, err := user.LookupGroup(copyConfig.Group)
+					fileGroup, err := target.LookupGroup(copyConfig.Group)
 					if err != nil {
 						return err
 					}
@@ -407,7 +458,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 						return err
 					}
 				}
-				err = os.Chown(copyConfig.Destination, uid, gid)
+				err = target.Chown(copyConfig.Destination, uid, gid)
 				if err != nil {
 					return fmt.Errorf("unable to change owner to file - %s, with uid - %d, gid - %d, - %s", copyConfig.Destination, uid, gid, err)
 				}
@@ -415,20 +466,28 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 			} else if err == nil {
 				// Check overwrite func and the hash and update in condition the changed status
 				wizardLog <- wlog.WLInfo("file found at destination, checking hash")
-				backup, err := c.BackupConfigFile(copyConfig.Destination, "local")
-				if err != nil {
-					return err
+				if !c.opts.CheckMode {
+					backup, err := c.BackupConfigFile(copyConfig.Destination, srcTarget)
+					if err != nil {
+						return err
+					}
+					actions.BackupSrc = backup
 				}
-				actions.BackupSrc = backup
-				if GetHashOfFile(src) == GetHashOfFile(copyConfig.Destination) {
+				if GetHashOfFile(src) == targetFileHash(target, copyConfig.Destination) {
 					// No need to change the file
 					if copyConfig.Force {
+						if reportCheckMode(c.opts, cRegister, wizardLog, "copy file to file, force is true: "+src+" to "+copyConfig.Destination) {
+							continue
+						}
 						wizardLog <- wlog.WLInfo("hash matched, but force is true, copying file to file: " + src + " to" + copyConfig.Destination)
-						if err = CopyFile(src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
+						if err := c.journal.recordPath(copyConfig.Destination); err != nil {
+							return err
+						}
+						if err := copyFile(target, src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
 							return err
 						}
 						// Change the group and owner of the file
-						fileUser, err := user.Lookup(copyConfig.Owner)
+						fileUser, err := target.LookupUser(copyConfig.Owner)
 						if err != nil {
 							return err
 						}
@@ -444,7 +503,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 								return err
 							}
 						} else {
-							fileGroup, err := user.LookupGroup(copyConfig.Group)
+							fileGroup, err := target.LookupGroup(copyConfig.Group)
 							if err != nil {
 								return err
 							}
@@ -454,24 +513,31 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 								return err
 							}
 						}
-						err = os.Chown(copyConfig.Destination, uid, gid)
+						err = target.Chown(copyConfig.Destination, uid, gid)
 						if err != nil {
 							return fmt.Errorf("unable to change owner to file - %s, with uid - %d, gid - %d, - %s", copyConfig.Destination, uid, gid, err)
 						}
 						cRegister.Changed = true
 					}
 				} else {
+					reportDiff(c.opts, cRegister, wizardLog, src, copyConfig.SourceType, copyConfig.Destination, copyConfig.Sensitive)
+					if reportCheckMode(c.opts, cRegister, wizardLog, "copy file to file, hash not matched: "+src+" to "+copyConfig.Destination) {
+						continue
+					}
 					wizardLog <- wlog.WLInfo("hash not matched, copying file to file: " + src + " to" + copyConfig.Destination)
-					backup, err := c.BackupConfigFile(copyConfig.Destination, "local")
+					backup, err := c.BackupConfigFile(copyConfig.Destination, srcTarget)
 					if err != nil {
 						return err
 					}
 					actions.BackupSrc = backup
-					if err = CopyFile(src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
+					if err := c.journal.recordPath(copyConfig.Destination); err != nil {
+						return err
+					}
+					if err = copyFile(target, src, copyConfig.Destination, copyConfig.Permission, copyConfig.SourceType); err != nil {
 						return err
 					}
 					// Change the group and owner of the file
-					fileUser, err := user.Lookup(copyConfig.Owner)
+					fileUser, err := target.LookupUser(copyConfig.Owner)
 					if err != nil {
 						return err
 					}
@@ -487,7 +553,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 							return err
 						}
 					} else {
-						fileGroup, err := user.LookupGroup(copyConfig.Group)
+						fileGroup, err := target.LookupGroup(copyConfig.Group)
 						if err != nil {
 							return err
 						}
@@ -497,7 +563,7 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 							return err
 						}
 					}
-					err = os.Chown(copyConfig.Destination, uid, gid)
+					err = target.Chown(copyConfig.Destination, uid, gid)
 					if err != nil {
 						return fmt.Errorf("unable to change owner to file - %s, with uid - %d, gid - %d, - %s", copyConfig.Destination, uid, gid, err)
 					}
@@ -510,6 +576,11 @@ func (c *copyAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 	return nil
 }
 
+// Revert restores the files overwritten by the last Do from their backups and removes the files and dirs it created
+func (c *copyAction) Revert(ctx context.Context, wizardLog chan interface{}) error {
+	return c.journal.revert(ctx, wizardLog)
+}
+
 func Restore(src, dest, perm, srcType string) error {
 	err := CopyFile(src, dest, perm, srcType)
 	if err != nil {
@@ -519,6 +590,11 @@ func Restore(src, dest, perm, srcType string) error {
 }
 
 func CopyFile(src, dest, perm, srcType string) error {
+	return copyFile(transport.Local, src, dest, perm, srcType)
+}
+
+// copyFile copies the src file to the dest file of the target, a srcTarget src is read from the target too
+func copyFile(target transport.Transport, src, dest, perm, srcType string) error {
 	var input []byte
 	var err error
 
@@ -526,6 +602,8 @@ func CopyFile(src, dest, perm, srcType string) error {
 		input, err = fs.ReadFile(PackageFiles, src)
 	} else if srcType == "local" {
 		input, err = os.ReadFile(src)
+	} else if srcType == srcTarget {
+		input, err = target.ReadFile(src)
 	} else {
 		return fmt.Errorf("CopyFile: wrong source type")
 	}
@@ -536,7 +614,7 @@ func CopyFile(src, dest, perm, srcType string) error {
 	if err != nil {
 		return fmt.Errorf("CopyFile: unable to parse permission: %s to int. Because: %s", perm, err.Error())
 	}
-	err = os.WriteFile(dest, input, os.FileMode(permission))
+	err = target.WriteFile(dest, input, os.FileMode(permission))
 	if err != nil {
 		return fmt.Errorf("CopyFile: unable to write file to - %s from %s - %s", dest, srcType, err)
 	}
@@ -559,7 +637,26 @@ func GetHashOfFile(filePath string) string {
 	return string(hash.Sum(nil))
 }
 
-func CopyDirectory(srcDir, dest string, perm string, owner string, group string, srcType string) error {
+// targetFileHash is GetHashOfFile for a file of the target
+func targetFileHash(target transport.Transport, filePath string) string {
+	if target == transport.Local {
+		return GetHashOfFile(filePath)
+	}
+	content, err := target.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(content)
+	return string(hash[:])
+}
+
+// CopyDirectory copies the srcDir into dest, the copy stops with the ctx error once the ctx is cancelled
+func CopyDirectory(ctx context.Context, srcDir, dest string, perm string, owner string, group string, srcType string) error {
+	return copyDirectory(ctx, transport.Local, srcDir, dest, perm, owner, group, srcType)
+}
+
+// copyDirectory copies the srcDir into the dest dir of the target
+func copyDirectory(ctx context.Context, target transport.Transport, srcDir, dest string, perm string, owner string, group string, srcType string) error {
 	var gid, uid int
 
 	if srcType == "embed" {
@@ -569,6 +666,9 @@ func CopyDirectory(srcDir, dest string, perm string, owner string, group string,
 		}
 
 		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("CopyDirectory: interrupted while copying %s - %w", srcDir, err)
+			}
 			sourcePath := filepath.Join(srcDir, entry.Name())
 			destPath := filepath.Join(dest, entry.Name())
 
@@ -579,29 +679,29 @@ func CopyDirectory(srcDir, dest string, perm string, owner string, group string,
 
 			switch fileInfo.Mode() & os.ModeType {
 			case os.ModeDir:
-				if err := CreateIfNotExists(destPath, perm); err != nil {
+				if err := createIfNotExists(target, destPath, perm); err != nil {
 					return fmt.Errorf("CopyDirectory: %s", err)
 				}
-				if err := CopyDirectory(sourcePath, destPath, perm, owner, group, srcType); err != nil {
-					return fmt.Errorf("CopyDirectory: %s", err)
+				if err := copyDirectory(ctx, target, sourcePath, destPath, perm, owner, group, srcType); err != nil {
+					return fmt.Errorf("CopyDirectory: %w", err)
 				}
 			case os.ModeSymlink:
-				if err := CopySymLink(sourcePath, destPath); err != nil {
+				if err := copySymLink(target, sourcePath, destPath); err != nil {
 					return fmt.Errorf("CopyDirectory: %s", err)
 				}
 			default:
-				if err := CopyFile(sourcePath, destPath, perm, srcType); err != nil {
+				if err := copyFile(target, sourcePath, destPath, perm, srcType); err != nil {
 					return fmt.Errorf("CopyDirectory: %s", err)
 				}
 			}
 
 			isSymlink := fileInfo.Mode()&os.ModeSymlink != 0
 			if !isSymlink {
-				if err := os.Chmod(destPath, fileInfo.Mode()); err != nil {
+				if err := target.Chmod(destPath, fileInfo.Mode()); err != nil {
 					return fmt.Errorf("CopyDirectory: Unable to give permission to file - %s - %s", destPath, err)
 				}
 			}
-			fileUser, err := user.Lookup(owner)
+			fileUser, err := target.LookupUser(owner)
 			if err != nil {
 				return fmt.Errorf("CopyDirectory: %s", err)
 			}
@@ -615,7 +715,7 @@ func CopyDirectory(srcDir, dest string, perm string, owner string, group string,
 					return err
 				}
 			} else {
-				fileGroup, err := user.LookupGroup(group)
+				fileGroup, err := target.LookupGroup(group)
 				if err != nil {
 					return fmt.Errorf("CopyDirectory: %s", err)
 				}
@@ -624,7 +724,7 @@ func CopyDirectory(srcDir, dest string, perm string, owner string, group string,
 					return err
 				}
 			}
-			err = os.Chown(destPath, uid, gid)
+			err = target.Chown(destPath, uid, gid)
 			if err != nil {
 				return fmt.Errorf("CopyDirectory: Unable to change owner to file - %s, with uid - %d, gid - %d, - %s", destPath, uid, gid, err)
 			}
@@ -636,6 +736,9 @@ func CopyDirectory(srcDir, dest string, perm string, owner string, group string,
 		}
 
 		for _, entry := range entries {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("CopyDirectory: interrupted while copying %s - %w", srcDir, err)
+			}
 			sourcePath := filepath.Join(srcDir, entry.Name())
 			destPath := filepath.Join(dest, entry.Name())
 
@@ -651,33 +754,33 @@ func CopyDirectory(srcDir, dest string, perm string, owner string, group string,
 
 			switch fileInfo.Mode() & os.ModeType {
 			case os.ModeDir:
-				if err := CreateIfNotExists(destPath, perm); err != nil {
+				if err := createIfNotExists(target, destPath, perm); err != nil {
 					return fmt.Errorf("CopyDirectory: %s", err)
 				}
-				if err := CopyDirectory(sourcePath, destPath, perm, owner, group, srcType); err != nil {
-					return fmt.Errorf("CopyDirectory: %s", err)
+				if err := copyDirectory(ctx, target, sourcePath, destPath, perm, owner, group, srcType); err != nil {
+					return fmt.Errorf("CopyDirectory: %w", err)
 				}
 			case os.ModeSymlink:
-				if err := CopySymLink(sourcePath, destPath); err != nil {
+				if err := copySymLink(target, sourcePath, destPath); err != nil {
 					return fmt.Errorf("CopyDirectory: %s", err)
 				}
 			default:
-				if err := CopyFile(sourcePath, destPath, perm, srcType); err != nil {
+				if err := copyFile(target, sourcePath, destPath, perm, srcType); err != nil {
 					return fmt.Errorf("CopyDirectory: %s", err)
 				}
 			}
 
-			if err := os.Lchown(destPath, int(stat.Uid), int(stat.Gid)); err != nil {
+			if err := target.Lchown(destPath, int(stat.Uid), int(stat.Gid)); err != nil {
 				return err
 			}
 
 			isSymlink := entry.Mode()&os.ModeSymlink != 0
 			if !isSymlink {
-				if err := os.Chmod(destPath, entry.Mode()); err != nil {
+				if err := target.Chmod(destPath, entry.Mode()); err != nil {
 					return fmt.Errorf("CopyDirectory: Unable to give permission to file - %s - %s", destPath, err)
 				}
 			}
-			fileUser, err := user.Lookup(owner)
+			fileUser, err := target.LookupUser(owner)
 			if err != nil {
 				return fmt.Errorf("CopyDirectory: %s", err)
 			}
@@ -685,13 +788,13 @@ func CopyDirectory(srcDir, dest string, perm string, owner string, group string,
 			if strings.TrimSpace(group) == "" {
 				gid, _ = strconv.Atoi(fileUser.Gid)
 			} else {
-				fileGroup, err := user.LookupGroup(group)
+				fileGroup, err := target.LookupGroup(group)
 				if err != nil {
 					return fmt.Errorf("CopyDirectory: %s", err)
 				}
 				gid, _ = strconv.Atoi(fileGroup.Gid)
 			}
-			err = os.Chown(destPath, uid, gid)
+			err = target.Chown(destPath, uid, gid)
 			if err != nil {
 				return fmt.Errorf("CopyDirectory: Unable to change owner to file - %s, with uid - %d, gid - %d, - %s", destPath, uid, gid, err)
 			}
@@ -704,7 +807,12 @@ func CopyDirectory(srcDir, dest string, perm string, owner string, group string,
 }
 
 func Exists(filePath string) bool {
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	return exists(transport.Local, filePath)
+}
+
+// exists is Exists for a path of the target
+func exists(target transport.Transport, filePath string) bool {
+	if _, err := target.Stat(filePath); os.IsNotExist(err) {
 		return false
 	}
 
@@ -712,12 +820,17 @@ func Exists(filePath string) bool {
 }
 
 func CreateIfNotExists(dir string, perm string) error {
+	return createIfNotExists(transport.Local, dir, perm)
+}
+
+// createIfNotExists is CreateIfNotExists for a dir of the target
+func createIfNotExists(target transport.Transport, dir string, perm string) error {
 	permission, _ := strconv.ParseInt(perm, 8, 32)
-	if Exists(dir) {
+	if exists(target, dir) {
 		return nil
 	}
 
-	if err := os.MkdirAll(dir, os.FileMode(permission)); err != nil {
+	if err := target.MkdirAll(dir, os.FileMode(permission)); err != nil {
 		return fmt.Errorf("CreateIfNotExists: failed to create directory: '%s', error: '%s'", dir, err.Error())
 	}
 
@@ -725,11 +838,16 @@ func CreateIfNotExists(dir string, perm string) error {
 }
 
 func CopySymLink(source, dest string) error {
+	return copySymLink(transport.Local, source, dest)
+}
+
+// copySymLink creates the dest symlink on the target with the target of the local source symlink
+func copySymLink(target transport.Transport, source, dest string) error {
 	link, err := os.Readlink(source)
 	if err != nil {
 		return fmt.Errorf("CopySymLink: %s", err)
 	}
-	return os.Symlink(link, dest)
+	return target.Symlink(link, dest)
 }
 
 func hash1(files []string, open func(string) (io.ReadCloser, error)) (string, error) {
@@ -779,6 +897,47 @@ func hashDir(dir, prefix string, hash Hash, srcType string) (string, error) {
 	return hash(files, osOpen)
 }
 
+// hashTargetDir is hashDir for a dir of the target
+func hashTargetDir(target transport.Transport, dir string, hash Hash) (string, error) {
+	if target == transport.Local {
+		return hashDir(dir, "", hash, "local")
+	}
+	files, err := targetDirFiles(target, filepath.Clean(dir), "")
+	if err != nil {
+		return "", err
+	}
+	open := func(name string) (io.ReadCloser, error) {
+		content, err := target.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	return hash(files, open)
+}
+
+// targetDirFiles is dirFiles for a dir of the target, the names are relative to dir
+func targetDirFiles(target transport.Transport, dir, rel string) ([]string, error) {
+	entries, err := target.ReadDir(filepath.Join(dir, rel))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := filepath.Join(rel, entry.Name())
+		if entry.IsDir() {
+			sub, err := targetDirFiles(target, dir, name)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, sub...)
+			continue
+		}
+		files = append(files, filepath.ToSlash(name))
+	}
+	return files, nil
+}
+
 func dirFilesEmbed(efs *embed.FS, path string) (out []string, err error) {
 	if len(path) == 0 {
 		path = "."
@@ -802,6 +961,21 @@ func dirFilesEmbed(efs *embed.FS, path string) (out []string, err error) {
 	return
 }
 
+// srcDirFiles returns the files of the src dir relative to it, from the embedded files or from the local disk
+func srcDirFiles(srcDir, srcType string) ([]string, error) {
+	if srcType != "embed" {
+		return dirFiles(srcDir, "")
+	}
+	files, err := dirFilesEmbed(&PackageFiles, srcDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		files[i], _ = filepath.Rel(srcDir, files[i])
+	}
+	return files, nil
+}
+
 // dirFiles returns the list of files in the tree rooted at dir,
 // replacing the directory name dir with prefix in each name.
 // The resulting names always use forward slashes.
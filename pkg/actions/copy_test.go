@@ -15,8 +15,10 @@
 package actions
 
 import (
+	"context"
 	"embed"
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -479,17 +481,19 @@ func TestCopyAction(t *testing.T) {
 		var got error
 		wLog := make(chan interface{})
 		if tc.input.Action == "copy" {
-			copyAction := NewCopyAction("test", 10, register.GetHash(tc.name))
-			register.RMap[register.GetHash(tc.name)] = &register.Register{}
+			registers := register.NewStore()
+			copyAction := NewCopyAction("test", 10, register.GetHash(tc.name), Options{Registers: registers})
+			registers.Set(register.GetHash(tc.name), &register.Register{})
 			go func() {
-				got = copyAction.Do(tc.input, wLog)
+				got = copyAction.Do(context.Background(), tc.input, wLog)
 				close(wLog)
 			}()
 		} else if tc.input.Action == "file" {
-			fileAction := NewFileAction("test", 10, register.GetHash(tc.name))
-			register.RMap[register.GetHash(tc.name)] = &register.Register{}
+			registers := register.NewStore()
+			fileAction := NewFileAction("test", 10, register.GetHash(tc.name), Options{Registers: registers})
+			registers.Set(register.GetHash(tc.name), &register.Register{})
 			go func() {
-				got = fileAction.Do(tc.input, wLog)
+				got = fileAction.Do(context.Background(), tc.input, wLog)
 				close(wLog)
 			}()
 		}
@@ -502,3 +506,41 @@ func TestCopyAction(t *testing.T) {
 		}
 	}
 }
+
+func TestCopyActionCheckMode(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "test.yml.tmpl")
+	registers := register.NewStore()
+	registers.Set("check_mode", &register.Register{})
+	copyAction := NewCopyAction("test", 10, "check_mode", Options{CheckMode: true, Registers: registers})
+
+	var got error
+	wLog := make(chan interface{})
+	go func() {
+		got = copyAction.Do(context.Background(), &parser.Action{
+			Action: "copy",
+			Name:   "copy file in check mode",
+			ActionVariables: map[string]interface{}{
+				"src_type":   "local",
+				"src":        "testdata/test.yml.tmpl",
+				"dest":       dest,
+				"permission": "0644",
+				"owner":      "root",
+				"group":      "root",
+			},
+		}, wLog)
+		close(wLog)
+	}()
+
+	// This is here to wait for the channel
+	for range wLog {
+	}
+	if got != nil {
+		t.Fatal(got)
+	}
+	if Exists(dest) {
+		t.Fatalf("%s should not be created in check mode", dest)
+	}
+	if !registers.Get("check_mode").Changed {
+		t.Fatal("register should report the change in check mode")
+	}
+}
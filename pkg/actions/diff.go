@@ -0,0 +1,141 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
+	"github.com/acceldata-io/wizard/pkg/wlog"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// binarySniffLen is the number of bytes checked for a NUL byte to detect binary content
+const binarySniffLen = 8000
+
+// FileDiff returns the unified diff between the content of the dest file and the new content
+// A missing dest is diffed against /dev/null, binary content is summarized with its size and hash,
+// and the diff of a sensitive file is suppressed. An empty string is returned if the contents are the same
+func FileDiff(dest string, newContent []byte, sensitive bool) (string, error) {
+	return fileDiff(transport.Local, dest, newContent, sensitive)
+}
+
+// fileDiff is FileDiff for a dest file of the target
+func fileDiff(target transport.Transport, dest string, newContent []byte, sensitive bool) (string, error) {
+	fromFile := dest
+	oldContent, err := target.ReadFile(dest)
+	if os.IsNotExist(err) {
+		fromFile = "/dev/null"
+	} else if err != nil {
+		return "", fmt.Errorf("FileDiff: unable to read file - %s - %s", dest, err)
+	}
+
+	if bytes.Equal(oldContent, newContent) {
+		return "", nil
+	}
+	if sensitive {
+		return fmt.Sprintf("sensitive file %s changed, diff suppressed\n", dest), nil
+	}
+	if isBinary(oldContent) || isBinary(newContent) {
+		return fmt.Sprintf("binary file %s changed: %d bytes (sha256 %x) -> %d bytes (sha256 %x)\n",
+			dest, len(oldContent), sha256.Sum256(oldContent), len(newContent), sha256.Sum256(newContent)), nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(oldContent),
+		B:        splitLines(newContent),
+		FromFile: fromFile,
+		ToFile:   dest,
+		Context:  3,
+	})
+}
+
+// splitLines splits the content after each new line, a missing new line at the end is added
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+func isBinary(content []byte) bool {
+	if len(content) > binarySniffLen {
+		content = content[:binarySniffLen]
+	}
+	return bytes.IndexByte(content, 0) >= 0 || !utf8.Valid(content)
+}
+
+// readSourceFile reads a file from the embedded files or from the local disk
+func readSourceFile(src, srcType string) ([]byte, error) {
+	switch srcType {
+	case "embed":
+		return fs.ReadFile(PackageFiles, src)
+	case "local":
+		return os.ReadFile(src)
+	}
+	return nil, fmt.Errorf("readSourceFile: wrong source type")
+}
+
+// reportDiff logs the diff between the dest file and the src file, and appends it to the register
+// Does nothing unless the diff option is enabled, a diff which can not be computed is logged as a warning
+func reportDiff(opts Options, aRegister *register.Register, wizardLog chan interface{}, src, srcType, dest string, sensitive bool) {
+	if !opts.Diff {
+		return
+	}
+	content, err := readSourceFile(src, srcType)
+	if err != nil {
+		wizardLog <- wlog.WLWarn(fmt.Sprintf("unable to diff %s: %s", dest, err))
+		return
+	}
+	diff, err := fileDiff(opts.target(), dest, content, sensitive)
+	if err != nil {
+		wizardLog <- wlog.WLWarn(fmt.Sprintf("unable to diff %s: %s", dest, err))
+		return
+	}
+	if diff == "" {
+		return
+	}
+	wizardLog <- wlog.WLInfo("diff:\n" + diff)
+	aRegister.Diff += diff
+}
+
+// reportDirDiff reports the diff of every file of the src dir against the same file in the dest dir
+func reportDirDiff(opts Options, aRegister *register.Register, wizardLog chan interface{}, srcDir, srcType, destDir string, sensitive bool) {
+	if !opts.Diff {
+		return
+	}
+	files, err := srcDirFiles(srcDir, srcType)
+	if err != nil {
+		wizardLog <- wlog.WLWarn(fmt.Sprintf("unable to diff %s: %s", destDir, err))
+		return
+	}
+	for _, file := range files {
+		reportDiff(opts, aRegister, wizardLog, filepath.Join(srcDir, file), srcType, filepath.Join(destDir, file), sensitive)
+	}
+}
@@ -0,0 +1,128 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+)
+
+func TestFileDiff(t *testing.T) {
+	dir := t.TempDir()
+	textFile := filepath.Join(dir, "agent.conf")
+	if err := os.WriteFile(textFile, []byte("port=80\nhost=a\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	binFile := filepath.Join(dir, "agent.bin")
+	if err := os.WriteFile(binFile, []byte{0, 1, 2}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		dest      string
+		content   []byte
+		sensitive bool
+		want      string
+	}{
+		{
+			name:    "same content",
+			dest:    textFile,
+			content: []byte("port=80\nhost=a\n"),
+			want:    "",
+		},
+		{
+			name:    "text file changed",
+			dest:    textFile,
+			content: []byte("port=8080\nhost=a\n"),
+			want:    "--- " + textFile + "\n+++ " + textFile + "\n@@ -1,2 +1,2 @@\n-port=80\n+port=8080\n host=a\n",
+		},
+		{
+			name:    "new file",
+			dest:    filepath.Join(dir, "new.conf"),
+			content: []byte("port=80\n"),
+			want:    "--- /dev/null\n+++ " + filepath.Join(dir, "new.conf") + "\n@@ -0,0 +1 @@\n+port=80\n",
+		},
+		{
+			name:      "sensitive file",
+			dest:      textFile,
+			content:   []byte("password=secret\n"),
+			sensitive: true,
+			want:      "sensitive file " + textFile + " changed, diff suppressed\n",
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := FileDiff(tc.dest, tc.content, tc.sensitive)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: expected: %q, got: %q", tc.name, tc.want, got)
+		}
+	}
+
+	got, err := FileDiff(binFile, []byte{0, 1, 2, 3}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "binary file "+binFile+" changed: 3 bytes") {
+		t.Fatalf("binary file should be summarized, got: %q", got)
+	}
+}
+
+func TestCopyActionDiff(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "test.yml.tmpl")
+	if err := os.WriteFile(dest, []byte("old content\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	registers := register.NewStore()
+	registers.Set("diff", &register.Register{})
+	copyAction := NewCopyAction("test", 10, "diff", Options{CheckMode: true, Diff: true, Registers: registers})
+
+	var got error
+	wLog := make(chan interface{})
+	go func() {
+		got = copyAction.Do(context.Background(), &parser.Action{
+			Action: "copy",
+			Name:   "copy file with diff",
+			ActionVariables: map[string]interface{}{
+				"src_type":   "local",
+				"src":        "testdata/test.yml.tmpl",
+				"dest":       dest,
+				"permission": "0644",
+				"owner":      "root",
+				"group":      "root",
+			},
+		}, wLog)
+		close(wLog)
+	}()
+
+	// This is here to wait for the channel
+	for range wLog {
+	}
+	if got != nil {
+		t.Fatal(got)
+	}
+	if diff := registers.Get("diff").Diff; !strings.Contains(diff, "-old content\n") || !strings.HasPrefix(diff, "--- "+dest) {
+		t.Fatalf("unexpected diff in register: %q", diff)
+	}
+}
@@ -15,14 +15,14 @@
 package actions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/user"
 	"strconv"
 
 	"github.com/acceldata-io/wizard/internal/parser"
-	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
 	"github.com/acceldata-io/wizard/pkg/wlog"
 
 	"github.com/go-playground/validator/v10"
@@ -32,10 +32,12 @@ type fileAction struct {
 	agentName string
 	timeout   int
 	register  string
+	opts      Options
+	journal   journal
 }
 
-func NewFileAction(agentName string, timeout int, register string) Action {
-	return &fileAction{agentName: agentName, timeout: timeout, register: register}
+func NewFileAction(agentName string, timeout int, register string, opts Options) Action {
+	return &fileAction{agentName: agentName, timeout: timeout, register: register, opts: opts, journal: newJournal(agentName, opts)}
 }
 
 type fileVar struct {
@@ -46,6 +48,10 @@ type fileVar struct {
 	Owner      string     `json:"owner" validate:"required"`
 	Group      string     `json:"group" validate:"required"`
 	Enforce    bool       `json:"force"`
+	// journal records how to undo the changes in transactional mode, nil records nothing
+	journal *journal
+	// target is the machine of the files, the local machine when nil
+	target transport.Transport
 }
 
 type fileInfo struct {
@@ -73,14 +79,14 @@ func NewFileVar(data map[string]interface{}) (*fileVar, error) {
 	return &t, nil
 }
 
-func (f *fileAction) Do(actions *parser.Action, wizardLog chan interface{}) error {
+func (f *fileAction) Do(ctx context.Context, actions *parser.Action, wizardLog chan interface{}) error {
 	// Create/Deleting a file and directory
-	fRegister := register.RMap[f.register]
+	fRegister := f.opts.Registers.Get(f.register)
 
 	wizardLog <- wlog.WLInfo("executing when condition")
 	if actions.When != nil {
-		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, f.timeout)
-		successfulExec, err := when.Execute()
+		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, f.timeout, f.opts.Registers).WithTransport(f.opts.Transport)
+		successfulExec, err := when.Execute(ctx)
 		if err != nil {
 			if actions.When.RVar != "" {
 				wizardLog <- wlog.WLError("register field validation error: " + err.Error())
@@ -98,6 +104,19 @@ func (f *fileAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 		wizardLog <- wlog.WLError("validation error: " + err.Error())
 		return err
 	}
+	touchVar.journal = &f.journal
+	touchVar.target = f.opts.Transport
+	if f.opts.CheckMode {
+		changes, err := touchVar.plannedChanges()
+		if err != nil {
+			wizardLog <- wlog.WLError(err.Error())
+			return err
+		}
+		for _, change := range changes {
+			reportCheckMode(f.opts, fRegister, wizardLog, change)
+		}
+		return nil
+	}
 	switch touchVar.State {
 	case "touch":
 		if touchVar.Dir {
@@ -147,14 +166,18 @@ func (f *fileAction) Do(actions *parser.Action, wizardLog chan interface{}) erro
 }
 
 func (t *fileVar) CreateSymlink() error {
+	target := targetOf(t.target)
 	for _, file := range t.Files {
-		if _, err := os.Stat(file.Source); os.IsNotExist(err) {
+		if _, err := target.Stat(file.Source); os.IsNotExist(err) {
 			return fmt.Errorf("CreateSymlink: source file does not exists - %s", err.Error())
 		} else if err != nil {
 			return fmt.Errorf("CreateSymLink: source file not accessible - %s", err.Error())
 		}
 
-		err := os.Symlink(file.Source, file.Destination)
+		if err := t.journal.recordPath(file.Destination); err != nil {
+			return fmt.Errorf("CreateSymlink: %s", err)
+		}
+		err := target.Symlink(file.Source, file.Destination)
 		if err != nil {
 			if os.IsExist(err) {
 				// removing old symlink and creating new
@@ -164,13 +187,14 @@ func (t *fileVar) CreateSymlink() error {
 							Destination: file.Destination,
 						},
 					},
+					target: t.target,
 				}
 				err = rf.RemoveFile()
 				if err != nil {
 					return fmt.Errorf("CreateSymlink: unable to remove old symlink %s", err)
 				}
 
-				err = os.Symlink(file.Source, file.Destination)
+				err = target.Symlink(file.Source, file.Destination)
 				if err != nil {
 					return fmt.Errorf("CreateSymlink: unable to create symlink - %s", err)
 				}
@@ -184,26 +208,26 @@ func (t *fileVar) CreateSymlink() error {
 }
 
 func (t *fileVar) TouchFile() error {
+	target := targetOf(t.target)
 	// touch file
 	for _, file := range t.Files {
-		if _, err := os.Stat(file.Destination); os.IsNotExist(err) {
-			f, err := os.Create(file.Destination)
-			if err != nil {
-				return fmt.Errorf("TouchFile: Unable to create file at dest - %s - %s", file.Destination, err)
+		if _, err := target.Stat(file.Destination); os.IsNotExist(err) {
+			if err := t.journal.recordPath(file.Destination); err != nil {
+				return fmt.Errorf("TouchFile: %s", err)
 			}
-			err = f.Close()
+			err := target.WriteFile(file.Destination, nil, 0o666)
 			if err != nil {
-				return fmt.Errorf("TouchFile: Unable to close file - %s", err)
+				return fmt.Errorf("TouchFile: Unable to create file at dest - %s - %s", file.Destination, err)
 			}
 			permission, err := strconv.ParseInt(t.Permission, 8, 32)
 			if err != nil {
 				return fmt.Errorf("TouchFile: unable to parse permission: %s to int. Because: %s", t.Permission, err.Error())
 			}
-			err = os.Chmod(file.Destination, os.FileMode(permission))
+			err = target.Chmod(file.Destination, os.FileMode(permission))
 			if err != nil {
 				return fmt.Errorf("TouchFile: Unable to give permission to file - %s - %s", file.Destination, err)
 			}
-			fileUser, err := user.Lookup(t.Owner)
+			fileUser, err := target.LookupUser(t.Owner)
 			if err != nil {
 				return fmt.Errorf("TouchFile: %s", err)
 			}
@@ -215,7 +239,7 @@ func (t *fileVar) TouchFile() error {
 			if err != nil {
 				return fmt.Errorf("unable to convert the gid to int. Because: " + err.Error())
 			}
-			err = os.Chown(file.Destination, uid, gid)
+			err = target.Chown(file.Destination, uid, gid)
 			if err != nil {
 				return fmt.Errorf("TouchFile: Unable to change owner to file - %s, with uid - %d, gid - %d, - %s", file.Destination, uid, gid, err)
 			}
@@ -223,15 +247,18 @@ func (t *fileVar) TouchFile() error {
 			return fmt.Errorf("TouchFile: %s", err)
 		} else {
 			if t.Enforce {
+				if err := t.journal.recordAttributes(file.Destination); err != nil {
+					return fmt.Errorf("TouchFile: %s", err)
+				}
 				permission, err := strconv.ParseInt(t.Permission, 8, 32)
 				if err != nil {
 					return fmt.Errorf("TouchFile: unable to parse permission: %s to int. Because: %s", t.Permission, err.Error())
 				}
-				err = os.Chmod(file.Destination, os.FileMode(permission))
+				err = target.Chmod(file.Destination, os.FileMode(permission))
 				if err != nil {
 					return fmt.Errorf("TouchFile: Unable to give permission to file - %s - %s", file.Destination, err)
 				}
-				fileUser, err := user.Lookup(t.Owner)
+				fileUser, err := target.LookupUser(t.Owner)
 				if err != nil {
 					return fmt.Errorf("TouchFile: %s", err)
 				}
@@ -243,7 +270,7 @@ func (t *fileVar) TouchFile() error {
 				if err != nil {
 					return fmt.Errorf("TouchFile: unable to convert the gid to int. Because: " + err.Error())
 				}
-				err = os.Chown(file.Destination, uid, gid)
+				err = target.Chown(file.Destination, uid, gid)
 				if err != nil {
 					return fmt.Errorf("TouchFile: Unable to change owner to file - %s, with uid - %d, gid - %d, - %s", file.Destination, uid, gid, err)
 				}
@@ -255,10 +282,14 @@ func (t *fileVar) TouchFile() error {
 }
 
 func (t *fileVar) RemoveFile() error {
+	target := targetOf(t.target)
 	// remove file
 	for _, file := range t.Files {
-		if _, err := os.Stat(file.Destination); err == nil {
-			if err := os.RemoveAll(file.Destination); err != nil {
+		if _, err := target.Stat(file.Destination); err == nil {
+			if err := t.journal.recordPath(file.Destination); err != nil {
+				return fmt.Errorf("RemoveFile: %s", err)
+			}
+			if err := target.RemoveAll(file.Destination); err != nil {
 				return fmt.Errorf("RemoveFile: Unable to remove file - %s", err)
 			}
 		}
@@ -268,13 +299,21 @@ func (t *fileVar) RemoveFile() error {
 }
 
 func (t *fileVar) TouchDir() error {
+	target := targetOf(t.target)
 	permission, err := strconv.ParseInt(t.Permission, 8, 32)
 	if err != nil {
 		return fmt.Errorf("TouchDir: unable to parse permission: %s to int. Because: %s", t.Permission, err.Error())
 	}
 
 	for _, dir := range t.Files {
-		err := os.MkdirAll(dir.Destination, os.FileMode(permission))
+		if exists(target, dir.Destination) {
+			if err := t.journal.recordAttributes(dir.Destination); err != nil {
+				return fmt.Errorf("TouchDir: %s", err)
+			}
+		} else {
+			t.journal.recordDir(dir.Destination)
+		}
+		err := target.MkdirAll(dir.Destination, os.FileMode(permission))
 		if err != nil {
 			return err
 		}
@@ -282,11 +321,11 @@ func (t *fileVar) TouchDir() error {
 		if err != nil {
 			return fmt.Errorf("TouchDir: unable to parse permission: %s to int. Because: %s", t.Permission, err.Error())
 		}
-		err = os.Chmod(dir.Destination, os.FileMode(permission))
+		err = target.Chmod(dir.Destination, os.FileMode(permission))
 		if err != nil {
 			return fmt.Errorf("TouchDir: Unable to give permission to dir - %s - %s", dir.Destination, err)
 		}
-		fileUser, err := user.Lookup(t.Owner)
+		fileUser, err := target.LookupUser(t.Owner)
 		if err != nil {
 			return fmt.Errorf("TouchDir: %s", err)
 		}
@@ -298,7 +337,7 @@ func (t *fileVar) TouchDir() error {
 		if err != nil {
 			return fmt.Errorf("TouchDir: unable to convert the gid to int. Because: " + err.Error())
 		}
-		err = os.Chown(dir.Destination, uid, gid)
+		err = target.Chown(dir.Destination, uid, gid)
 		if err != nil {
 			return fmt.Errorf("TouchDir: Unable to change owner to dir - %s, with uid - %d, gid - %d, - %s", dir.Destination, uid, gid, err)
 		}
@@ -308,9 +347,13 @@ func (t *fileVar) TouchDir() error {
 }
 
 func (t *fileVar) RemoveDir() error {
+	target := targetOf(t.target)
 	for _, dir := range t.Files {
-		if _, err := os.Stat(dir.Destination); err == nil {
-			err := os.RemoveAll(dir.Destination)
+		if _, err := target.Stat(dir.Destination); err == nil {
+			if err := t.journal.recordPath(dir.Destination); err != nil {
+				return fmt.Errorf("RemoveDir: %s", err)
+			}
+			err := target.RemoveAll(dir.Destination)
 			if err != nil {
 				return fmt.Errorf("RemoveDir: Unable to remove dir - %s", err)
 			}
@@ -319,3 +362,72 @@ func (t *fileVar) RemoveDir() error {
 
 	return nil
 }
+
+// Revert removes the files and dirs created by the last Do, restores the removed files and the changed permissions
+func (f *fileAction) Revert(ctx context.Context, wizardLog chan interface{}) error {
+	return f.journal.revert(ctx, wizardLog)
+}
+
+// plannedChanges returns the changes the action would do on the files, it is used in check mode
+func (t *fileVar) plannedChanges() ([]string, error) {
+	target := targetOf(t.target)
+	var changes []string
+	kind := "file"
+	if t.Dir {
+		kind = "dir"
+	}
+
+	switch t.State {
+	case "touch":
+		permission, err := strconv.ParseInt(t.Permission, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("plannedChanges: unable to parse permission: %s to int. Because: %s", t.Permission, err.Error())
+		}
+		for _, file := range t.Files {
+			stat, err := target.Stat(file.Destination)
+			if os.IsNotExist(err) {
+				changes = append(changes, fmt.Sprintf("create %s: %s", kind, file.Destination))
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("plannedChanges: %s", err)
+			}
+			if !t.Dir && !t.Enforce {
+				continue
+			}
+			if stat.Mode().Perm() != os.FileMode(permission).Perm() || !isOwnedBy(target, stat, t.Owner) {
+				changes = append(changes, fmt.Sprintf("set permission %s and owner %s on %s: %s", t.Permission, t.Owner, kind, file.Destination))
+			}
+		}
+	case "link":
+		for _, file := range t.Files {
+			if _, err := target.Stat(file.Source); os.IsNotExist(err) {
+				return nil, fmt.Errorf("CreateSymlink: source file does not exists - %s", err.Error())
+			}
+			if link, err := target.Readlink(file.Destination); err != nil || link != file.Source {
+				changes = append(changes, fmt.Sprintf("create symlink: %s -> %s", file.Destination, file.Source))
+			}
+		}
+	case "absent":
+		for _, file := range t.Files {
+			if _, err := target.Lstat(file.Destination); err == nil {
+				changes = append(changes, fmt.Sprintf("remove %s: %s", kind, file.Destination))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown state: %s", t.State)
+	}
+	return changes, nil
+}
+
+// isOwnedBy returns true if the file is owned by the user, an unknown user is reported as not owning the file
+func isOwnedBy(target transport.Transport, stat os.FileInfo, owner string) bool {
+	fileUser, err := target.LookupUser(owner)
+	if err != nil {
+		return false
+	}
+	uid, _, ok := transport.Owner(stat)
+	if !ok {
+		return false
+	}
+	return strconv.Itoa(uid) == fileUser.Uid
+}
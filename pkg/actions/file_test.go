@@ -15,11 +15,14 @@
 package actions
 
 import (
+	"context"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/acceldata-io/wizard/internal/parser"
 	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/wlog"
 )
 
 func TestFileAction(t *testing.T) {
@@ -186,13 +189,14 @@ func TestFileAction(t *testing.T) {
 	}
 
 	for _, tc := range tests {
-		fileAction := NewFileAction("test", 10, register.GetHash(tc.name))
-		register.RMap[register.GetHash(tc.name)] = &register.Register{}
+		registers := register.NewStore()
+		fileAction := NewFileAction("test", 10, register.GetHash(tc.name), Options{Registers: registers})
+		registers.Set(register.GetHash(tc.name), &register.Register{})
 		wLog := make(chan interface{})
 		var got error
 
 		go func() {
-			got = fileAction.Do(tc.input, wLog)
+			got = fileAction.Do(context.Background(), tc.input, wLog)
 			close(wLog)
 		}()
 
@@ -204,3 +208,49 @@ func TestFileAction(t *testing.T) {
 		}
 	}
 }
+
+func TestFileActionCheckMode(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "check_mode")
+	registers := register.NewStore()
+	registers.Set("check_mode", &register.Register{})
+	fileAction := NewFileAction("test", 10, "check_mode", Options{CheckMode: true, Registers: registers})
+
+	var got error
+	var logs []interface{}
+	wLog := make(chan interface{})
+	go func() {
+		got = fileAction.Do(context.Background(), &parser.Action{
+			Action: "file",
+			Name:   "touch dir in check mode",
+			ActionVariables: map[string]interface{}{
+				"files": []interface{}{
+					map[string]interface{}{
+						"dest": dir,
+					},
+				},
+				"dir":        true,
+				"permission": "0755",
+				"owner":      "root",
+				"group":      "root",
+				"state":      "touch",
+			},
+		}, wLog)
+		close(wLog)
+	}()
+
+	for v := range wLog {
+		logs = append(logs, v)
+	}
+	if got != nil {
+		t.Fatal(got)
+	}
+	if Exists(dir) {
+		t.Fatalf("%s should not be created in check mode", dir)
+	}
+	if !registers.Get("check_mode").Changed {
+		t.Fatal("register should report the change in check mode")
+	}
+	if !reflect.DeepEqual(logs[len(logs)-1], wlog.WLInfo("check mode: would create dir: "+dir)) {
+		t.Fatalf("unexpected log: %v", logs[len(logs)-1])
+	}
+}
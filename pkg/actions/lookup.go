@@ -16,9 +16,10 @@ package actions
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
+
+	"github.com/acceldata-io/wizard/pkg/transport"
 )
 
 type unixUser struct {
@@ -38,9 +39,9 @@ type unixGroup struct {
 	groupList []string
 }
 
-func userLookup(username string) (unixUser, error) {
+func userLookup(target transport.Transport, username string) (unixUser, error) {
 	userFound := unixUser{}
-	userList, err := userInfoList("/etc/passwd")
+	userList, err := userInfoList(target, "/etc/passwd")
 	if err != nil {
 		return userFound, fmt.Errorf("userLookup: %s", err)
 	}
@@ -52,9 +53,9 @@ func userLookup(username string) (unixUser, error) {
 	return userFound, nil
 }
 
-func groupInfoLookUp(path string) ([]unixGroup, error) {
+func groupInfoLookUp(target transport.Transport, path string) ([]unixGroup, error) {
 	var groupList []unixGroup
-	content, err := os.ReadFile(path)
+	content, err := target.ReadFile(path)
 	if err != nil {
 		return groupList, fmt.Errorf("GroupInfoLookUp: unable to read file - %s - %s", path, err)
 	}
@@ -83,9 +84,9 @@ func groupInfoLookUp(path string) ([]unixGroup, error) {
 	return groupList, nil
 }
 
-func userInfoList(path string) ([]unixUser, error) {
+func userInfoList(target transport.Transport, path string) ([]unixUser, error) {
 	var userList []unixUser
-	content, err := os.ReadFile(path)
+	content, err := target.ReadFile(path)
 	if err != nil {
 		return userList, fmt.Errorf("userInfoList: unable to read file - %s - %s", path, err)
 	}
@@ -122,9 +123,9 @@ func userInfoList(path string) ([]unixUser, error) {
 	return userList, nil
 }
 
-func isUserPresent(user string) (bool, error) {
+func isUserPresent(target transport.Transport, user string) (bool, error) {
 	found := false
-	userList, err := userInfoList("/etc/passwd")
+	userList, err := userInfoList(target, "/etc/passwd")
 	if err != nil {
 		return false, fmt.Errorf("IsUserPresent: %s", err)
 	}
@@ -136,9 +137,9 @@ func isUserPresent(user string) (bool, error) {
 	return found, nil
 }
 
-func isUserIDPresent(uid int) (bool, error) {
+func isUserIDPresent(target transport.Transport, uid int) (bool, error) {
 	found := false
-	userList, err := userInfoList("/etc/passwd")
+	userList, err := userInfoList(target, "/etc/passwd")
 	if err != nil {
 		return false, fmt.Errorf("IsUserIDPresent: %s", err)
 	}
@@ -151,9 +152,9 @@ func isUserIDPresent(uid int) (bool, error) {
 	return found, nil
 }
 
-func isGroupNamePresent(group string) (bool, error) {
+func isGroupNamePresent(target transport.Transport, group string) (bool, error) {
 	found := false
-	groupList, err := groupInfoLookUp("/etc/group")
+	groupList, err := groupInfoLookUp(target, "/etc/group")
 	if err != nil {
 		return false, fmt.Errorf("IsGroupNamePresent: %s", err)
 	}
@@ -165,9 +166,9 @@ func isGroupNamePresent(group string) (bool, error) {
 	return found, nil
 }
 
-func isGroupIDPresent(gid int) (bool, error) {
+func isGroupIDPresent(target transport.Transport, gid int) (bool, error) {
 	found := false
-	groupList, err := groupInfoLookUp("/etc/group")
+	groupList, err := groupInfoLookUp(target, "/etc/group")
 	if err != nil {
 		return false, fmt.Errorf("IsGroupIDPresent: %s", err)
 	}
@@ -179,9 +180,9 @@ func isGroupIDPresent(gid int) (bool, error) {
 	return found, nil
 }
 
-func isHomeDirPresent(dirPath string) (bool, string, error) {
+func isHomeDirPresent(target transport.Transport, dirPath string) (bool, string, error) {
 	found := false
-	userList, err := userInfoList("/etc/passwd")
+	userList, err := userInfoList(target, "/etc/passwd")
 	if err != nil {
 		return false, "", fmt.Errorf("IsHomeDirPresent: %s", err)
 	}
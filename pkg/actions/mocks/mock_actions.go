@@ -19,9 +19,11 @@
 package mock_actions
 
 import (
-	gomock "github.com/golang/mock/gomock"
+	context "context"
 	reflect "reflect"
-	"github.com/acceldata-io/wizard/internal/parser"
+
+	parser "github.com/acceldata-io/wizard/internal/parser"
+	gomock "github.com/golang/mock/gomock"
 )
 
 // MockAction is a mock of Action interface.
@@ -48,15 +50,15 @@ func (m *MockAction) EXPECT() *MockActionMockRecorder {
 }
 
 // Do mocks base method.
-func (m *MockAction) Do(actions *parser.Action, wizardLog chan interface{}) error {
+func (m *MockAction) Do(ctx context.Context, actions *parser.Action, wizardLog chan interface{}) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Do", actions, wizardLog)
+	ret := m.ctrl.Call(m, "Do", ctx, actions, wizardLog)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Do indicates an expected call of Do.
-func (mr *MockActionMockRecorder) Do(actions, wizardLog interface{}) *gomock.Call {
+func (mr *MockActionMockRecorder) Do(ctx, actions, wizardLog interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Do", reflect.TypeOf((*MockAction)(nil).Do), actions, wizardLog)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Do", reflect.TypeOf((*MockAction)(nil).Do), ctx, actions, wizardLog)
 }
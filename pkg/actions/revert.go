@@ -0,0 +1,223 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actions
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/acceldata-io/wizard/pkg/transport"
+	"github.com/acceldata-io/wizard/pkg/wlog"
+)
+
+// Reverter is implemented by the actions able to undo the changes done by their last Do
+// It is used by the transactional mode of the task to roll back the changed actions after a failure
+type Reverter interface {
+	Revert(ctx context.Context, wizardLog chan interface{}) error
+}
+
+type undoStep struct {
+	description string
+	// undo is nil when the change can not be reverted
+	undo func() error
+}
+
+// journal records how to undo the changes of an action, it is only filled in transactional mode
+type journal struct {
+	enabled   bool
+	agentName string
+	// target is the machine of the changes, the undo steps are run on it
+	target transport.Transport
+	steps  []undoStep
+}
+
+func newJournal(agentName string, opts Options) journal {
+	return journal{enabled: opts.Transactional, agentName: agentName, target: opts.target()}
+}
+
+// active reports if the changes should be recorded, a nil journal records nothing
+func (j *journal) active() bool {
+	return j != nil && j.enabled
+}
+
+func (j *journal) add(description string, undo func() error) {
+	if j.active() {
+		j.steps = append(j.steps, undoStep{description: description, undo: undo})
+	}
+}
+
+// revert runs the undo steps in the reverse order, every step is tried and the errors are returned together
+func (j *journal) revert(ctx context.Context, wizardLog chan interface{}) error {
+	var errs []string
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("revert: interrupted - %w", err)
+		}
+		step := j.steps[i]
+		if step.undo == nil {
+			wizardLog <- wlog.WLWarn("rollback: cannot revert: " + step.description)
+			continue
+		}
+		wizardLog <- wlog.WLInfo("rollback: " + step.description)
+		if err := step.undo(); err != nil {
+			wizardLog <- wlog.WLError("rollback: failed to " + step.description + ": " + err.Error())
+			errs = append(errs, err.Error())
+		}
+	}
+	j.steps = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("revert: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// recordPath records how to undo a change of path, it should be called before path is changed
+// A missing path is removed, a symlink is pointed back to its target and a file is restored from a backup
+func (j *journal) recordPath(path string) error {
+	if !j.active() {
+		return nil
+	}
+	target := j.target
+	stat, err := target.Lstat(path)
+	if os.IsNotExist(err) {
+		j.recordDir(filepath.Dir(path))
+		j.add("remove "+path, func() error { return target.RemoveAll(path) })
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("recordPath: %s", err)
+	}
+
+	switch {
+	case stat.Mode()&os.ModeSymlink != 0:
+		link, err := target.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("recordPath: %s", err)
+		}
+		j.add("restore symlink "+path+" -> "+link, func() error {
+			if err := target.RemoveAll(path); err != nil {
+				return err
+			}
+			return target.Symlink(link, path)
+		})
+	case stat.IsDir():
+		j.add("restore removed dir "+path, nil)
+	default:
+		backup, err := backupFile(target, j.agentName, path)
+		if err != nil {
+			return err
+		}
+		j.add("restore "+path+" from "+backup, func() error {
+			return restoreFile(target, backup, path, stat)
+		})
+	}
+	return nil
+}
+
+// recordDir records the removal of the top most dir of path which does not exist yet
+// It should be called before the dir is created
+func (j *journal) recordDir(path string) {
+	if !j.active() {
+		return
+	}
+	top := ""
+	for dir := filepath.Clean(path); !exists(j.target, dir); dir = filepath.Dir(dir) {
+		top = dir
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	if top != "" {
+		target := j.target
+		j.add("remove dir "+top, func() error { return target.RemoveAll(top) })
+	}
+}
+
+// recordDirCopy records how to undo the copy of every file of the src dir into the dest dir
+func (j *journal) recordDirCopy(srcDir, srcType, destDir string) error {
+	if !j.active() {
+		return nil
+	}
+	files, err := srcDirFiles(srcDir, srcType)
+	if err != nil {
+		return fmt.Errorf("recordDirCopy: %s", err)
+	}
+	for _, file := range files {
+		if err := j.recordPath(filepath.Join(destDir, file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordAttributes records the permission and the owner of an existing path to restore them
+func (j *journal) recordAttributes(path string) error {
+	if !j.active() {
+		return nil
+	}
+	target := j.target
+	stat, err := target.Stat(path)
+	if err != nil {
+		return fmt.Errorf("recordAttributes: %s", err)
+	}
+	j.add("restore permission and owner of "+path, func() error {
+		if err := target.Chmod(path, stat.Mode().Perm()); err != nil {
+			return err
+		}
+		if uid, gid, ok := transport.Owner(stat); ok {
+			return target.Chown(path, uid, gid)
+		}
+		return nil
+	})
+	return nil
+}
+
+// backupFile copies the file into a unique file under the BackupDir of the agent on the target
+func backupFile(target transport.Transport, agentName, path string) (string, error) {
+	dir := filepath.Join(BackupDir, agentName)
+	if err := target.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("backupFile: unable to create backup dir - %s", err)
+	}
+	content, err := target.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("backupFile: unable to read file - %s - %s", path, err)
+	}
+	backup, err := target.CreateTemp(dir, filepath.Base(path)+".*.bak")
+	if err != nil {
+		return "", fmt.Errorf("backupFile: %s", err)
+	}
+	if err := target.WriteFile(backup, content, 0o600); err != nil {
+		return "", fmt.Errorf("backupFile: unable to write backup of %s - %s", path, err)
+	}
+	return backup, nil
+}
+
+// restoreFile writes back the backup with the permission and owner of the original file
+func restoreFile(target transport.Transport, backup, path string, stat os.FileInfo) error {
+	if err := target.RemoveAll(path); err != nil {
+		return err
+	}
+	if err := copyFile(target, backup, path, fmt.Sprintf("%#o", stat.Mode().Perm()), srcTarget); err != nil {
+		return err
+	}
+	if uid, gid, ok := transport.Owner(stat); ok {
+		if err := target.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return target.Remove(backup)
+}
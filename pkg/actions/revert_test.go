@@ -0,0 +1,139 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actions
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
+	"github.com/acceldata-io/wizard/pkg/transport/sshtest"
+)
+
+func TestCopyActionRevert(t *testing.T) {
+	server, err := sshtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	remote, err := transport.DialSSH(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	for _, target := range []transport.Transport{nil, remote} {
+		testCopyActionRevert(t, target)
+	}
+}
+
+func testCopyActionRevert(t *testing.T, target transport.Transport) {
+	dir := t.TempDir()
+	overwritten := filepath.Join(dir, "overwritten.yml")
+	created := filepath.Join(dir, "conf", "created.yml")
+	if err := os.WriteFile(overwritten, []byte("old content\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	registers := register.NewStore()
+	registers.Set("revert", &register.Register{})
+	copyAction := NewCopyAction("test", 10, "revert", Options{Transactional: true, Registers: registers, Transport: target})
+	wLog := make(chan interface{})
+	var doErr, revertErr error
+	go func() {
+		defer close(wLog)
+		for _, dest := range []string{overwritten, created} {
+			doErr = copyAction.Do(context.Background(), &parser.Action{
+				Action: "copy",
+				Name:   "copy file in transactional mode",
+				ActionVariables: map[string]interface{}{
+					"src_type":   "local",
+					"src":        "testdata/test.yml.tmpl",
+					"dest":       dest,
+					"permission": "0644",
+					"owner":      "root",
+					"group":      "root",
+					"parents":    true,
+				},
+			}, wLog)
+			if doErr != nil {
+				return
+			}
+		}
+		revertErr = copyAction.(Reverter).Revert(context.Background(), wLog)
+	}()
+
+	// This is here to wait for the channel
+	for range wLog {
+	}
+	if doErr != nil {
+		t.Fatal(doErr)
+	}
+	if revertErr != nil {
+		t.Fatal(revertErr)
+	}
+
+	content, err := os.ReadFile(overwritten)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "old content\n" {
+		t.Fatalf("%s not restored, got: %q", overwritten, content)
+	}
+	if stat, _ := os.Stat(overwritten); stat.Mode().Perm() != 0o600 {
+		t.Fatalf("%s permission not restored, got: %s", overwritten, stat.Mode())
+	}
+	if Exists(filepath.Dir(created)) {
+		t.Fatalf("%s should be removed", filepath.Dir(created))
+	}
+}
+
+func TestFileActionRevertWithoutTransactional(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "touched")
+	registers := register.NewStore()
+	registers.Set("no_revert", &register.Register{})
+	fileAction := NewFileAction("test", 10, "no_revert", Options{Registers: registers})
+	wLog := make(chan interface{})
+	var doErr, revertErr error
+	go func() {
+		defer close(wLog)
+		doErr = fileAction.Do(context.Background(), &parser.Action{
+			Action: "file",
+			Name:   "touch file",
+			ActionVariables: map[string]interface{}{
+				"files":      []interface{}{map[string]interface{}{"dest": dest}},
+				"permission": "0644",
+				"owner":      "root",
+				"group":      "root",
+				"state":      "touch",
+			},
+		}, wLog)
+		revertErr = fileAction.(Reverter).Revert(context.Background(), wLog)
+	}()
+
+	// This is here to wait for the channel
+	for range wLog {
+	}
+	if doErr != nil || revertErr != nil {
+		t.Fatal(doErr, revertErr)
+	}
+	if !Exists(dest) {
+		t.Fatalf("%s should be kept, nothing is recorded without the transactional mode", dest)
+	}
+}
@@ -15,10 +15,14 @@
 package actions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/transport"
 	"github.com/acceldata-io/wizard/pkg/wlog"
 
 	"github.com/acceldata-io/goutils/libsysd"
@@ -29,6 +33,8 @@ import (
 type systemD struct {
 	timeout  int
 	register string
+	opts     Options
+	journal  journal
 }
 
 type systemDVar struct {
@@ -38,8 +44,8 @@ type systemDVar struct {
 	State        string `json:"state" validate:"required"`
 }
 
-func NewSystemDAction(timeout int, register string) Action {
-	return &systemD{timeout: timeout, register: register}
+func NewSystemDAction(timeout int, register string, opts Options) Action {
+	return &systemD{timeout: timeout, register: register, opts: opts, journal: newJournal("", opts)}
 }
 
 func NewSystemDVar(data map[string]interface{}) (*systemDVar, error) {
@@ -62,11 +68,11 @@ func NewSystemDVar(data map[string]interface{}) (*systemDVar, error) {
 	return &s, nil
 }
 
-func (s *systemD) Do(actions *parser.Action, wizardLog chan interface{}) error {
+func (s *systemD) Do(ctx context.Context, actions *parser.Action, wizardLog chan interface{}) error {
 	wizardLog <- wlog.WLInfo("executing when condition")
 	if actions.When != nil {
-		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, s.timeout)
-		successfulExec, err := when.Execute()
+		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, s.timeout, s.opts.Registers).WithTransport(s.opts.Transport)
+		successfulExec, err := when.Execute(ctx)
 		if err != nil {
 			if actions.When.RVar != "" {
 				wizardLog <- wlog.WLError("register field validation error: " + err.Error())
@@ -84,40 +90,237 @@ func (s *systemD) Do(actions *parser.Action, wizardLog chan interface{}) error {
 		wizardLog <- wlog.WLError("validation error: " + err.Error())
 		return err
 	}
-	systemD := libsysd.NewSystemDAdapter()
+	// systemctl would manage the services of the target, not of the root
+	if root := transport.Root(s.opts.Transport); root != "" {
+		wizardLog <- wlog.WLError("the systemd action can not run under the target root " + root)
+		return fmt.Errorf("systemd: not supported under the target root %s", root)
+	}
+	systemD := s.serviceManager()
+
+	if s.opts.CheckMode {
+		return s.checkMode(ctx, systemD, vars, wizardLog)
+	}
 
 	if vars.DaemonReload {
 		wizardLog <- wlog.WLInfo("reloading the systemd daemon")
-		if err := systemD.ReloadDaemon(); err != nil {
+		if err := runWithContext(ctx, systemD.ReloadDaemon); err != nil {
+			return err
+		}
+	}
+
+	// start and stop change the service only if it is not already in the state, like in the check mode
+	var state string
+	if vars.State == "start" || vars.State == "stop" {
+		if state, err = activeState(ctx, systemD, vars.Name); err != nil {
+			wizardLog <- wlog.WLError("unable to get the state of systemd service: " + vars.Name + ". Because: " + err.Error())
 			return err
 		}
+		wizardLog <- wlog.WLInfo("systemd service: " + vars.Name + " is " + state)
+	}
+	if s.opts.Transactional {
+		s.recordState(systemD, vars, state)
 	}
 
+	changed := vars.DaemonReload
 	switch vars.State {
 	case "restart":
 		wizardLog <- wlog.WLInfo("restarting systemd service: " + vars.Name)
-		if _, err := systemD.RestartService(vars.Name); err != nil {
+		if err := runWithContext(ctx, func() error { return systemD.RestartService(vars.Name) }); err != nil {
 			return err
 		}
+		changed = true
 	case "start":
+		if state == "active" {
+			wizardLog <- wlog.WLInfo("systemd service: " + vars.Name + " is already active")
+			break
+		}
 		wizardLog <- wlog.WLInfo("starting systemd service: " + vars.Name)
-		if err := systemD.StartService(vars.Name); err != nil {
+		if err := runWithContext(ctx, func() error { return systemD.StartService(vars.Name) }); err != nil {
 			return err
 		}
+		changed = true
 	case "stop":
+		if !isRunning(state) {
+			wizardLog <- wlog.WLInfo("systemd service: " + vars.Name + " is already stopped")
+			break
+		}
 		wizardLog <- wlog.WLInfo("stopping systemd service: " + vars.Name)
-		if err := systemD.StopService(vars.Name); err != nil {
+		if err := runWithContext(ctx, func() error { return systemD.StopService(vars.Name) }); err != nil {
 			return err
 		}
+		changed = true
 	case "reload":
 		wizardLog <- wlog.WLInfo("reloading systemd service: " + vars.Name)
-		if err := systemD.ReloadService(vars.Name); err != nil {
+		if err := runWithContext(ctx, func() error { return systemD.ReloadService(vars.Name) }); err != nil {
 			return err
 		}
+		changed = true
 	default:
 		wizardLog <- wlog.WLError(fmt.Sprintf("unknown state: %s", vars.State))
 		return fmt.Errorf("unknown state: %s", vars.State)
 	}
 
+	if changed {
+		s.opts.Registers.Get(s.register).Changed = true
+	}
+	return nil
+}
+
+// Revert returns the service to the state it had before the last Do, a restart or a reload can not be reverted
+func (s *systemD) Revert(ctx context.Context, wizardLog chan interface{}) error {
+	return s.journal.revert(ctx, wizardLog)
+}
+
+// recordState records how to return the service to its current state, the state is only known for start and stop
+func (s *systemD) recordState(systemD serviceManager, vars *systemDVar, state string) {
+	switch vars.State {
+	case "start":
+		if state != "active" {
+			s.journal.add("stop systemd service: "+vars.Name, func() error { return systemD.StopService(vars.Name) })
+		}
+	case "stop":
+		if isRunning(state) {
+			s.journal.add("start systemd service: "+vars.Name, func() error { return systemD.StartService(vars.Name) })
+		}
+	case "restart", "reload":
+		s.journal.add(vars.State+" of systemd service: "+vars.Name, nil)
+	}
+}
+
+// activeState returns the ActiveState property of the unit
+func activeState(ctx context.Context, systemD serviceManager, name string) (string, error) {
+	var state string
+	err := runWithContext(ctx, func() error {
+		var err error
+		state, err = systemD.ActiveState(name)
+		return err
+	})
+	return state, err
+}
+
+// serviceManager is the part of systemd used by the action
+type serviceManager interface {
+	ReloadDaemon() error
+	StartService(name string) error
+	StopService(name string) error
+	RestartService(name string) error
+	ReloadService(name string) error
+	ActiveState(name string) (string, error)
+}
+
+// serviceManager returns the systemd of the target, over D-Bus on the local machine and with systemctl on a remote one
+func (s *systemD) serviceManager() serviceManager {
+	if s.opts.Transport == nil || s.opts.Transport == transport.Local {
+		return dbusManager{libsysd.NewSystemDAdapter()}
+	}
+	return systemctl{target: s.opts.Transport, timeout: time.Duration(s.timeout) * time.Second}
+}
+
+// dbusManager is the systemd of the local machine
+type dbusManager struct {
+	adapter libsysd.Adapter
+}
+
+func (d dbusManager) ReloadDaemon() error             { return d.adapter.ReloadDaemon() }
+func (d dbusManager) StartService(name string) error  { return d.adapter.StartService(name) }
+func (d dbusManager) StopService(name string) error   { return d.adapter.StopService(name) }
+func (d dbusManager) ReloadService(name string) error { return d.adapter.ReloadService(name) }
+func (d dbusManager) RestartService(name string) error {
+	_, err := d.adapter.RestartService(name)
+	return err
+}
+
+func (d dbusManager) ActiveState(name string) (string, error) {
+	properties, err := d.adapter.GetPropertiesForUnit(name)
+	if err != nil {
+		return "", err
+	}
+	state, _ := properties["ActiveState"].(string)
+	return state, nil
+}
+
+// systemctl is the systemd of a remote target, each call runs systemctl with the timeout of the action
+type systemctl struct {
+	target  transport.Transport
+	timeout time.Duration
+}
+
+func (s systemctl) ReloadDaemon() error              { return s.run("daemon-reload") }
+func (s systemctl) StartService(name string) error   { return s.run("start", name) }
+func (s systemctl) StopService(name string) error    { return s.run("stop", name) }
+func (s systemctl) RestartService(name string) error { return s.run("restart", name) }
+func (s systemctl) ReloadService(name string) error  { return s.run("reload", name) }
+
+func (s systemctl) ActiveState(name string) (string, error) {
+	output, err := s.output("show", "--property=ActiveState", "--value", name)
+	return strings.TrimSpace(output), err
+}
+
+func (s systemctl) run(args ...string) error {
+	_, err := s.output(args...)
+	return err
+}
+
+func (s systemctl) output(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	result, err := s.target.Run(ctx, "systemctl", args...)
+	if err != nil {
+		return "", fmt.Errorf("systemctl %s: %s", strings.Join(args, " "), err)
+	}
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("systemctl %s: exit code %d - %s", strings.Join(args, " "), result.ExitCode, strings.TrimSpace(result.StdErr))
+	}
+	return result.StdOut, nil
+}
+
+func isRunning(activeState string) bool {
+	return activeState == "active" || activeState == "activating" || activeState == "reloading"
+}
+
+// runWithContext runs fn and stops waiting for it once the ctx is cancelled
+// libsysd does not take a context, so a job already queued in systemd is not cancelled
+func runWithContext(ctx context.Context, fn func() error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fn()
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("systemd operation interrupted: %w", ctx.Err())
+	}
+}
+
+// checkMode reports the changes of the systemd action, the current state of the service is used for start and stop
+func (s *systemD) checkMode(ctx context.Context, systemD serviceManager, vars *systemDVar, wizardLog chan interface{}) error {
+	sRegister := s.opts.Registers.Get(s.register)
+	if vars.DaemonReload {
+		reportCheckMode(s.opts, sRegister, wizardLog, "reload the systemd daemon")
+	}
+
+	state, err := activeState(ctx, systemD, vars.Name)
+	if err != nil {
+		wizardLog <- wlog.WLError("unable to get the state of systemd service: " + vars.Name + ". Because: " + err.Error())
+		return err
+	}
+	wizardLog <- wlog.WLInfo("systemd service: " + vars.Name + " is " + state)
+
+	switch vars.State {
+	case "start":
+		if state != "active" {
+			reportCheckMode(s.opts, sRegister, wizardLog, "start systemd service: "+vars.Name)
+		}
+	case "stop":
+		if isRunning(state) {
+			reportCheckMode(s.opts, sRegister, wizardLog, "stop systemd service: "+vars.Name)
+		}
+	case "restart", "reload":
+		reportCheckMode(s.opts, sRegister, wizardLog, vars.State+" systemd service: "+vars.Name)
+	default:
+		wizardLog <- wlog.WLError(fmt.Sprintf("unknown state: %s", vars.State))
+		return fmt.Errorf("unknown state: %s", vars.State)
+	}
 	return nil
 }
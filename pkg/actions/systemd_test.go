@@ -0,0 +1,73 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package actions
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
+)
+
+// fakeSystemctl answers the systemctl commands with the state of a service and records the other ones
+type fakeSystemctl struct {
+	transport.Transport
+	state string
+	ran   []string
+}
+
+func (f *fakeSystemctl) Run(_ context.Context, name string, args ...string) (*transport.Result, error) {
+	if args[0] == "show" {
+		return &transport.Result{StdOut: f.state + "\n"}, nil
+	}
+	f.ran = append(f.ran, name+" "+strings.Join(args, " "))
+	return &transport.Result{}, nil
+}
+
+func TestSystemDChanged(t *testing.T) {
+	tests := []struct {
+		state, current string
+		changed        bool
+	}{
+		{"start", "active", false},
+		{"start", "inactive", true},
+		{"stop", "inactive", false},
+		{"stop", "active", true},
+		{"restart", "active", true},
+		{"reload", "active", true},
+	}
+	for _, tc := range tests {
+		target := &fakeSystemctl{Transport: transport.Local, state: tc.current}
+		registers := register.NewStore()
+		registers.Set("service", &register.Register{})
+		action := NewSystemDAction(10, "service", Options{Registers: registers, Transport: target})
+		input := &parser.Action{Action: "systemd", Name: "service", ActionVariables: map[string]interface{}{"name": "agent", "state": tc.state}}
+
+		wLog := make(chan interface{}, 100)
+		if err := action.Do(context.Background(), input, wLog); err != nil {
+			t.Fatalf("%s of an %s service: %s", tc.state, tc.current, err)
+		}
+		if changed := registers.Get("service").Changed; changed != tc.changed {
+			t.Fatalf("%s of an %s service: expected changed %v, got %v", tc.state, tc.current, tc.changed, changed)
+		}
+		if ran := len(target.ran) > 0; ran != tc.changed {
+			t.Fatalf("%s of an %s service: unexpected commands %v", tc.state, tc.current, target.ran)
+		}
+	}
+}
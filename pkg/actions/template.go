@@ -15,17 +15,16 @@
 package actions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/user"
 	"path/filepath"
 	"strconv"
 	"strings"
 
 	config_gen "github.com/acceldata-io/wizard/internal/configen"
 	"github.com/acceldata-io/wizard/internal/parser"
-	"github.com/acceldata-io/wizard/pkg/register"
 	"github.com/acceldata-io/wizard/pkg/wlog"
 
 	"github.com/go-playground/validator/v10"
@@ -37,6 +36,8 @@ type template struct {
 	wizardFacts map[string]interface{}
 	timeout     int
 	register    string
+	opts        Options
+	journal     journal
 }
 
 type templateVars struct {
@@ -49,15 +50,18 @@ type templateVars struct {
 	Force       bool   `json:"force"`
 	Backup      bool   `json:"backup"`
 	Parents     bool   `json:"parents"`
+	Sensitive   bool   `json:"sensitive"`
 }
 
-func NewTemplateAction(agentName string, config interface{}, wizardFacts map[string]interface{}, timeout int, localRegister string) Action {
+func NewTemplateAction(agentName string, config interface{}, wizardFacts map[string]interface{}, timeout int, localRegister string, opts Options) Action {
 	return &template{
 		agentName:   agentName,
 		config:      config,
 		timeout:     timeout,
 		wizardFacts: wizardFacts,
 		register:    localRegister,
+		opts:        opts,
+		journal:     newJournal(agentName, opts),
 	}
 }
 
@@ -80,7 +84,7 @@ func newTemplateVars(data map[string]interface{}) (*templateVars, error) {
 	return &templateConfig, nil
 }
 
-func (t *template) Do(actions *parser.Action, wizardLog chan interface{}) error {
+func (t *template) Do(ctx context.Context, actions *parser.Action, wizardLog chan interface{}) error {
 	/*
 		1. Get action vars
 		2. generate template file with config in a tmp location
@@ -89,12 +93,13 @@ func (t *template) Do(actions *parser.Action, wizardLog chan interface{}) error
 			2. if different copy tmpl file
 			3. Should check if dest is dir or not? // doubt
 	*/
-	tRegister := register.RMap[t.register]
+	tRegister := t.opts.Registers.Get(t.register)
+	target := t.opts.target()
 
 	wizardLog <- wlog.WLInfo("executing when condition")
 	if actions.When != nil {
-		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, t.timeout)
-		successfulExec, err := when.Execute()
+		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, t.timeout, t.opts.Registers).WithTransport(t.opts.Transport)
+		successfulExec, err := when.Execute(ctx)
 		if err != nil {
 			if actions.When.RVar != "" {
 				wizardLog <- wlog.WLError("register field validation error: " + err.Error())
@@ -114,29 +119,47 @@ func (t *template) Do(actions *parser.Action, wizardLog chan interface{}) error
 		return err
 	}
 
-	wizardLog <- wlog.WLInfo("creating template from src: " + tmplVars.Source + " to: /tmp")
-	err = config_gen.Execute(t.config, t.wizardFacts, tmplVars.Source, "/tmp", tmplVars.SourceType, PackageFiles)
+	// each template is rendered in its own local tmp dir, templates with the same file name can be rendered by tasks running in parallel
+	// and the rendered file is copied to the target
+	tmpDir, err := os.MkdirTemp("", "wizard-template-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	wizardLog <- wlog.WLInfo("creating template from src: " + tmplVars.Source + " to: " + tmpDir)
+	err = config_gen.Execute(t.config, t.wizardFacts, tmplVars.Source, tmpDir, tmplVars.SourceType, PackageFiles)
 	if err != nil {
 		return err
 	}
 
 	// is dest already exists compare hash
-	tmpSrc := config_gen.GetDestPath(tmplVars.Source, "/tmp")
+	tmpSrc := config_gen.GetDestPath(tmplVars.Source, tmpDir)
 
 	if tmplVars.Parents {
 		wizardLog <- wlog.WLInfo("creating parents")
 		dir, _ := filepath.Split(tmplVars.Destination)
-		err := CreateIfNotExists(dir, "0655")
-		if err != nil {
-			return err
+		if exists(target, dir) || !reportCheckMode(t.opts, tRegister, wizardLog, "create parent dir: "+dir) {
+			t.journal.recordDir(dir)
+			err := createIfNotExists(target, dir, "0655")
+			if err != nil {
+				return err
+			}
 		}
 	}
 
-	if _, err := os.Stat(tmplVars.Destination); err == nil {
-		if tmplVars.Force || GetHashOfFile(tmplVars.Destination) != GetHashOfFile(tmpSrc) {
+	if _, err := target.Stat(tmplVars.Destination); err == nil {
+		if tmplVars.Force || targetFileHash(target, tmplVars.Destination) != GetHashOfFile(tmpSrc) {
 			// take back up and then copy?
+			reportDiff(t.opts, tRegister, wizardLog, tmpSrc, "local", tmplVars.Destination, tmplVars.Sensitive)
+			if reportCheckMode(t.opts, tRegister, wizardLog, "copy template from src: "+tmplVars.Source+" to: "+tmplVars.Destination) {
+				return nil
+			}
 			wizardLog <- wlog.WLInfo("destination file found, hash not matched ot force is true, copying template from src: " + tmpSrc + " to:" + tmplVars.Destination)
-			err = CopyFile(tmpSrc, tmplVars.Destination, tmplVars.Permission, "local")
+			if err := t.journal.recordPath(tmplVars.Destination); err != nil {
+				return err
+			}
+			err = copyFile(target, tmpSrc, tmplVars.Destination, tmplVars.Permission, "local")
 			if err != nil {
 				return err
 			}
@@ -145,19 +168,30 @@ func (t *template) Do(actions *parser.Action, wizardLog chan interface{}) error
 			wizardLog <- wlog.WLInfo("hash matched and force is false")
 		}
 	} else {
+		reportDiff(t.opts, tRegister, wizardLog, tmpSrc, "local", tmplVars.Destination, tmplVars.Sensitive)
+		if reportCheckMode(t.opts, tRegister, wizardLog, "create file from template src: "+tmplVars.Source+" to: "+tmplVars.Destination) {
+			return nil
+		}
 		wizardLog <- wlog.WLInfo("destination file not found, copying template from src: " + tmpSrc + " to:" + tmplVars.Destination)
-		err = CopyFile(tmpSrc, tmplVars.Destination, tmplVars.Permission, "local")
+		if err := t.journal.recordPath(tmplVars.Destination); err != nil {
+			return err
+		}
+		err = copyFile(target, tmpSrc, tmplVars.Destination, tmplVars.Permission, "local")
 		if err != nil {
 			return err
 		}
 		tRegister.Changed = true
 	}
 
+	if t.opts.CheckMode {
+		return nil
+	}
+
 	// change owner of file
 	var uid, gid int
 
 	wizardLog <- wlog.WLInfo("changing owner for the file with: " + tmplVars.Owner)
-	fileUser, err := user.Lookup(tmplVars.Owner)
+	fileUser, err := target.LookupUser(tmplVars.Owner)
 	if err != nil {
 		return err
 	}
@@ -174,7 +208,7 @@ func (t *template) Do(actions *parser.Action, wizardLog chan interface{}) error
 			return err
 		}
 	} else {
-		fileGroup, err := user.LookupGroup(tmplVars.Group)
+		fileGroup, err := target.LookupGroup(tmplVars.Group)
 		if err != nil {
 			return err
 		}
@@ -185,17 +219,16 @@ func (t *template) Do(actions *parser.Action, wizardLog chan interface{}) error
 		}
 	}
 
-	err = os.Chown(tmplVars.Destination, uid, gid)
+	err = target.Chown(tmplVars.Destination, uid, gid)
 	if err != nil {
 		wizardLog <- wlog.WLError(fmt.Sprintf("unable to change owner to file - %s, with uid - %d, gid - %d, - %s", tmplVars.Destination, uid, gid, err))
 		return fmt.Errorf("unable to change owner to file - %s, with uid - %d, gid - %d, - %s", tmplVars.Destination, uid, gid, err)
 	}
 
-	// Remove tmp file
-	err = os.Remove(tmpSrc)
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
+
+// Revert restores the file overwritten by the last Do from its backup or removes the file and dirs it created
+func (t *template) Revert(ctx context.Context, wizardLog chan interface{}) error {
+	return t.journal.revert(ctx, wizardLog)
+}
@@ -15,6 +15,7 @@
 package actions
 
 import (
+	"context"
 	"reflect"
 	"testing"
 
@@ -232,17 +233,19 @@ func TestTemplateAction(t *testing.T) {
 		var got error
 		wLog := make(chan interface{})
 		if tc.input.Action == "template" {
-			templateAction := NewTemplateAction("test", nil, parser.GetWizardFacts(), 10, register.GetHash(tc.name))
-			register.RMap[register.GetHash(tc.name)] = &register.Register{}
+			registers := register.NewStore()
+			templateAction := NewTemplateAction("test", nil, parser.GetWizardFacts(), 10, register.GetHash(tc.name), Options{Registers: registers})
+			registers.Set(register.GetHash(tc.name), &register.Register{})
 			go func() {
-				got = templateAction.Do(tc.input, wLog)
+				got = templateAction.Do(context.Background(), tc.input, wLog)
 				close(wLog)
 			}()
 		} else if tc.input.Action == "file" {
-			fileAction := NewFileAction("test", 10, register.GetHash(tc.name))
-			register.RMap[register.GetHash(tc.name)] = &register.Register{}
+			registers := register.NewStore()
+			fileAction := NewFileAction("test", 10, register.GetHash(tc.name), Options{Registers: registers})
+			registers.Set(register.GetHash(tc.name), &register.Register{})
 			go func() {
-				got = fileAction.Do(tc.input, wLog)
+				got = fileAction.Do(context.Background(), tc.input, wLog)
 				close(wLog)
 			}()
 		}
@@ -24,19 +24,21 @@ import (
 
 	"github.com/acceldata-io/wizard/internal/parser"
 	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
 	"github.com/acceldata-io/wizard/pkg/wlog"
 
-	command "github.com/acceldata-io/goutils/shellutils/cmd"
 	"github.com/go-playground/validator/v10"
 )
 
 type actionUser struct {
 	timeout  int
 	register string
+	opts     Options
+	journal  journal
 }
 
-func NewUserAction(timeout int, localRegister string) Action {
-	return &actionUser{timeout: timeout, register: localRegister}
+func NewUserAction(timeout int, localRegister string, opts Options) Action {
+	return &actionUser{timeout: timeout, register: localRegister, opts: opts, journal: newJournal("", opts)}
 }
 
 type userVars struct {
@@ -68,13 +70,13 @@ func newUserVars(data map[string]interface{}) (*userVars, error) {
 	return &userVar, nil
 }
 
-func (u *actionUser) Do(actions *parser.Action, wizardLog chan interface{}) error {
-	uRegister := register.RMap[u.register]
+func (u *actionUser) Do(ctx context.Context, actions *parser.Action, wizardLog chan interface{}) error {
+	uRegister := u.opts.Registers.Get(u.register)
 
 	wizardLog <- wlog.WLInfo("executing when condition")
 	if actions.When != nil {
-		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, u.timeout)
-		successfulExec, err := when.Execute()
+		when := NewWhen(actions.When.Command, actions.When.RVar, actions.When.ExitCode, u.timeout, u.opts.Registers).WithTransport(u.opts.Transport)
+		successfulExec, err := when.Execute(ctx)
 		if err != nil {
 			if actions.When.RVar != "" {
 				wizardLog <- wlog.WLError("register field validation error: " + err.Error())
@@ -92,33 +94,45 @@ func (u *actionUser) Do(actions *parser.Action, wizardLog chan interface{}) erro
 		wizardLog <- wlog.WLError("validation error: " + err.Error())
 		return err
 	}
+	target := u.opts.target()
+	if u.opts.CheckMode {
+		return u.checkMode(userVars, uRegister, wizardLog)
+	}
 	useUID, useGID, useHomeDir := false, false, false
 	isUserDel := false
 
 	// TODO - If no binaries are found, edit the /etc/passwd for user and /etc/group for group
 
 	wizardLog <- wlog.WLInfo("checking user and group core binaries")
-	userBins, err := CheckUserCoreBinaries(u.timeout)
+	userBins, err := coreBinaries(ctx, target, u.timeout, "adduser", "useradd", "userdel", "deluser")
 	if err != nil {
 		wizardLog <- wlog.WLError("unable to check for useradd/del OS binaries. Because: " + err.Error())
 		return err
 	}
-	isUserAddPresent := userBins["useradd"]
-	isAddUserPresent := userBins["adduser"]
-	isUserDelPresent := userBins["userdel"]
-	isDelUserPresent := userBins["deluser"]
-
-	groupBins, err := CheckGroupCoreBinaries(u.timeout)
+	groupBins, err := coreBinaries(ctx, target, u.timeout, "groupadd", "addgroup", "groupdel", "delgroup")
 	if err != nil {
 		wizardLog <- wlog.WLError("unable to check for groupadd/del OS binaries. Because: " + err.Error())
 		return err
 	}
+
+	// only the shadow-utils commands can edit the user database of a root, with --root
+	root := transport.Root(target)
+	if root != "" {
+		wizardLog <- wlog.WLInfo("target root " + root + ", using the commands supporting --root")
+		for _, name := range []string{"adduser", "deluser", "addgroup", "delgroup"} {
+			userBins[name], groupBins[name] = false, false
+		}
+	}
+	isUserAddPresent := userBins["useradd"]
+	isAddUserPresent := userBins["adduser"]
+	isUserDelPresent := userBins["userdel"]
+	isDelUserPresent := userBins["deluser"]
 	isAddGroupPresent := groupBins["addgroup"]
 	isGroupAddPresent := groupBins["groupadd"]
 
 	wizardLog <- wlog.WLInfo("checking if user is present with all the properties")
 	// Check if the user is present with all the properties
-	if userNameOK, err := isUserPresent(userVars.Name); !userNameOK {
+	if userNameOK, err := isUserPresent(target, userVars.Name); !userNameOK {
 		wizardLog <- wlog.WLInfo("user with name " + userVars.Name + " not found")
 		if err != nil {
 			return err
@@ -131,14 +145,14 @@ func (u *actionUser) Do(actions *parser.Action, wizardLog chan interface{}) erro
 		if err != nil {
 			return fmt.Errorf("unable to convert user id to int - %s", err)
 		}
-		if uidOK, err := isUserIDPresent(uid); !uidOK {
+		if uidOK, err := isUserIDPresent(target, uid); !uidOK {
 			if err != nil {
 				return err
 			}
 			useUID = true
 		}
 
-		if homeDirOK, _, err := isHomeDirPresent(userVars.Home); !homeDirOK {
+		if homeDirOK, _, err := isHomeDirPresent(target, userVars.Home); !homeDirOK {
 			if err != nil {
 				return err
 			}
@@ -150,7 +164,7 @@ func (u *actionUser) Do(actions *parser.Action, wizardLog chan interface{}) erro
 	} else {
 		if userVars.State == "present" {
 			if userVars.Force {
-				userInfo, err := userLookup(userVars.Name)
+				userInfo, err := userLookup(target, userVars.Name)
 				if err != nil {
 					return err
 				}
@@ -159,7 +173,7 @@ func (u *actionUser) Do(actions *parser.Action, wizardLog chan interface{}) erro
 					wizardLog <- wlog.WLInfo("home dir matches, returning nil")
 					return nil
 				} else {
-					if homeDirOK, _, err := isHomeDirPresent(userVars.Home); !homeDirOK {
+					if homeDirOK, _, err := isHomeDirPresent(target, userVars.Home); !homeDirOK {
 						if err != nil {
 							return err
 						}
@@ -179,7 +193,7 @@ func (u *actionUser) Do(actions *parser.Action, wizardLog chan interface{}) erro
 	}
 
 	wizardLog <- wlog.WLInfo("checking if group " + userVars.GroupID + " is present")
-	if groupNameOK, err := isGroupNamePresent(userVars.Name); !groupNameOK {
+	if groupNameOK, err := isGroupNamePresent(target, userVars.Name); !groupNameOK {
 		if err != nil {
 			return err
 		}
@@ -188,34 +202,36 @@ func (u *actionUser) Do(actions *parser.Action, wizardLog chan interface{}) erro
 			return err
 		}
 
-		if gidOK, err := isGroupIDPresent(gid); !gidOK {
+		if gidOK, err := isGroupIDPresent(target, gid); !gidOK {
 			if err != nil {
 				return err
 			}
 
-			var groupCmd *command.Command
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(u.timeout)*time.Second)
+			var groupCmd string
+			cmdCtx, cancel := context.WithTimeout(ctx, time.Duration(u.timeout)*time.Second)
 			defer cancel()
 			if isGroupAddPresent {
-				groupCmd = command.New(ctx, "groupadd", []string{"-g", userVars.GroupID, userVars.Name})
+				groupCmd = "groupadd"
 			} else if isAddGroupPresent {
-				groupCmd = command.New(ctx, "addgroup", []string{"-g", userVars.GroupID, userVars.Name})
+				groupCmd = "addgroup"
 			} else {
 				return fmt.Errorf("addgroup and groupadd not present")
 			}
-			wizardLog <- wlog.WLInfo("running command: " + groupCmd.Command + " " + strings.Join(groupCmd.Args, " "))
-			output, err := groupCmd.Run()
+			groupArgs := append(rootArgs(root), "-g", userVars.GroupID, userVars.Name)
+			wizardLog <- wlog.WLInfo("running command: " + groupCmd + " " + strings.Join(groupArgs, " "))
+			output, err := target.Run(cmdCtx, groupCmd, groupArgs...)
 			if err != nil {
-				return fmt.Errorf("unable to run the %q - %s", groupCmd.Command, err.Error())
+				return fmt.Errorf("unable to run the %q - %s", groupCmd, err.Error())
 			}
-			if output.Status.ExitCode != 0 {
-				return fmt.Errorf("status code not 0 - %s", output.Status.StdErr)
+			if output.ExitCode != 0 {
+				return fmt.Errorf("status code not 0 - %s", output.StdErr)
 			}
+			u.journal.add("remove group "+userVars.Name, u.undoWith(groupBins, []string{"groupdel", "delgroup"}, append(rootArgs(root), userVars.Name)...))
 			useGID = true
 		}
 	}
 
-	cmdArgs := []string{"-s", userVars.Shell}
+	cmdArgs := append(rootArgs(root), "-s", userVars.Shell)
 	if useUID {
 		cmdArgs = append(cmdArgs, "-u", userVars.UserID)
 	}
@@ -231,143 +247,162 @@ func (u *actionUser) Do(actions *parser.Action, wizardLog chan interface{}) erro
 
 	wizardLog <- wlog.WLInfo("executing user command")
 	wizardLog <- wlog.WLInfo("command arguments: " + strings.Join(cmdArgs, " "))
-	var output *command.Command
+	var output *transport.Result
 	if userVars.State == "absent" {
 		if isUserDel {
-			var userCmd *command.Command
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(u.timeout)*time.Second)
+			var userCmd string
+			cmdCtx, cancel := context.WithTimeout(ctx, time.Duration(u.timeout)*time.Second)
 			defer cancel()
 			if isUserDelPresent {
-				userCmd = command.New(ctx, "userdel", []string{userVars.Name})
+				userCmd = "userdel"
 			} else if isDelUserPresent {
-				userCmd = command.New(ctx, "deluser", []string{userVars.Name})
+				userCmd = "deluser"
 			} else {
 				return fmt.Errorf("userdel and deluser not found")
 			}
-			wizardLog <- wlog.WLInfo("running command: " + userCmd.Command)
-			output, err = userCmd.Run()
+			wizardLog <- wlog.WLInfo("running command: " + userCmd)
+			delArgs := append(rootArgs(root), userVars.Name)
+			output, err = target.Run(cmdCtx, userCmd, delArgs...)
 			if err != nil {
-				wizardLog <- wlog.WLError("unable to run the command: '" + userCmd.Command + " " + strings.Join(userCmd.Args, " ") + "'")
+				wizardLog <- wlog.WLError("unable to run the command: '" + userCmd + " " + strings.Join(delArgs, " ") + "'")
 				return err
 			}
 		}
 	} else {
-		var userCmd *command.Command
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(u.timeout)*time.Second)
+		var userCmd string
+		cmdCtx, cancel := context.WithTimeout(ctx, time.Duration(u.timeout)*time.Second)
 		defer cancel()
 		if isUserAddPresent {
-			userCmd = command.New(ctx, "useradd", cmdArgs)
+			userCmd = "useradd"
 		} else if isAddUserPresent {
-			userCmd = command.New(ctx, "adduser", cmdArgs)
+			userCmd = "adduser"
 		} else {
 			return fmt.Errorf("useradd and adduser not present")
 		}
-		wizardLog <- wlog.WLInfo("running command: " + userCmd.Command)
-		output, err = userCmd.Run()
+		wizardLog <- wlog.WLInfo("running command: " + userCmd)
+		output, err = target.Run(cmdCtx, userCmd, cmdArgs...)
 		if err != nil {
-			wizardLog <- wlog.WLError("unable to run the command: '" + userCmd.Command + " " + strings.Join(userCmd.Args, " ") + "'")
+			wizardLog <- wlog.WLError("unable to run the command: '" + userCmd + " " + strings.Join(cmdArgs, " ") + "'")
 			return err
 		}
 	}
-	if output.Status.ExitCode != 0 {
-		return fmt.Errorf("status code not 0 - %s", output.Status.StdErr)
+	if output.ExitCode != 0 {
+		return fmt.Errorf("status code not 0 - %s", output.StdErr)
+	}
+	if isUserDel {
+		u.journal.add("restore removed user "+userVars.Name, nil)
+	} else {
+		u.journal.add("remove user "+userVars.Name, u.undoWith(userBins, []string{"userdel", "deluser"}, append(rootArgs(root), userVars.Name)...))
 	}
 	uRegister.Changed = true
 	return nil
 }
 
-func CheckUserCoreBinaries(timeout int) (map[string]bool, error) {
-	//
-	result := map[string]bool{
-		"adduser": false,
-		"useradd": false,
-		"userdel": false,
-		"deluser": false,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer cancel()
+// Revert removes the user and the group created by the last Do, a removed user can not be restored
+func (u *actionUser) Revert(ctx context.Context, wizardLog chan interface{}) error {
+	return u.journal.revert(ctx, wizardLog)
+}
 
-	addUserCmd := command.New(ctx, "which", []string{"adduser"})
-	output, err := addUserCmd.Run()
-	if err != nil {
-		return result, err
-	}
-	if output.Status.ExitCode == 0 {
-		result["adduser"] = true
+// rootArgs returns the --root option of the shadow-utils commands for the root, none without a root
+func rootArgs(root string) []string {
+	if root == "" {
+		return nil
 	}
+	return []string{"--root", root}
+}
 
-	ctx, cancel2 := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer cancel2()
-
-	userAddCmd := command.New(ctx, "which", []string{"useradd"})
-	output, err = userAddCmd.Run()
-	if err != nil {
-		return result, err
-	}
-	if output.Status.ExitCode == 0 {
-		result["useradd"] = true
+// undoWith returns an undo step running the first of the commands present on the target
+// The step fails at once without running anything when none of them is present
+func (u *actionUser) undoWith(binaries map[string]bool, names []string, args ...string) func() error {
+	for _, name := range names {
+		if binaries[name] {
+			return u.undoCommand(name, args...)
+		}
 	}
+	err := fmt.Errorf("unable to revert, %s not present", strings.Join(names, " and "))
+	return func() error { return err }
+}
 
-	ctx, cancel3 := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer cancel3()
-
-	userDelCmd := command.New(ctx, "which", []string{"userdel"})
-	output, err = userDelCmd.Run()
-	if err != nil {
-		return result, err
-	}
-	if output.Status.ExitCode == 0 {
-		result["userdel"] = true
+// undoCommand returns an undo step running the command, the step has its own timeout as the run may be cancelled
+func (u *actionUser) undoCommand(name string, args ...string) func() error {
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(u.timeout)*time.Second)
+		defer cancel()
+		output, err := u.opts.target().Run(ctx, name, args...)
+		if err != nil {
+			return fmt.Errorf("unable to run the %q - %s", name, err.Error())
+		}
+		if output.ExitCode != 0 {
+			return fmt.Errorf("status code not 0 - %s", output.StdErr)
+		}
+		return nil
 	}
+}
 
-	ctx, cancel4 := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer cancel4()
-
-	delUserCmd := command.New(ctx, "which", []string{"deluser"})
-	output, err = delUserCmd.Run()
+// checkMode reports the changes of the user action without running any user or group command
+func (u *actionUser) checkMode(userVars *userVars, uRegister *register.Register, wizardLog chan interface{}) error {
+	target := u.opts.target()
+	userNameOK, err := isUserPresent(target, userVars.Name)
 	if err != nil {
-		return result, err
+		return err
+	}
+	if userVars.State == "absent" {
+		if !userNameOK {
+			return fmt.Errorf("USERDEL: User not found")
+		}
+		reportCheckMode(u.opts, uRegister, wizardLog, "remove user: "+userVars.Name)
+		return nil
 	}
-	if output.Status.ExitCode == 0 {
-		result["deluser"] = true
+	if userNameOK {
+		wizardLog <- wlog.WLInfo("User already exists")
+		return nil
 	}
-
-	return result, nil
-}
-
-func CheckGroupCoreBinaries(timeout int) (map[string]bool, error) {
-	//
-	result := map[string]bool{
-		"groupadd": false,
-		"addgroup": false,
+	if homeDirOK, _, err := isHomeDirPresent(target, userVars.Home); err != nil {
+		return err
+	} else if homeDirOK {
+		return fmt.Errorf("HomeDirFound")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer cancel()
-
-	groupAddCmd := command.New(ctx, "which", []string{"groupadd"})
-	output, err := groupAddCmd.Run()
+	groupNameOK, err := isGroupNamePresent(target, userVars.Name)
 	if err != nil {
-		return result, err
+		return err
 	}
-
-	if output.Status.ExitCode == 0 {
-		result["groupadd"] = true
+	if !groupNameOK {
+		gid, err := strconv.Atoi(userVars.GroupID)
+		if err != nil {
+			return err
+		}
+		if gidOK, err := isGroupIDPresent(target, gid); err != nil {
+			return err
+		} else if !gidOK {
+			reportCheckMode(u.opts, uRegister, wizardLog, "create group: "+userVars.Name+" with gid: "+userVars.GroupID)
+		}
 	}
+	reportCheckMode(u.opts, uRegister, wizardLog, "create user: "+userVars.Name+" with uid: "+userVars.UserID+", home: "+userVars.Home+", shell: "+userVars.Shell)
+	return nil
+}
 
-	ctx, cancel2 := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer cancel2()
+// CheckUserCoreBinaries reports which of the user binaries are found on the local machine
+func CheckUserCoreBinaries(ctx context.Context, timeout int) (map[string]bool, error) {
+	return coreBinaries(ctx, transport.Local, timeout, "adduser", "useradd", "userdel", "deluser")
+}
 
-	addGroupCmd := command.New(ctx, "which", []string{"addgroup"})
-	output, err = addGroupCmd.Run()
-	if err != nil {
-		return result, err
-	}
+// CheckGroupCoreBinaries reports which of the group binaries are found on the local machine
+func CheckGroupCoreBinaries(ctx context.Context, timeout int) (map[string]bool, error) {
+	return coreBinaries(ctx, transport.Local, timeout, "groupadd", "addgroup")
+}
 
-	if output.Status.ExitCode == 0 {
-		result["addgroup"] = true
+// coreBinaries reports which of the binaries are found on the target with which
+func coreBinaries(ctx context.Context, target transport.Transport, timeout int, names ...string) (map[string]bool, error) {
+	result := make(map[string]bool, len(names))
+	for _, name := range names {
+		cmdCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		output, err := target.Run(cmdCtx, "which", name)
+		cancel()
+		if err != nil {
+			return result, err
+		}
+		result[name] = output.ExitCode == 0
 	}
-
 	return result, nil
 }
@@ -15,12 +15,19 @@
 package actions
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/acceldata-io/wizard/internal/parser"
 	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
 )
 
 func TestNewUserVars(t *testing.T) {
@@ -111,13 +118,14 @@ func TestUserAction(t *testing.T) {
 	}
 
 	for _, tc := range tests {
-		register.RMap[register.GetHash(tc.name)] = &register.Register{}
-		userAction := NewUserAction(10, register.GetHash(tc.name))
+		registers := register.NewStore()
+		registers.Set(register.GetHash(tc.name), &register.Register{})
+		userAction := NewUserAction(10, register.GetHash(tc.name), Options{Registers: registers})
 
 		var got error
 		wLog := make(chan interface{})
 		go func() {
-			got = userAction.Do(tc.input, wLog)
+			got = userAction.Do(context.Background(), tc.input, wLog)
 			close(wLog)
 		}()
 
@@ -130,3 +138,55 @@ func TestUserAction(t *testing.T) {
 		}
 	}
 }
+
+func TestUserUndoWith(t *testing.T) {
+	u := &actionUser{timeout: 10}
+	err := u.undoWith(map[string]bool{"userdel": false, "deluser": false}, []string{"userdel", "deluser"}, "hydra")()
+	if err == nil || !strings.Contains(err.Error(), "userdel and deluser not present") {
+		t.Fatalf("expected the undo to fail without the binaries, got %v", err)
+	}
+	// the command present is run, true is used as a command which succeeds
+	if err := u.undoWith(map[string]bool{"false": false, "true": true}, []string{"false", "true"})(); err != nil {
+		t.Fatalf("expected the present command to run, got %v", err)
+	}
+}
+
+func TestUserActionRoot(t *testing.T) {
+	if _, err := exec.LookPath("useradd"); err != nil {
+		t.Skip("useradd not present")
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("root:x:0:0:root:/root:/bin/bash\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "group"), []byte("root:x:0:\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	registers := register.NewStore()
+	registers.Set("root", &register.Register{})
+	userAction := NewUserAction(10, "root", Options{Registers: registers, Transactional: true, Transport: transport.Rooted(transport.Local, root)})
+	input := &parser.Action{Action: "user", Name: "user add", ActionVariables: map[string]interface{}{
+		"name": "wizardroot", "home": "/opt/wizardroot", "shell": "/bin/sh", "uid": "1996", "gid": "1992", "state": "present",
+	}}
+
+	wLog := make(chan interface{}, 100)
+	if err := userAction.Do(context.Background(), input, wLog); err != nil {
+		t.Fatal(err)
+	}
+	passwd, err := os.ReadFile(filepath.Join(root, "etc", "passwd"))
+	if err != nil || !strings.Contains(string(passwd), "wizardroot:") {
+		t.Fatalf("expected the user in the passwd of the root, got %q %v", passwd, err)
+	}
+	if _, err := user.Lookup("wizardroot"); err == nil {
+		t.Fatal("expected the user not to be added to the host")
+	}
+	if err := userAction.(Reverter).Revert(context.Background(), wLog); err != nil {
+		t.Fatal(err)
+	}
+	if group, err := os.ReadFile(filepath.Join(root, "etc", "group")); err != nil || strings.Contains(string(group), "wizardroot") {
+		t.Fatalf("expected the group removed from the root, got %q %v", group, err)
+	}
+}
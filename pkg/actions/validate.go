@@ -0,0 +1,109 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+)
+
+// validateVars decodes the action_var with decode, a type error of a templated action_var is not reported
+// as the action_var is rendered before the action runs, e.g. "force": "{{ .Force }}"
+func validateVars(actions *parser.Action, decode func(data map[string]interface{}) error) error {
+	err := decode(actions.ActionVariables)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && hasTemplate(actions.ActionVariables) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("action_var: %s", err.Error())
+	}
+	return nil
+}
+
+func hasTemplate(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, "{{")
+	case map[string]interface{}:
+		for _, val := range v {
+			if hasTemplate(val) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, val := range v {
+			if hasTemplate(val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate checks the action_var, the source files are not checked as they can be created by the actions before
+func (c *copyAction) Validate(actions *parser.Action) error {
+	return validateVars(actions, func(data map[string]interface{}) error {
+		copyConfig, err := newCopyVars(data)
+		if err != nil && copyConfig == nil && strings.Contains(fmt.Sprint(data["src_type"]), "{{") {
+			return nil
+		}
+		return err
+	})
+}
+
+// Validate checks the action_var
+func (t *template) Validate(actions *parser.Action) error {
+	return validateVars(actions, func(data map[string]interface{}) error {
+		_, err := newTemplateVars(data)
+		return err
+	})
+}
+
+// Validate checks the action_var
+func (f *fileAction) Validate(actions *parser.Action) error {
+	return validateVars(actions, func(data map[string]interface{}) error {
+		_, err := NewFileVar(data)
+		return err
+	})
+}
+
+// Validate checks the action_var
+func (u *actionUser) Validate(actions *parser.Action) error {
+	return validateVars(actions, func(data map[string]interface{}) error {
+		_, err := newUserVars(data)
+		return err
+	})
+}
+
+// Validate checks the action_var
+func (s *systemD) Validate(actions *parser.Action) error {
+	return validateVars(actions, func(data map[string]interface{}) error {
+		_, err := NewSystemDVar(data)
+		return err
+	})
+}
+
+// Validate checks that the command is not empty
+func (s *cmd) Validate(actions *parser.Action) error {
+	if len(actions.Command) < 1 {
+		return fmt.Errorf("command: empty command")
+	}
+	return nil
+}
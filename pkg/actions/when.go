@@ -20,27 +20,35 @@ import (
 	"time"
 
 	"github.com/acceldata-io/wizard/pkg/register"
-
-	command "github.com/acceldata-io/goutils/shellutils/cmd"
+	"github.com/acceldata-io/wizard/pkg/transport"
 )
 
 type whenConditional struct {
-	command  string
-	rvar     string
-	exitCode int
-	timeout  int
+	command   string
+	rvar      string
+	exitCode  int
+	timeout   int
+	registers *register.Store
+	target    transport.Transport
 }
 
-func NewWhen(expression string, rvar string, expected int, timeout int) *whenConditional {
+func NewWhen(expression string, rvar string, expected int, timeout int, registers *register.Store) *whenConditional {
 	return &whenConditional{
-		command:  expression,
-		exitCode: expected,
-		timeout:  timeout,
-		rvar:     rvar,
+		command:   expression,
+		exitCode:  expected,
+		timeout:   timeout,
+		rvar:      rvar,
+		registers: registers,
 	}
 }
 
-func (w *whenConditional) Execute() (bool, error) {
+// WithTransport runs the cmd of the condition on the target, the local machine by default
+func (w *whenConditional) WithTransport(target transport.Transport) *whenConditional {
+	w.target = target
+	return w
+}
+
+func (w *whenConditional) Execute(ctx context.Context) (bool, error) {
 	if w.rvar != "" {
 		/*
 				- Parse the input rvar
@@ -53,19 +61,21 @@ func (w *whenConditional) Execute() (bool, error) {
 				- use a stack or queue? split line with a space?
 				- will there be '(' ')' ? If so need to add priority in execution
 		*/
-		return register.ParseRegisterExp(w.rvar)
+		return w.registers.ParseRegisterExp(w.rvar)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.timeout)*time.Second)
+	cmdCtx, cancel := context.WithTimeout(ctx, time.Duration(w.timeout)*time.Second)
 	defer cancel()
 
-	cmd := command.New(ctx, "", []string{})
-	cmd.WithExpression("bash", w.command)
-	if _, err := cmd.Run(); err != nil {
+	result, err := targetOf(w.target).Run(cmdCtx, "bash", "-c", w.command)
+	if err != nil {
 		return false, err
 	}
-	if cmd.Status.ExitCode == w.exitCode {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+	if result.ExitCode == w.exitCode {
 		return true, nil
 	}
-	return false, fmt.Errorf("exit code %q doesn't match the expected exit code %q", cmd.Status.ExitCode, w.exitCode)
+	return false, fmt.Errorf("exit code %q doesn't match the expected exit code %q", result.ExitCode, w.exitCode)
 }
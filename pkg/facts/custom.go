@@ -0,0 +1,166 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/acceldata-io/wizard/pkg/transport"
+)
+
+// DefaultFactsDir is the usual facts.d dir, it is only loaded when it is set, e.g. as the Path of a Dir
+const DefaultFactsDir = "/etc/wizard/facts.d"
+
+// Provider returns custom facts, e.g. the role of a node, they are in the Custom field of the Facts
+// A provider can return the facts it loaded with an error for the others, see Dir
+type Provider interface {
+	Facts(ctx context.Context) (map[string]interface{}, error)
+}
+
+// ProviderFunc is a func used as a Provider
+type ProviderFunc func(ctx context.Context) (map[string]interface{}, error)
+
+func (f ProviderFunc) Facts(ctx context.Context) (map[string]interface{}, error) {
+	return f(ctx)
+}
+
+// Custom returns the facts of the providers, the facts of a provider replace the ones with the same name before it
+// A failing provider or fact does not fail the others, its error is returned with the ones of the other providers,
+// one for each file of a Dir
+func Custom(ctx context.Context, providers ...Provider) (map[string]interface{}, []error) {
+	custom := map[string]interface{}{}
+	var errs []error
+	for _, provider := range providers {
+		providerFacts, err := provider.Facts(ctx)
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = append(errs, joined.Unwrap()...)
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("Custom: %s", err))
+		}
+		for name, value := range providerFacts {
+			custom[name] = value
+		}
+	}
+	return custom, errs
+}
+
+// Dir is a Provider of the facts of a facts.d dir, each fact is named after a file without its extension:
+// a .json file holds its value, and an executable file prints it as JSON, e.g. node.json or rack.sh
+// The other files and the hidden ones are ignored, a dir which does not exist has no facts
+// A file is skipped unless it is owned by root, or the user running wizard, and is not writable by the group
+// or the others, as it could be changed to run any command. The facts of the other files are returned with
+// the errors of the skipped and the failing files joined
+type Dir struct {
+	Path string
+	// Timeout of each executable, 10 seconds if zero
+	Timeout time.Duration
+}
+
+func (d Dir) Facts(ctx context.Context) (map[string]interface{}, error) {
+	entries, err := os.ReadDir(d.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]interface{}{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("facts dir: %s", err)
+	}
+	dirFacts := map[string]interface{}{}
+	var errs []error
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(d.Path, entry.Name())
+		value, ok, err := d.fact(ctx, path, entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("facts dir: %s", err))
+		} else if ok {
+			dirFacts[strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))] = value
+		}
+	}
+	return dirFacts, errors.Join(errs...)
+}
+
+// fact returns the value of the fact of a file, false if the file is not a fact
+func (d Dir) fact(ctx context.Context, path string, entry fs.DirEntry) (interface{}, bool, error) {
+	info, err := entry.Info()
+	if err != nil {
+		return nil, false, err
+	}
+	isJSON := filepath.Ext(path) == ".json"
+	if !info.Mode().IsRegular() || (!isJSON && info.Mode().Perm()&0o111 == 0) {
+		return nil, false, nil
+	}
+	if err := checkOwner(path, info); err != nil {
+		return nil, false, err
+	}
+	var content []byte
+	if isJSON {
+		content, err = os.ReadFile(path)
+	} else {
+		content, err = d.run(ctx, path)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return nil, false, fmt.Errorf("invalid JSON in %s - %s", path, err)
+	}
+	return value, true, nil
+}
+
+// checkOwner returns an error if the file is not owned by root or the current user, or is writable by the group or the others
+func checkOwner(path string, info fs.FileInfo) error {
+	uid, _, ok := transport.Owner(info)
+	if !ok {
+		return fmt.Errorf("skipped %s, unable to check its owner", path)
+	}
+	if uid != 0 && uid != os.Getuid() {
+		return fmt.Errorf("skipped %s, it is owned by the uid %d, not root", path, uid)
+	}
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("skipped %s, it is writable by the group or the others - %s", path, info.Mode().Perm())
+	}
+	return nil
+}
+
+// run returns the output of the executable, it fails with a non zero exit code
+func (d Dir) run(ctx context.Context, path string) ([]byte, error) {
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := transport.Local.Run(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to run %s - %s", path, err)
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("unable to run %s - %s", path, ctx.Err())
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("%s exited with %d - %s", path, result.ExitCode, strings.TrimSpace(result.StdErr))
+	}
+	return []byte(result.StdOut), nil
+}
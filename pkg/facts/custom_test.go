@@ -0,0 +1,126 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	writeFixtures(t, dir, map[string]string{
+		"node.json":    `{"role": "kafka-broker", "zone": "a"}`,
+		"README.txt":   "not a fact",
+		".hidden.json": `{"hidden": true}`,
+	})
+	if err := os.WriteFile(filepath.Join(dir, "rack.sh"), []byte("#!/bin/sh\necho '\"r12\"'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Dir{Path: dir}.Facts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"node": map[string]interface{}{"role": "kafka-broker", "zone": "a"},
+		"rack": "r12",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected facts %v", got)
+	}
+
+	if got, err := (Dir{Path: filepath.Join(dir, "missing")}).Facts(context.Background()); err != nil || len(got) != 0 {
+		t.Fatalf("expected no facts without the dir, got %v %v", got, err)
+	}
+}
+
+func TestDirErrors(t *testing.T) {
+	tests := map[string]struct {
+		name, content string
+		perm          os.FileMode
+		uid           int
+		want          string
+	}{
+		"invalid json":    {"node.json", `{"role":`, 0o644, 0, "invalid JSON"},
+		"failing script":  {"rack", "#!/bin/sh\necho broken >&2\nexit 3\n", 0o755, 0, "exited with 3 - broken"},
+		"script output":   {"rack", "#!/bin/sh\necho r12\n", 0o755, 0, "invalid JSON"},
+		"world writable":  {"rack", "#!/bin/sh\necho '\"r12\"'\n", 0o757, 0, "skipped"},
+		"group writable":  {"node.json", `{"role": "kafka-broker"}`, 0o664, 0, "writable by the group or the others"},
+		"owned by a user": {"rack", "#!/bin/sh\necho '\"r12\"'\n", 0o755, 1500, "owned by the uid 1500"},
+	}
+	for name, tc := range tests {
+		if tc.uid != 0 && os.Getuid() != 0 {
+			continue
+		}
+		dir := t.TempDir()
+		path := filepath.Join(dir, tc.name)
+		if err := os.WriteFile(path, []byte(tc.content), tc.perm); err != nil {
+			t.Fatal(err)
+		}
+		// the permissions are set again as the umask applies to WriteFile
+		if err := os.Chmod(path, tc.perm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chown(path, tc.uid, -1); tc.uid != 0 && err != nil {
+			t.Fatal(err)
+		}
+		writeFixtures(t, dir, map[string]string{"zone.json": `"a"`})
+		got, err := Dir{Path: dir}.Facts(context.Background())
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected an error with %q, got %v", name, tc.want, err)
+		}
+		// the other facts are still loaded
+		if !reflect.DeepEqual(got, map[string]interface{}{"zone": "a"}) {
+			t.Errorf("%s: expected the facts of the other files, got %v", name, got)
+		}
+	}
+}
+
+func TestCustom(t *testing.T) {
+	first := ProviderFunc(func(context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"role": "worker", "rack": "r1"}, nil
+	})
+	second := ProviderFunc(func(context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"role": "master"}, nil
+	})
+	got, errs := Custom(context.Background(), first, second)
+	if len(errs) != 0 || !reflect.DeepEqual(got, map[string]interface{}{"role": "master", "rack": "r1"}) {
+		t.Fatalf("expected the facts of the last provider to win, got %v %v", got, errs)
+	}
+
+	failing := ProviderFunc(func(context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("cluster manager unreachable")
+	})
+	got, errs = Custom(context.Background(), first, failing)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "unreachable") {
+		t.Fatalf("expected the error of the provider, got %v", errs)
+	}
+	if !reflect.DeepEqual(got, map[string]interface{}{"role": "worker", "rack": "r1"}) {
+		t.Fatalf("expected the facts of the other providers, got %v", got)
+	}
+
+	// each file of a dir has its own error
+	dir := t.TempDir()
+	writeFixtures(t, dir, map[string]string{"node.json": `{"role":`, "rack.json": "r12", "zone.json": `"a"`})
+	got, errs = Custom(context.Background(), Dir{Path: dir})
+	if len(errs) != 2 || !reflect.DeepEqual(got, map[string]interface{}{"zone": "a"}) {
+		t.Fatalf("expected an error for each invalid file, got %v %v", got, errs)
+	}
+}
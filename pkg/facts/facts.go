@@ -0,0 +1,382 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package facts gathers the facts of the local machine: the OS, the kernel, the CPUs, the memory, the mounts,
+// the network interfaces and the current user. They are read from /etc/os-release, /proc and /sys
+package facts
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Facts are the facts of a machine, the field names are used in the templates, e.g. {{ (facts).OS.Family }}
+type Facts struct {
+	OS           OS          `json:"os"`
+	Kernel       string      `json:"kernel"`
+	Architecture string      `json:"architecture"`
+	CPUCount     int         `json:"cpu_count"`
+	MemoryTotal  uint64      `json:"memory_total"`
+	Mounts       []Mount     `json:"mounts"`
+	Interfaces   []Interface `json:"interfaces"`
+	User         User        `json:"user"`
+	// Custom are the facts of the providers, e.g. of a facts.d dir, see Custom
+	Custom map[string]interface{} `json:"custom,omitempty"`
+	// CustomErrors are the errors of the custom facts which could not be loaded, they are missing from Custom
+	CustomErrors []string `json:"custom_errors,omitempty"`
+}
+
+// OS is the distribution from os-release, e.g. ID "ubuntu", VersionID "22.04" and Family "debian"
+// Family is "redhat", "debian" or "suse" for the distributions like them, the ID otherwise
+type OS struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	VersionID string `json:"version_id"`
+	Family    string `json:"family"`
+}
+
+// Mount is a mounted filesystem, the sizes are in bytes and zero when the filesystem can not be stat
+type Mount struct {
+	Device     string `json:"device"`
+	MountPoint string `json:"mount_point"`
+	FSType     string `json:"fs_type"`
+	Total      uint64 `json:"total"`
+	Free       uint64 `json:"free"`
+	Available  uint64 `json:"available"`
+}
+
+// Interface is a network interface with its IPv4 and IPv6 addresses
+type Interface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac"`
+	Up        bool     `json:"up"`
+	Addresses []string `json:"addresses"`
+}
+
+// User is the user running the wizard
+type User struct {
+	Name    string `json:"name"`
+	Uid     string `json:"uid"`
+	Gid     string `json:"gid"`
+	HomeDir string `json:"home_dir"`
+}
+
+// Gatherer gathers the facts from the files under Root, "/" if empty, e.g. a dir with fixtures in the tests
+// Addresses returns the addresses of an interface, the ones of the net pkg if nil, as /sys does not have them
+type Gatherer struct {
+	Root      string
+	Addresses func(name string) ([]string, error)
+}
+
+// Gather returns the facts of the local machine
+func Gather() (*Facts, error) {
+	return Gatherer{}.Gather()
+}
+
+// Gather returns the facts, a machine without os-release has an empty OS
+func (g Gatherer) Gather() (*Facts, error) {
+	facts := &Facts{}
+	var err error
+	if facts.OS, err = g.os(); err != nil {
+		return nil, fmt.Errorf("Gather: %s", err)
+	}
+	kernel, err := g.readFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return nil, fmt.Errorf("Gather: %s", err)
+	}
+	facts.Kernel = strings.TrimSpace(string(kernel))
+	facts.Architecture = g.architecture()
+	if facts.CPUCount, err = g.cpuCount(); err != nil {
+		return nil, fmt.Errorf("Gather: %s", err)
+	}
+	if facts.MemoryTotal, err = g.memoryTotal(); err != nil {
+		return nil, fmt.Errorf("Gather: %s", err)
+	}
+	if facts.Mounts, err = g.mounts(); err != nil {
+		return nil, fmt.Errorf("Gather: %s", err)
+	}
+	if facts.Interfaces, err = g.interfaces(); err != nil {
+		return nil, fmt.Errorf("Gather: %s", err)
+	}
+	if facts.User, err = currentUser(); err != nil {
+		return nil, fmt.Errorf("Gather: %s", err)
+	}
+	return facts, nil
+}
+
+// path returns the path of the name under the root
+func (g Gatherer) path(name string) string {
+	if g.Root == "" {
+		return name
+	}
+	return filepath.Join(g.Root, name)
+}
+
+func (g Gatherer) readFile(name string) ([]byte, error) {
+	return os.ReadFile(g.path(name))
+}
+
+// os parses /etc/os-release, or /usr/lib/os-release which it links to on most distributions
+func (g Gatherer) os() (OS, error) {
+	content, err := g.readFile("/etc/os-release")
+	if errors.Is(err, fs.ErrNotExist) {
+		content, err = g.readFile("/usr/lib/os-release")
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return OS{}, nil
+	} else if err != nil {
+		return OS{}, err
+	}
+	release := parseOSRelease(content)
+	return OS{
+		ID:        release["ID"],
+		Name:      release["NAME"],
+		Version:   release["VERSION"],
+		VersionID: release["VERSION_ID"],
+		Family:    osFamily(release["ID"], release["ID_LIKE"]),
+	}, nil
+}
+
+// parseOSRelease returns the variables of an os-release file, the values are unquoted
+func parseOSRelease(content []byte) map[string]string {
+	release := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		release[key] = value
+	}
+	return release
+}
+
+// osFamily returns the family of the distribution from its ID and ID_LIKE
+func osFamily(id, idLike string) string {
+	for _, like := range append([]string{id}, strings.Fields(idLike)...) {
+		switch like {
+		case "rhel", "fedora", "centos", "rocky", "almalinux", "ol", "amzn":
+			return "redhat"
+		case "debian", "ubuntu":
+			return "debian"
+		case "suse", "sles", "opensuse":
+			return "suse"
+		}
+	}
+	return id
+}
+
+// architecture returns the machine of uname, from /proc/sys/kernel/arch or the GOARCH of the binary on older kernels
+func (g Gatherer) architecture() string {
+	if arch, err := g.readFile("/proc/sys/kernel/arch"); err == nil {
+		return strings.TrimSpace(string(arch))
+	}
+	switch runtime.GOARCH {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	case "386":
+		return "i686"
+	}
+	return runtime.GOARCH
+}
+
+// cpuCount returns the number of online CPUs, from /sys or /proc/cpuinfo
+func (g Gatherer) cpuCount() (int, error) {
+	if online, err := g.readFile("/sys/devices/system/cpu/online"); err == nil {
+		return parseCPUList(strings.TrimSpace(string(online)))
+	}
+	cpuinfo, err := g.readFile("/proc/cpuinfo")
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, line := range strings.Split(string(cpuinfo), "\n") {
+		if key, _, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "processor" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// parseCPUList returns the number of CPUs of a list of the kernel, e.g. "0-3,6"
+func parseCPUList(list string) (int, error) {
+	count := 0
+	for _, part := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		if !isRange {
+			last = first
+		}
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cpu list %q", list)
+		}
+		to, err := strconv.Atoi(last)
+		if err != nil || to < from {
+			return 0, fmt.Errorf("invalid cpu list %q", list)
+		}
+		count += to - from + 1
+	}
+	return count, nil
+}
+
+// memoryTotal returns the MemTotal of /proc/meminfo in bytes
+func (g Gatherer) memoryTotal() (uint64, error) {
+	meminfo, err := g.readFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(meminfo), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid MemTotal %q", line)
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+}
+
+// pseudoFilesystems are the filesystems of the kernel without a size
+var pseudoFilesystems = map[string]bool{
+	"autofs": true, "binfmt_misc": true, "bpf": true, "cgroup": true, "cgroup2": true, "configfs": true,
+	"debugfs": true, "devpts": true, "efivarfs": true, "fusectl": true, "hugetlbfs": true, "mqueue": true,
+	"nsfs": true, "proc": true, "pstore": true, "rpc_pipefs": true, "securityfs": true, "selinuxfs": true,
+	"sysfs": true, "tracefs": true,
+}
+
+// mounts returns the filesystems of /proc/mounts with their sizes
+// The pseudo filesystems, like proc or sysfs, and the ones which can not be stat are left out
+func (g Gatherer) mounts() ([]Mount, error) {
+	content, err := g.readFile("/proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+	mounts := []Mount{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || pseudoFilesystems[fields[2]] {
+			continue
+		}
+		mount := Mount{Device: unescapeMount(fields[0]), MountPoint: unescapeMount(fields[1]), FSType: fields[2]}
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(g.path(mount.MountPoint), &stat); err != nil || stat.Blocks == 0 {
+			continue
+		}
+		mount.Total = stat.Blocks * uint64(stat.Bsize)
+		mount.Free = stat.Bfree * uint64(stat.Bsize)
+		mount.Available = stat.Bavail * uint64(stat.Bsize)
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// unescapeMount unescapes the octal escapes of /proc/mounts, e.g. "\040" for a space
+func unescapeMount(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// interfaces returns the interfaces of /sys/class/net sorted by name
+func (g Gatherer) interfaces() ([]Interface, error) {
+	entries, err := os.ReadDir(g.path("/sys/class/net"))
+	if err != nil {
+		return nil, err
+	}
+	addresses := g.Addresses
+	if addresses == nil {
+		addresses = netAddresses
+	}
+	interfaces := []Interface{}
+	for _, entry := range entries {
+		iface := Interface{Name: entry.Name()}
+		dir := filepath.Join("/sys/class/net", entry.Name())
+		if mac, err := g.readFile(filepath.Join(dir, "address")); err == nil {
+			iface.MAC = strings.TrimSpace(string(mac))
+		}
+		// the loopback and some virtual interfaces have the unknown operstate while being up
+		if flags, err := g.readFile(filepath.Join(dir, "flags")); err == nil {
+			value, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(flags)), "0x"), 16, 32)
+			iface.Up = err == nil && value&syscall.IFF_UP != 0
+		}
+		if iface.Addresses, err = addresses(iface.Name); err != nil {
+			return nil, fmt.Errorf("interface %s: %s", iface.Name, err)
+		}
+		interfaces = append(interfaces, iface)
+	}
+	sort.Slice(interfaces, func(i, j int) bool { return interfaces[i].Name < interfaces[j].Name })
+	return interfaces, nil
+}
+
+// netAddresses returns the addresses of the interface without the prefix length, e.g. "10.0.0.12"
+func netAddresses(name string) ([]string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	addresses := []string{}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			addresses = append(addresses, ipNet.IP.String())
+		}
+	}
+	return addresses, nil
+}
+
+func currentUser() (User, error) {
+	u, err := user.Current()
+	if err != nil {
+		return User{}, err
+	}
+	return User{Name: u.Username, Uid: u.Uid, Gid: u.Gid, HomeDir: u.HomeDir}, nil
+}
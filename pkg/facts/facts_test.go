@@ -0,0 +1,133 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package facts
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// writeFixtures writes the files under the root, the dirs are created
+func writeFixtures(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGather(t *testing.T) {
+	root := t.TempDir()
+	writeFixtures(t, root, map[string]string{
+		"etc/os-release": `NAME="Red Hat Enterprise Linux"
+VERSION="8.6 (Ootpa)"
+# a comment
+ID="rhel"
+ID_LIKE="fedora"
+VERSION_ID="8.6"
+`,
+		"proc/sys/kernel/osrelease":     "4.18.0-372.9.1.el8.x86_64\n",
+		"proc/sys/kernel/arch":          "x86_64\n",
+		"sys/devices/system/cpu/online": "0-3,6\n",
+		"proc/meminfo":                  "MemTotal:       16318412 kB\nMemFree:         1024 kB\n",
+		"proc/mounts":                   "/dev/sda1 / ext4 rw 0 0\nproc /proc proc rw 0 0\n/dev/sdb1 /data\\040disk xfs rw 0 0\n",
+		"data disk/.keep":               "",
+		"sys/class/net/eth0/address":    "52:54:00:12:34:56\n",
+		"sys/class/net/eth0/flags":      "0x1003\n",
+		"sys/class/net/docker0/address": "02:42:ac:11:00:01\n",
+		"sys/class/net/docker0/flags":   "0x1002\n",
+	})
+	gatherer := Gatherer{Root: root, Addresses: func(name string) ([]string, error) {
+		if name == "eth0" {
+			return []string{"10.0.0.12", "fe80::5054:ff:fe12:3456"}, nil
+		}
+		return []string{}, nil
+	}}
+	facts, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantOS := OS{ID: "rhel", Name: "Red Hat Enterprise Linux", Version: "8.6 (Ootpa)", VersionID: "8.6", Family: "redhat"}
+	if facts.OS != wantOS {
+		t.Fatalf("unexpected os %+v", facts.OS)
+	}
+	if facts.Kernel != "4.18.0-372.9.1.el8.x86_64" || facts.Architecture != "x86_64" || facts.CPUCount != 5 || facts.MemoryTotal != 16318412*1024 {
+		t.Fatalf("unexpected facts %+v", facts)
+	}
+	if len(facts.Mounts) != 2 || facts.Mounts[0].MountPoint != "/" || facts.Mounts[1].MountPoint != "/data disk" || facts.Mounts[1].Total == 0 {
+		t.Fatalf("expected the mounts without the pseudo filesystems, got %+v", facts.Mounts)
+	}
+	wantInterfaces := []Interface{
+		{Name: "docker0", MAC: "02:42:ac:11:00:01", Up: false, Addresses: []string{}},
+		{Name: "eth0", MAC: "52:54:00:12:34:56", Up: true, Addresses: []string{"10.0.0.12", "fe80::5054:ff:fe12:3456"}},
+	}
+	if !reflect.DeepEqual(facts.Interfaces, wantInterfaces) {
+		t.Fatalf("unexpected interfaces %+v", facts.Interfaces)
+	}
+	if facts.User.Uid != strconv.Itoa(os.Getuid()) || facts.User.Name == "" {
+		t.Fatalf("unexpected user %+v", facts.User)
+	}
+}
+
+func TestGatherFallbacks(t *testing.T) {
+	root := t.TempDir()
+	// no os-release, no /sys cpu list and no arch, like in a minimal container on an older kernel
+	writeFixtures(t, root, map[string]string{
+		"proc/sys/kernel/osrelease": "3.10.0\n",
+		"proc/cpuinfo":              "processor\t: 0\nmodel name\t: x\n\nprocessor\t: 1\nmodel name\t: x\n",
+		"proc/meminfo":              "MemTotal: 1024 kB\n",
+		"proc/mounts":               "",
+	})
+	if err := os.MkdirAll(filepath.Join(root, "sys/class/net"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	facts, err := Gatherer{Root: root}.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if facts.OS != (OS{}) || facts.CPUCount != 2 || facts.Architecture == "" || len(facts.Mounts) != 0 || len(facts.Interfaces) != 0 {
+		t.Fatalf("unexpected facts %+v", facts)
+	}
+
+	if _, err := (Gatherer{Root: t.TempDir()}).Gather(); err == nil {
+		t.Fatal("expected an error without /proc")
+	}
+}
+
+func TestOSFamily(t *testing.T) {
+	tests := []struct {
+		id, idLike, want string
+	}{
+		{"ubuntu", "debian", "debian"},
+		{"debian", "", "debian"},
+		{"centos", "rhel fedora", "redhat"},
+		{"rocky", "rhel centos fedora", "redhat"},
+		{"sles", "suse", "suse"},
+		{"alpine", "", "alpine"},
+	}
+	for _, tc := range tests {
+		if got := osFamily(tc.id, tc.idLike); got != tc.want {
+			t.Errorf("osFamily(%q, %q) = %q, want %q", tc.id, tc.idLike, got, tc.want)
+		}
+	}
+}
@@ -20,37 +20,105 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Register struct {
-	Changed  bool
-	StdOut   string
-	StdErr   string
-	ExitCode int
+	Changed  bool   `json:"changed"`
+	StdOut   string `json:"stdout"`
+	StdErr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	// Diff is the unified diff of the files changed by copy and template when the diff option is enabled
+	Diff string `json:"diff,omitempty"`
+	// Attempts are the results of each run of the action, an action with retries can run more than once
+	Attempts []Attempt `json:"attempts,omitempty"`
+	// Results are the registers of the iterations of an action with a loop, in the order of the items
+	Results []*Register `json:"results,omitempty"`
+	// Skipped is set when the action did not run, excluded by the tag or task filters of the run
+	Skipped bool `json:"skipped,omitempty"`
+	// Failed is set on the register of a block when one of its actions failed, FailedAction is its name
+	// StdErr and ExitCode are the error and the exit code of the failed action
+	Failed       bool   `json:"failed,omitempty"`
+	FailedAction string `json:"failed_action,omitempty"`
 }
 
-var RMap = make(map[string]*Register)
+// Attempt is the result of one run of an action
+type Attempt struct {
+	Changed  bool   `json:"changed"`
+	StdOut   string `json:"stdout"`
+	StdErr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+	// Err is the error returned by the action or the until condition not met, empty on success
+	Err string `json:"error,omitempty"`
+}
+
+// Store holds the registers of a run, each task.Task run has its own store
+// It is safe for concurrent use, tasks without dependencies between them run concurrently
+type Store struct {
+	mu        sync.RWMutex
+	registers map[string]*Register
+}
+
+// NewStore returns an empty Store
+func NewStore() *Store {
+	return &Store{registers: make(map[string]*Register)}
+}
+
+// Get returns the register stored with the name, nil if not found
+func (s *Store) Get(name string) *Register {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.registers[name]
+}
+
+// Set stores the register with the name
+func (s *Store) Set(name string, r *Register) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registers[name] = r
+}
+
+// All returns a copy of the map of the registers by name
+func (s *Store) All() map[string]*Register {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make(map[string]*Register, len(s.registers))
+	for name, r := range s.registers {
+		all[name] = r
+	}
+	return all
+}
 
-func Reset() {
-	for k := range RMap {
-		delete(RMap, k)
+// Reset removes all the registers
+func (s *Store) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.registers {
+		delete(s.registers, k)
 	}
 }
 
-func ParseRegisterExp(exp string) (bool, error) {
+// ParseRegisterExp evaluates the expression with the registers of the store
+func (s *Store) ParseRegisterExp(exp string) (bool, error) {
 	tokens := strings.Split(exp, " ")
 	rStack := newRegisterStack()
 
 	for _, token := range tokens {
-		subTokens := strings.Split(token, ".")
-		if len(subTokens) != 2 && len(subTokens) == 1 {
+		// the field follows the last dot, the register name of an included file has the namespace as prefix
+		dot := strings.LastIndex(token, ".")
+		if dot < 0 {
 			// Check for logical operators - and, or, not, eq
-			if !pushRegisterOperator(rStack, subTokens[0]) {
-				pushAny(rStack, subTokens[0])
+			if !pushRegisterOperator(rStack, token) {
+				pushAny(rStack, token)
 			}
-		} else if len(subTokens) == 2 {
-			if !pushRegisterVal(rStack, subTokens[0], subTokens[1]) {
-				return false, fmt.Errorf("invalid register field %q", subTokens[1])
+		} else if dot > 0 {
+			name, field := token[:dot], token[dot+1:]
+			r := s.Get(name)
+			if r == nil {
+				return false, fmt.Errorf("register %q not found", name)
+			}
+			if !pushRegisterVal(rStack, r, field) {
+				return false, fmt.Errorf("invalid register field %q", field)
 			}
 		} else {
 			return false, fmt.Errorf("invalid register field %q", token)
@@ -137,19 +205,28 @@ func pushRegisterOperator(rStack *stack, rField string) bool {
 	return false
 }
 
-func pushRegisterVal(rStack *stack, rKey string, rField string) bool {
+func pushRegisterVal(rStack *stack, r *Register, rField string) bool {
 	switch rField {
 	case "changed":
-		rStack.push("bool", strconv.FormatBool(RMap[rKey].Changed))
+		rStack.push("bool", strconv.FormatBool(r.Changed))
 		return true
 	case "stdout":
-		rStack.push("string", RMap[rKey].StdOut)
+		rStack.push("string", r.StdOut)
 		return true
 	case "stderr":
-		rStack.push("string", RMap[rKey].StdErr)
+		rStack.push("string", r.StdErr)
 		return true
 	case "exit_code":
-		rStack.push("int", strconv.FormatInt(int64(RMap[rKey].ExitCode), 10))
+		rStack.push("int", strconv.FormatInt(int64(r.ExitCode), 10))
+		return true
+	case "attempts":
+		rStack.push("int", strconv.Itoa(len(r.Attempts)))
+		return true
+	case "skipped":
+		rStack.push("bool", strconv.FormatBool(r.Skipped))
+		return true
+	case "failed":
+		rStack.push("bool", strconv.FormatBool(r.Failed))
 		return true
 	}
 	return false
@@ -0,0 +1,149 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// generator builds the schemas of the Go types, the structs are shared in defs
+type generator struct {
+	defs map[string]interface{}
+}
+
+func newGenerator() *generator {
+	return &generator{defs: make(map[string]interface{})}
+}
+
+func ref(def string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/$defs/" + def}
+}
+
+// defName returns the snake case name of the type, e.g. "file_info" for fileInfo
+func defName(t reflect.Type) string {
+	var name strings.Builder
+	for i, r := range t.Name() {
+		if unicode.IsUpper(r) && i > 0 {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToLower(r))
+	}
+	return name.String()
+}
+
+// typeSchema returns the schema of a type, a struct is added to the defs and referenced
+// When templated is set the non string scalars also accept a template string, e.g. "{{ .Force }}"
+func (g *generator) typeSchema(t reflect.Type, templated bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var schema map[string]interface{}
+	switch t.Kind() {
+	case reflect.Struct:
+		def := defName(t)
+		if _, ok := g.defs[def]; !ok {
+			g.defs[def] = map[string]interface{}{}
+			g.defs[def] = g.structSchema(t, templated)
+		}
+		return ref(def)
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem(), templated)}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem(), templated)}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	default:
+		// interface{} accepts any value
+		return map[string]interface{}{}
+	}
+	if templated {
+		return map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "string", "pattern": `\{\{`}}}
+	}
+	return schema
+}
+
+// structSchema returns the schema of the JSON fields of a struct, the fields without a json tag are not part of the JSON
+// The validate tags "required", "required_if=Field value" and "oneof=a b" are translated to the schema
+func (g *generator) structSchema(t reflect.Type, templated bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+	jsonNames := make(map[string]string)
+	// requiredIf are the required fields by condition, e.g. "state=present"
+	requiredIf := make(map[string][]string)
+	var conditions []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		jsonNames[field.Name] = name
+		property := g.typeSchema(field.Type, templated)
+
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			switch {
+			case rule == "required":
+				required = append(required, name)
+			case strings.HasPrefix(rule, "required_if="):
+				condition := strings.TrimPrefix(rule, "required_if=")
+				if _, ok := requiredIf[condition]; !ok {
+					conditions = append(conditions, condition)
+				}
+				requiredIf[condition] = append(requiredIf[condition], name)
+			case strings.HasPrefix(rule, "oneof="):
+				property = map[string]interface{}{"enum": strings.Fields(strings.TrimPrefix(rule, "oneof="))}
+			}
+		}
+		properties[name] = property
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	var allOf []interface{}
+	for _, condition := range conditions {
+		fields := strings.Fields(condition)
+		if len(fields) != 2 {
+			continue
+		}
+		name := jsonNames[fields[0]]
+		allOf = append(allOf, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{name: map[string]interface{}{"const": fields[1]}},
+				"required":   []string{name},
+			},
+			"then": map[string]interface{}{"required": requiredIf[condition]},
+		})
+	}
+	if len(allOf) > 0 {
+		schema["allOf"] = allOf
+	}
+	return schema
+}
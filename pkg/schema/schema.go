@@ -0,0 +1,89 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema generates the JSON Schema of the wizard DSL from the Go structs of the config and their validate tags
+package schema
+
+import (
+	_ "embed"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/actions"
+)
+
+//go:generate go test -run TestSchemaDrift -update
+
+// JSON is the generated JSON Schema of the wizard DSL, it is kept in sync with Generate by the tests
+//
+//go:embed wizard.schema.json
+var JSON []byte
+
+const (
+	draft = "https://json-schema.org/draft/2020-12/schema"
+	id    = "https://github.com/acceldata-io/wizard/pkg/schema/wizard.schema.json"
+)
+
+// Generate returns the JSON Schema of the task list JSON
+// The action_var of the built-in actions is validated with the schema of its action, the action_var of
+// the other actions is an object, non string fields of an action_var also accept a template string
+func Generate() ([]byte, error) {
+	g := newGenerator()
+	root := g.structSchema(reflect.TypeOf(parser.TaskList{}), false)
+	root["$schema"] = draft
+	root["$id"] = id
+	root["title"] = "wizard task list"
+	// the top level "x-" fields are ignored, e.g. to hold the YAML anchors
+	root["patternProperties"] = map[string]interface{}{"^x-": map[string]interface{}{}}
+
+	vars := actions.ActionVars()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var conditions []interface{}
+	for _, name := range names {
+		def := name + "_vars"
+		g.defs[def] = g.structSchema(reflect.TypeOf(vars[name]), true)
+		conditions = append(conditions, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"action": map[string]interface{}{"const": name}},
+				"required":   []string{"action"},
+			},
+			"then": map[string]interface{}{
+				"properties": map[string]interface{}{"action_var": ref(def)},
+				"required":   []string{"action_var"},
+			},
+		})
+	}
+	conditions = append(conditions, map[string]interface{}{
+		"if": map[string]interface{}{
+			"properties": map[string]interface{}{"action": map[string]interface{}{"const": "cmd"}},
+			"required":   []string{"action"},
+		},
+		"then": map[string]interface{}{
+			"properties": map[string]interface{}{"command": map[string]interface{}{"minItems": 1}},
+			"required":   []string{"command"},
+		},
+	})
+	action := g.defs[defName(reflect.TypeOf(parser.Action{}))].(map[string]interface{})
+	action["allOf"] = conditions
+
+	root["$defs"] = g.defs
+	return json.MarshalIndent(root, "", "  ")
+}
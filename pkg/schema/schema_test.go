@@ -0,0 +1,121 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var update = flag.Bool("update", false, "update wizard.schema.json")
+
+// TestSchemaDrift fails when the shipped schema is not the one generated from the structs, run go generate to update it
+func TestSchemaDrift(t *testing.T) {
+	generated, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated = append(generated, '\n')
+	if *update {
+		if err := os.WriteFile("wizard.schema.json", generated, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if !bytes.Equal(generated, JSON) {
+		t.Fatal("wizard.schema.json is out of date, run: go generate ./pkg/schema")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+			AllOf      []json.RawMessage          `json:"allOf"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(JSON, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, property := range []string{"tasks", "priority", "depends_on", "handlers", "flush_handlers", "task_tags"} {
+		if _, ok := schema.Properties[property]; !ok {
+			t.Fatalf("expected the property %s", property)
+		}
+	}
+	if required := schema.Defs["action"].Required; !reflect.DeepEqual(required, []string{"action", "name"}) {
+		t.Fatalf("unexpected required action fields: %v", required)
+	}
+	if _, ok := schema.Defs["action"].Properties["BackupSrc"]; ok {
+		t.Fatal("expected the fields without a json tag to be excluded")
+	}
+	if len(schema.Defs["action"].AllOf) != 6 {
+		t.Fatalf("expected a condition per built-in action, got %d", len(schema.Defs["action"].AllOf))
+	}
+	if required := schema.Defs["copy_vars"].Required; !reflect.DeepEqual(required, []string{"src_type", "src", "dest", "permission", "owner", "group"}) {
+		t.Fatalf("unexpected required copy fields: %v", required)
+	}
+	if len(schema.Defs["user_vars"].AllOf) != 1 || !bytes.Contains(schema.Defs["user_vars"].AllOf[0], []byte(`"required": [`)) {
+		t.Fatalf("expected the required_if fields of user, got: %s", schema.Defs["user_vars"].AllOf)
+	}
+	if force := string(schema.Defs["copy_vars"].Properties["force"]); !bytes.Contains([]byte(force), []byte(`"anyOf"`)) {
+		t.Fatalf("expected force to accept a template, got: %s", force)
+	}
+}
+
+func TestSchemaValidatesConfigs(t *testing.T) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	if err := compiler.AddResource(id, bytes.NewReader(JSON)); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compiler.Compile(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob("../../testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var config interface{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			t.Fatal(err)
+		}
+		if err := schema.Validate(config); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+	}
+
+	var invalid interface{}
+	_ = json.Unmarshal([]byte(`{"tasks": {"a": [{"action": "user", "name": "create", "action_var": {"name": "agent", "state": "present"}}]}, "priority": ["a"]}`), &invalid)
+	if err := schema.Validate(invalid); err == nil {
+		t.Fatal("expected the missing user fields to be reported")
+	}
+}
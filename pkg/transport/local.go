@@ -0,0 +1,110 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/user"
+
+	command "github.com/acceldata-io/goutils/shellutils/cmd"
+)
+
+// Local is the Transport of the machine running wizard, it is used when no Transport is set
+var Local Transport = local{}
+
+type local struct{}
+
+func (local) Run(ctx context.Context, name string, args ...string) (*Result, error) {
+	cmd, err := command.New(ctx, name, args).Run()
+	if err != nil {
+		return nil, err
+	}
+	return &Result{StdOut: cmd.Status.StdOut, StdErr: cmd.Status.StdErr, ExitCode: cmd.Status.ExitCode}, nil
+}
+
+func (local) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (local) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (local) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (local) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (local) ReadDir(name string) ([]fs.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (local) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (local) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (local) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (local) CreateTemp(dir, pattern string) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+func (local) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (local) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (local) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (local) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+func (local) Lchown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
+
+func (local) LookupUser(username string) (*user.User, error) {
+	return user.Lookup(username)
+}
+
+func (local) LookupGroup(name string) (*user.Group, error) {
+	return user.LookupGroup(name)
+}
+
+func (local) Close() error {
+	return nil
+}
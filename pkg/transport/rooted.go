@@ -0,0 +1,281 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// rooted is a Transport resolving the paths under a root dir of the target
+type rooted struct {
+	target Transport
+	root   string
+}
+
+// maxSymlinks is the number of symlinks followed to resolve a path, like the kernel
+const maxSymlinks = 40
+
+// Rooted returns a Transport resolving every path under the root dir of the target, like a chroot
+// Every element of a path is resolved under the root, an absolute symlink or a ".." can not leave it
+// The users and groups are looked up in the etc/passwd and etc/group files of the root
+// The commands are not run under the root. A symlink keeps its target
+func Rooted(target Transport, root string) Transport {
+	return &rooted{target: target, root: filepath.Clean(root)}
+}
+
+// Root returns the root dir of a Transport returned by Rooted, an empty string for any other Transport
+func Root(target Transport) string {
+	if r, ok := target.(*rooted); ok {
+		return r.root
+	}
+	return ""
+}
+
+// path returns the path of the name on the target with all its symlinks resolved under the root
+func (r *rooted) path(name string) (string, error) {
+	return r.resolve(name, true)
+}
+
+// lpath returns the path of the name on the target with the symlinks of its dirs resolved under the root,
+// its last element is not followed, e.g. to remove a symlink
+func (r *rooted) lpath(name string) (string, error) {
+	return r.resolve(name, false)
+}
+
+// resolve walks the elements of the name under the root and replaces every symlink by its target under the root,
+// a ".." goes up from the path resolved so far and stops at the root
+func (r *rooted) resolve(name string, follow bool) (string, error) {
+	pending := strings.Split(filepath.Clean("/"+name), "/")
+	resolved := "/"
+	links := 0
+	for len(pending) > 0 {
+		elem := pending[0]
+		pending = pending[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, elem)
+		if len(pending) == 0 && !follow {
+			resolved = next
+			break
+		}
+		info, err := r.target.Lstat(filepath.Join(r.root, next))
+		if errors.Is(err, fs.ErrNotExist) {
+			// the elements after a missing one are still resolved, a ".." can lead back to a symlink
+			resolved = next
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", &fs.PathError{Op: "resolve", Path: filepath.Join(r.root, name), Err: syscall.ELOOP}
+		}
+		link, err := r.target.Readlink(filepath.Join(r.root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(link) {
+			resolved = "/"
+		}
+		pending = append(strings.Split(link, "/"), pending...)
+	}
+	return filepath.Join(r.root, filepath.Clean("/"+resolved)), nil
+}
+
+func (r *rooted) Run(ctx context.Context, name string, args ...string) (*Result, error) {
+	return r.target.Run(ctx, name, args...)
+}
+
+func (r *rooted) ReadFile(name string) ([]byte, error) {
+	path, err := r.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.target.ReadFile(path)
+}
+
+func (r *rooted) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	path, err := r.path(name)
+	if err != nil {
+		return err
+	}
+	return r.target.WriteFile(path, data, perm)
+}
+
+func (r *rooted) Stat(name string) (fs.FileInfo, error) {
+	path, err := r.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.target.Stat(path)
+}
+
+func (r *rooted) Lstat(name string) (fs.FileInfo, error) {
+	path, err := r.lpath(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.target.Lstat(path)
+}
+
+func (r *rooted) ReadDir(name string) ([]fs.FileInfo, error) {
+	path, err := r.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.target.ReadDir(path)
+}
+
+func (r *rooted) Readlink(name string) (string, error) {
+	path, err := r.lpath(name)
+	if err != nil {
+		return "", err
+	}
+	return r.target.Readlink(path)
+}
+
+func (r *rooted) Symlink(oldname, newname string) error {
+	path, err := r.lpath(newname)
+	if err != nil {
+		return err
+	}
+	return r.target.Symlink(oldname, path)
+}
+
+func (r *rooted) MkdirAll(name string, perm fs.FileMode) error {
+	path, err := r.path(name)
+	if err != nil {
+		return err
+	}
+	return r.target.MkdirAll(path, perm)
+}
+
+// CreateTemp returns the name of the temp file under the root
+func (r *rooted) CreateTemp(dir, pattern string) (string, error) {
+	if dir == "" {
+		dir = "/tmp"
+	}
+	path, err := r.path(dir)
+	if err != nil {
+		return "", err
+	}
+	name, err := r.target.CreateTemp(path, pattern)
+	if err != nil {
+		return "", err
+	}
+	return "/" + strings.TrimPrefix(strings.TrimPrefix(name, r.root), "/"), nil
+}
+
+func (r *rooted) Remove(name string) error {
+	path, err := r.lpath(name)
+	if err != nil {
+		return err
+	}
+	return r.target.Remove(path)
+}
+
+func (r *rooted) RemoveAll(name string) error {
+	path, err := r.lpath(name)
+	if err != nil {
+		return err
+	}
+	return r.target.RemoveAll(path)
+}
+
+func (r *rooted) Chmod(name string, mode fs.FileMode) error {
+	path, err := r.path(name)
+	if err != nil {
+		return err
+	}
+	return r.target.Chmod(path, mode)
+}
+
+func (r *rooted) Chown(name string, uid, gid int) error {
+	path, err := r.path(name)
+	if err != nil {
+		return err
+	}
+	return r.target.Chown(path, uid, gid)
+}
+
+func (r *rooted) Lchown(name string, uid, gid int) error {
+	path, err := r.lpath(name)
+	if err != nil {
+		return err
+	}
+	return r.target.Lchown(path, uid, gid)
+}
+
+// LookupUser looks up the user in the etc/passwd file of the root
+func (r *rooted) LookupUser(username string) (*user.User, error) {
+	fields, err := r.lookup("/etc/passwd", username, 7)
+	if err != nil {
+		return nil, err
+	} else if fields == nil {
+		return nil, user.UnknownUserError(username)
+	}
+	return &user.User{
+		Username: fields[0],
+		Uid:      fields[2],
+		Gid:      fields[3],
+		Name:     strings.SplitN(fields[4], ",", 2)[0],
+		HomeDir:  fields[5],
+	}, nil
+}
+
+// LookupGroup looks up the group in the etc/group file of the root
+func (r *rooted) LookupGroup(name string) (*user.Group, error) {
+	fields, err := r.lookup("/etc/group", name, 4)
+	if err != nil {
+		return nil, err
+	} else if fields == nil {
+		return nil, user.UnknownGroupError(name)
+	}
+	return &user.Group{Name: fields[0], Gid: fields[2]}, nil
+}
+
+// lookup returns the fields of the line of the file starting with the name, nil if not found
+func (r *rooted) lookup(file, name string, n int) ([]string, error) {
+	content, err := r.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("lookup: unable to read file - %s - %s", filepath.Join(r.root, file), err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) == n && fields[0] == name {
+			return fields, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *rooted) Close() error {
+	return r.target.Close()
+}
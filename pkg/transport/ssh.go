@@ -0,0 +1,442 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os/user"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHConfig is the address of a remote machine and the credentials of the user wizard logs in with
+type SSHConfig struct {
+	// Host is the host name or the IP of the machine, with an optional port, 22 by default
+	Host string
+	User string
+	// Password and PrivateKey, a PEM encoded key, are tried in this order, at least one is required
+	Password   string
+	PrivateKey []byte
+	// HostKeyCallback verifies the host key of the machine, e.g. ssh.FixedHostKey or knownhosts.New
+	HostKeyCallback ssh.HostKeyCallback
+	// Timeout is the timeout of the connection, 30 seconds by default
+	Timeout time.Duration
+}
+
+// SSH is the Transport of a remote machine, every call runs a command in a new session of the connection
+// The files are accessed with the POSIX shell and the coreutils of the machine, the users with getent
+type SSH struct {
+	client *ssh.Client
+}
+
+// DialSSH connects to the machine, the SSH should be closed once the tasks are performed
+func DialSSH(config SSHConfig) (*SSH, error) {
+	if config.HostKeyCallback == nil {
+		return nil, fmt.Errorf("DialSSH: HostKeyCallback is required")
+	}
+	var auth []ssh.AuthMethod
+	if config.Password != "" {
+		auth = append(auth, ssh.Password(config.Password))
+	}
+	if len(config.PrivateKey) > 0 {
+		signer, err := ssh.ParsePrivateKey(config.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("DialSSH: invalid private key - %s", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("DialSSH: Password or PrivateKey is required")
+	}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	addr := config.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            auth,
+		HostKeyCallback: config.HostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DialSSH: unable to connect to %s - %s", addr, err)
+	}
+	return &SSH{client: client}, nil
+}
+
+// Run runs the command with its arguments quoted for the shell of the remote user
+func (s *SSH) Run(ctx context.Context, name string, args ...string) (*Result, error) {
+	return s.run(ctx, shellCommand(name, args...), nil)
+}
+
+// run runs the shell command line in a new session, the session is closed once the ctx is cancelled
+func (s *SSH) run(ctx context.Context, cmd string, stdin io.Reader) (*Result, error) {
+	session, err := s.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("ssh: unable to open a session - %s", err)
+	}
+	defer session.Close()
+	var stdout, stderr bytes.Buffer
+	session.Stdin = stdin
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(cmd)
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGKILL)
+		session.Close()
+		return nil, fmt.Errorf("ssh: command interrupted - %w", ctx.Err())
+	}
+
+	result := &Result{StdOut: stdout.String(), StdErr: stderr.String()}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitStatus()
+	} else if err != nil {
+		return nil, fmt.Errorf("ssh: unable to run the command - %s", err)
+	}
+	return result, nil
+}
+
+// file runs a shell command on the file name, a failed command returns a *fs.PathError
+func (s *SSH) file(op, name, cmd string, stdin io.Reader) (*Result, error) {
+	result, err := s.run(context.Background(), "export LC_ALL=C; "+cmd, stdin)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if result.ExitCode != 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: commandError(result.StdErr)}
+	}
+	return result, nil
+}
+
+func (s *SSH) ReadFile(name string) ([]byte, error) {
+	result, err := s.file("open", name, "cat -- "+quote(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result.StdOut), nil
+}
+
+// WriteFile truncates an existing file, a new file is created with the perm
+func (s *SSH) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	q := quote(name)
+	_, err := s.file("open", name, fmt.Sprintf("if [ -e %s ]; then cat > %s; else cat > %s && chmod %s %s; fi", q, q, q, unixMode(perm), q), bytes.NewReader(data))
+	return err
+}
+
+// statFormat is the format of the stat command parsed by parseStat
+const statFormat = "'%f %s %Y %u %g %n'"
+
+func (s *SSH) Stat(name string) (fs.FileInfo, error) {
+	return s.stat("stat", name, "stat -L -c "+statFormat+" -- "+quote(name))
+}
+
+func (s *SSH) Lstat(name string) (fs.FileInfo, error) {
+	return s.stat("lstat", name, "stat -c "+statFormat+" -- "+quote(name))
+}
+
+func (s *SSH) stat(op, name, cmd string) (fs.FileInfo, error) {
+	result, err := s.file(op, name, cmd, nil)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseStat(strings.TrimSuffix(result.StdOut, "\n"))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// ReadDir returns the entries of the dir sorted by name, the names with a new line are not supported
+func (s *SSH) ReadDir(name string) ([]fs.FileInfo, error) {
+	result, err := s.file("readdirent", name, "find "+quote(name)+" -mindepth 1 -maxdepth 1 -exec stat -c "+statFormat+" {} +", nil)
+	if err != nil {
+		return nil, err
+	}
+	var infos []fs.FileInfo
+	for _, line := range strings.Split(result.StdOut, "\n") {
+		if line == "" {
+			continue
+		}
+		info, err := parseStat(line)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdirent", Path: name, Err: err}
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (s *SSH) Readlink(name string) (string, error) {
+	result, err := s.file("readlink", name, "readlink -- "+quote(name), nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(result.StdOut, "\n"), nil
+}
+
+func (s *SSH) Symlink(oldname, newname string) error {
+	if _, err := s.Lstat(newname); err == nil {
+		return &fs.PathError{Op: "symlink", Path: newname, Err: fs.ErrExist}
+	}
+	_, err := s.file("symlink", newname, "ln -s -- "+quote(oldname)+" "+quote(newname), nil)
+	return err
+}
+
+func (s *SSH) MkdirAll(dir string, perm fs.FileMode) error {
+	_, err := s.file("mkdir", dir, "mkdir -p -m "+unixMode(perm)+" -- "+quote(dir), nil)
+	return err
+}
+
+func (s *SSH) CreateTemp(dir, pattern string) (string, error) {
+	if dir == "" {
+		dir = "/tmp"
+	}
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for try := 0; try < 10; try++ {
+		random := make([]byte, 6)
+		if _, err := rand.Read(random); err != nil {
+			return "", err
+		}
+		name := path.Join(dir, prefix+hex.EncodeToString(random)+suffix)
+		// noclobber fails if the file already exists
+		if _, err := s.file("createtemp", name, "set -C && : > "+quote(name), nil); err == nil {
+			return name, nil
+		} else if _, statErr := s.Lstat(name); statErr != nil {
+			return "", err
+		}
+	}
+	return "", &fs.PathError{Op: "createtemp", Path: path.Join(dir, pattern), Err: fs.ErrExist}
+}
+
+func (s *SSH) Remove(name string) error {
+	if _, err := s.Lstat(name); err != nil {
+		return err
+	}
+	_, err := s.file("remove", name, "rm -d -- "+quote(name), nil)
+	return err
+}
+
+func (s *SSH) RemoveAll(dir string) error {
+	_, err := s.file("unlinkat", dir, "rm -rf -- "+quote(dir), nil)
+	return err
+}
+
+func (s *SSH) Chmod(name string, mode fs.FileMode) error {
+	_, err := s.file("chmod", name, "chmod "+unixMode(mode)+" -- "+quote(name), nil)
+	return err
+}
+
+func (s *SSH) Chown(name string, uid, gid int) error {
+	_, err := s.file("chown", name, fmt.Sprintf("chown %d:%d -- %s", uid, gid, quote(name)), nil)
+	return err
+}
+
+func (s *SSH) Lchown(name string, uid, gid int) error {
+	_, err := s.file("lchown", name, fmt.Sprintf("chown -h %d:%d -- %s", uid, gid, quote(name)), nil)
+	return err
+}
+
+// LookupUser looks up the user with getent, an unknown user returns a user.UnknownUserError
+func (s *SSH) LookupUser(username string) (*user.User, error) {
+	fields, err := s.getent("passwd", username, 7)
+	if err != nil {
+		return nil, err
+	} else if fields == nil {
+		return nil, user.UnknownUserError(username)
+	}
+	return &user.User{
+		Username: fields[0],
+		Uid:      fields[2],
+		Gid:      fields[3],
+		Name:     strings.SplitN(fields[4], ",", 2)[0],
+		HomeDir:  fields[5],
+	}, nil
+}
+
+// LookupGroup looks up the group with getent, an unknown group returns a user.UnknownGroupError
+func (s *SSH) LookupGroup(name string) (*user.Group, error) {
+	fields, err := s.getent("group", name, 4)
+	if err != nil {
+		return nil, err
+	} else if fields == nil {
+		return nil, user.UnknownGroupError(name)
+	}
+	return &user.Group{Name: fields[0], Gid: fields[2]}, nil
+}
+
+// getent returns the fields of the entry of the database, nil if the key is not found
+func (s *SSH) getent(database, key string, n int) ([]string, error) {
+	result, err := s.Run(context.Background(), "getent", database, key)
+	if err != nil {
+		return nil, fmt.Errorf("getent: %s", err)
+	}
+	if result.ExitCode == 2 {
+		return nil, nil
+	} else if result.ExitCode != 0 {
+		return nil, fmt.Errorf("getent %s %s: exit code %d - %s", database, key, result.ExitCode, strings.TrimSpace(result.StdErr))
+	}
+	line := strings.SplitN(result.StdOut, "\n", 2)[0]
+	fields := strings.Split(line, ":")
+	if len(fields) != n {
+		return nil, fmt.Errorf("getent %s %s: unexpected entry %q", database, key, line)
+	}
+	return fields, nil
+}
+
+// Close closes the connection
+func (s *SSH) Close() error {
+	return s.client.Close()
+}
+
+// shellCommand returns the command line of the command with all its words quoted
+func shellCommand(name string, args ...string) string {
+	words := make([]string, 0, len(args)+1)
+	for _, word := range append([]string{name}, args...) {
+		words = append(words, quote(word))
+	}
+	return strings.Join(words, " ")
+}
+
+// quote quotes the word for a POSIX shell
+func quote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// commandError returns the fs error matching the error message of a coreutils command
+func commandError(stderr string) error {
+	msg := strings.TrimSpace(stderr)
+	switch {
+	case strings.Contains(msg, "No such file or directory"):
+		return fs.ErrNotExist
+	case strings.Contains(msg, "File exists"), strings.Contains(msg, "cannot overwrite existing file"):
+		return fs.ErrExist
+	case strings.Contains(msg, "Permission denied"), strings.Contains(msg, "Operation not permitted"):
+		return fs.ErrPermission
+	case msg == "":
+		return errors.New("command failed")
+	}
+	return errors.New(msg)
+}
+
+// unixMode returns the octal mode of the chmod command
+func unixMode(mode fs.FileMode) string {
+	m := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= 0o1000
+	}
+	return fmt.Sprintf("%04o", m)
+}
+
+// fileInfo is the fs.FileInfo of a remote file
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	stat    Stat
+}
+
+func (f *fileInfo) Name() string       { return f.name }
+func (f *fileInfo) Size() int64        { return f.size }
+func (f *fileInfo) Mode() fs.FileMode  { return f.mode }
+func (f *fileInfo) ModTime() time.Time { return f.modTime }
+func (f *fileInfo) IsDir() bool        { return f.mode.IsDir() }
+func (f *fileInfo) Sys() interface{}   { return &f.stat }
+
+// parseStat parses a line of the stat command with the statFormat: raw mode in hex, size, mtime, uid, gid and name
+func parseStat(line string) (*fileInfo, error) {
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("unexpected stat output %q", line)
+	}
+	var numbers [5]uint64
+	for i, base := range []int{16, 10, 10, 10, 10} {
+		n, err := strconv.ParseUint(fields[i], base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected stat output %q", line)
+		}
+		numbers[i] = n
+	}
+	return &fileInfo{
+		name:    path.Base(fields[5]),
+		size:    int64(numbers[1]),
+		mode:    fileMode(uint32(numbers[0])),
+		modTime: time.Unix(int64(numbers[2]), 0),
+		stat:    Stat{Uid: uint32(numbers[3]), Gid: uint32(numbers[4])},
+	}, nil
+}
+
+// fileMode converts the st_mode of a file to a fs.FileMode
+func fileMode(m uint32) fs.FileMode {
+	mode := fs.FileMode(m & 0o777)
+	switch m & 0o170000 {
+	case 0o040000:
+		mode |= fs.ModeDir
+	case 0o120000:
+		mode |= fs.ModeSymlink
+	case 0o010000:
+		mode |= fs.ModeNamedPipe
+	case 0o140000:
+		mode |= fs.ModeSocket
+	case 0o020000:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case 0o060000:
+		mode |= fs.ModeDevice
+	}
+	if m&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
@@ -0,0 +1,187 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sshtest provides an in-process SSH server to test the SSH transport
+// It runs the commands of the sessions on the local machine with sh, as the user running the tests
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"sync"
+
+	"github.com/acceldata-io/wizard/pkg/transport"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// User and Password are the credentials accepted by the server
+	User     = "wizard"
+	Password = "wizard"
+)
+
+// Server is an SSH server listening on a local port
+type Server struct {
+	// Addr is the host:port of the server
+	Addr string
+	// HostKey is the public key of the server
+	HostKey ssh.PublicKey
+
+	listener net.Listener
+	config   *ssh.ServerConfig
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a random local port, it should be closed with Close
+func NewServer() (*Server, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("NewServer: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("NewServer: %s", err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == User && string(password) == Password {
+				return nil, nil
+			}
+			return nil, errors.New("invalid credentials")
+		},
+	}
+	config.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("NewServer: %s", err)
+	}
+	s := &Server{Addr: listener.Addr().String(), HostKey: signer.PublicKey(), listener: listener, config: config}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Config returns the config to connect to the server
+func (s *Server) Config() transport.SSHConfig {
+	return transport.SSHConfig{
+		Host:            s.Addr,
+		User:            User,
+		Password:        Password,
+		HostKeyCallback: ssh.FixedHostKey(s.HostKey),
+	}
+}
+
+// Close stops the server, the open connections are closed by their clients
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go handleSession(channel, requests)
+	}
+}
+
+// handleSession runs the command of the exec request and sends its exit status, a signal request kills it
+func handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	var cmd *exec.Cmd
+	done := make(chan struct{})
+	for req := range requests {
+		switch req.Type {
+		case "exec":
+			if cmd != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			cmd = exec.Command("sh", "-c", payload.Command)
+			cmd.Stdin = channel
+			cmd.Stdout = channel
+			cmd.Stderr = channel.Stderr()
+			if err := cmd.Start(); err != nil {
+				_ = req.Reply(false, nil)
+				return
+			}
+			_ = req.Reply(true, nil)
+			go func() {
+				defer close(done)
+				exitCode := 0
+				var exitErr *exec.ExitError
+				if err := cmd.Wait(); errors.As(err, &exitErr) {
+					exitCode = exitErr.ExitCode()
+				} else if err != nil {
+					exitCode = 255
+				}
+				_ = channel.CloseWrite()
+				status := make([]byte, 4)
+				binary.BigEndian.PutUint32(status, uint32(exitCode))
+				_, _ = channel.SendRequest("exit-status", false, status)
+				channel.Close()
+			}()
+		case "signal":
+			if cmd != nil && cmd.Process != nil {
+				_ = cmd.Process.Kill()
+			}
+			if req.WantReply {
+				_ = req.Reply(true, nil)
+			}
+		default:
+			if req.WantReply {
+				_ = req.Reply(req.Type == "env", nil)
+			}
+		}
+	}
+	if cmd != nil {
+		_ = cmd.Process.Kill()
+		<-done
+	}
+}
@@ -0,0 +1,79 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transport is how the actions reach the machine they are applied to, the target
+// Local acts on the machine running wizard, SSH on a remote machine
+package transport
+
+import (
+	"context"
+	"io/fs"
+	"os/user"
+	"syscall"
+)
+
+// Transport runs the commands, accesses the files and looks up the users and groups of the target
+// The file methods behave like the functions of the os package with the same name, a missing file returns
+// an error matching fs.ErrNotExist
+type Transport interface {
+	// Run runs the command and waits for it, a non zero exit code is not an error but is set in the Result
+	// The command is stopped once the ctx is cancelled
+	Run(ctx context.Context, name string, args ...string) (*Result, error)
+
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.FileInfo, error)
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+	MkdirAll(path string, perm fs.FileMode) error
+	// CreateTemp creates an empty file in dir and returns its name, the last "*" of pattern is replaced by a random string
+	CreateTemp(dir, pattern string) (string, error)
+	Remove(name string) error
+	RemoveAll(path string) error
+	Chmod(name string, mode fs.FileMode) error
+	Chown(name string, uid, gid int) error
+	Lchown(name string, uid, gid int) error
+
+	LookupUser(username string) (*user.User, error)
+	LookupGroup(name string) (*user.Group, error)
+
+	// Close releases the connection to the target
+	Close() error
+}
+
+// Result is the output and the exit code of a command
+type Result struct {
+	StdOut   string
+	StdErr   string
+	ExitCode int
+}
+
+// Stat is returned by the Sys method of the fs.FileInfo of a remote file
+type Stat struct {
+	Uid uint32
+	Gid uint32
+}
+
+// Owner returns the uid and the gid of the owner of a file returned by a Transport
+func Owner(info fs.FileInfo) (uid, gid int, ok bool) {
+	switch sys := info.Sys().(type) {
+	case *syscall.Stat_t:
+		return int(sys.Uid), int(sys.Gid), true
+	case *Stat:
+		return int(sys.Uid), int(sys.Gid), true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,330 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/acceldata-io/wizard/pkg/transport"
+	"github.com/acceldata-io/wizard/pkg/transport/sshtest"
+)
+
+func transports(t *testing.T) map[string]transport.Transport {
+	server, err := sshtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	remote, err := transport.DialSSH(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { remote.Close() })
+	return map[string]transport.Transport{"local": transport.Local, "ssh": remote}
+}
+
+func TestTransportFiles(t *testing.T) {
+	for name, target := range transports(t) {
+		dir := t.TempDir()
+		file := filepath.Join(dir, "it's a file")
+		if _, err := target.Stat(file); !errors.Is(err, fs.ErrNotExist) || !os.IsNotExist(err) {
+			t.Fatalf("%s: expected a not exist error, got %v", name, err)
+		}
+		if err := target.WriteFile(file, []byte("line\n"), 0o640); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if err := target.WriteFile(file, []byte("content"), 0o600); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		content, err := target.ReadFile(file)
+		if err != nil || string(content) != "content" {
+			t.Fatalf("%s: unexpected content %q, %v", name, content, err)
+		}
+		info, err := target.Stat(file)
+		if err != nil || info.Mode() != 0o640 || info.Size() != 7 || info.Name() != "it's a file" {
+			t.Fatalf("%s: unexpected stat %v %v", name, info, err)
+		}
+		if uid, gid, ok := transport.Owner(info); !ok || uid != os.Getuid() || gid != os.Getgid() {
+			t.Fatalf("%s: unexpected owner %d:%d", name, uid, gid)
+		}
+
+		sub := filepath.Join(dir, "a", "b")
+		if err := target.MkdirAll(sub, 0o750); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if err := target.Chmod(sub, 0o755|fs.ModeSetgid); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if info, err := target.Stat(sub); err != nil || !info.IsDir() || info.Mode() != fs.ModeDir|fs.ModeSetgid|0o755 {
+			t.Fatalf("%s: unexpected dir stat %v %v", name, info, err)
+		}
+		link := filepath.Join(dir, "link")
+		if err := target.Symlink(file, link); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if err := target.Symlink(file, link); !os.IsExist(err) {
+			t.Fatalf("%s: expected an exist error, got %v", name, err)
+		}
+		if info, err := target.Lstat(link); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			t.Fatalf("%s: unexpected lstat %v %v", name, info, err)
+		}
+		if dest, err := target.Readlink(link); err != nil || dest != file {
+			t.Fatalf("%s: unexpected link %q %v", name, dest, err)
+		}
+		if err := target.Lchown(link, os.Getuid(), os.Getgid()); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if err := target.Chown(file, os.Getuid(), os.Getgid()); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		temp, err := target.CreateTemp(dir, "backup.*.bak")
+		if err != nil || !strings.HasPrefix(filepath.Base(temp), "backup.") || !strings.HasSuffix(temp, ".bak") {
+			t.Fatalf("%s: unexpected temp file %q %v", name, temp, err)
+		}
+		entries, err := target.ReadDir(dir)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		if expected := []string{"a", filepath.Base(temp), "it's a file", "link"}; !reflect.DeepEqual(names, expected) {
+			t.Fatalf("%s: expected entries %v, got %v", name, expected, names)
+		}
+
+		if err := target.Remove(filepath.Join(dir, "a")); err == nil {
+			t.Fatalf("%s: expected an error removing a dir which is not empty", name)
+		}
+		if err := target.Remove(temp); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if err := target.Remove(temp); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected a not exist error, got %v", name, err)
+		}
+		if err := target.RemoveAll(filepath.Join(dir, "a")); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, err := target.ReadDir(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected a not exist error, got %v", name, err)
+		}
+	}
+}
+
+func TestTransportRun(t *testing.T) {
+	for name, target := range transports(t) {
+		result, err := target.Run(context.Background(), "sh", "-c", `echo "$1"; echo err >&2; exit 3`, "sh", "it's quoted")
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if *result != (transport.Result{StdOut: "it's quoted\n", StdErr: "err\n", ExitCode: 3}) {
+			t.Fatalf("%s: unexpected result %+v", name, result)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		_, _ = target.Run(ctx, "sleep", "5")
+		cancel()
+		if time.Since(start) > 3*time.Second {
+			t.Fatalf("%s: expected the command to be stopped with the ctx", name)
+		}
+	}
+}
+
+func TestTransportLookup(t *testing.T) {
+	for name, target := range transports(t) {
+		root, err := target.LookupUser("root")
+		if err != nil || root.Uid != "0" || root.Gid != "0" || root.HomeDir == "" {
+			t.Fatalf("%s: unexpected user %+v %v", name, root, err)
+		}
+		if _, err := target.LookupUser("wizard-unknown-user"); !errors.As(err, new(user.UnknownUserError)) {
+			t.Fatalf("%s: expected an unknown user error, got %v", name, err)
+		}
+		group, err := target.LookupGroup(root.Username)
+		if err != nil || group.Gid != "0" {
+			t.Fatalf("%s: unexpected group %+v %v", name, group, err)
+		}
+		if _, err := target.LookupGroup("wizard-unknown-group"); !errors.As(err, new(user.UnknownGroupError)) {
+			t.Fatalf("%s: expected an unknown group error, got %v", name, err)
+		}
+	}
+}
+
+func TestDialSSH(t *testing.T) {
+	server, err := sshtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	config := server.Config()
+	config.Password = "wrong"
+	if _, err := transport.DialSSH(config); err == nil {
+		t.Fatal("expected an authentication error")
+	}
+	config = server.Config()
+	config.HostKeyCallback = nil
+	if _, err := transport.DialSSH(config); err == nil || !strings.Contains(err.Error(), "HostKeyCallback is required") {
+		t.Fatalf("expected a host key error, got %v", err)
+	}
+}
+
+func TestRooted(t *testing.T) {
+	for name, target := range transports(t) {
+		root := t.TempDir()
+		rooted := transport.Rooted(target, root)
+		if transport.Root(rooted) != root || transport.Root(target) != "" {
+			t.Fatalf("%s: unexpected root %q", name, transport.Root(rooted))
+		}
+		if err := rooted.MkdirAll("/etc", 0o755); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		passwd := "root:x:0:0:root:/root:/bin/bash\nagent:x:1500:1600:Agent,,,:/opt/agent:/bin/false\n"
+		if err := rooted.WriteFile("/etc/passwd", []byte(passwd), 0o644); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if err := rooted.WriteFile("/../../etc/group", []byte("agent:x:1600:\n"), 0o644); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "etc", "group")); err != nil {
+			t.Fatalf("%s: expected the path to stay under the root, %v", name, err)
+		}
+
+		u, err := rooted.LookupUser("agent")
+		if err != nil || u.Uid != "1500" || u.Gid != "1600" || u.Name != "Agent" || u.HomeDir != "/opt/agent" {
+			t.Fatalf("%s: unexpected user %v %v", name, u, err)
+		}
+		if _, err := rooted.LookupUser("nobody"); !errors.As(err, new(user.UnknownUserError)) {
+			t.Fatalf("%s: expected an unknown user error, got %v", name, err)
+		}
+		if g, err := rooted.LookupGroup("agent"); err != nil || g.Gid != "1600" {
+			t.Fatalf("%s: unexpected group %v %v", name, g, err)
+		}
+		if _, err := rooted.LookupGroup("root"); !errors.As(err, new(user.UnknownGroupError)) {
+			t.Fatalf("%s: expected an unknown group error, got %v", name, err)
+		}
+
+		tmp, err := rooted.CreateTemp("/etc", "wizard")
+		if err != nil || !strings.HasPrefix(tmp, "/etc/wizard") {
+			t.Fatalf("%s: unexpected temp file %q %v", name, tmp, err)
+		}
+		if err := rooted.Symlink("/etc/passwd", "/etc/link"); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if link, err := os.Readlink(filepath.Join(root, "etc", "link")); err != nil || link != "/etc/passwd" {
+			t.Fatalf("%s: unexpected link %q %v", name, link, err)
+		}
+		if info, err := rooted.Stat("/etc/link"); err != nil || info.Size() != int64(len(passwd)) {
+			t.Fatalf("%s: expected the link resolved under the root, got %v %v", name, info, err)
+		}
+		infos, err := rooted.ReadDir("/etc")
+		if err != nil || len(infos) != 4 {
+			t.Fatalf("%s: unexpected dir entries %v %v", name, infos, err)
+		}
+		if err := rooted.RemoveAll("/etc"); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, err := rooted.Stat("/etc"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%s: expected a not exist error, got %v", name, err)
+		}
+	}
+}
+
+func TestRootedSymlinks(t *testing.T) {
+	for name, target := range transports(t) {
+		host := t.TempDir()
+		root := t.TempDir()
+		rooted := transport.Rooted(target, root)
+		for _, dir := range []string{"/etc", "/opt", host} {
+			if err := rooted.MkdirAll(dir, 0o755); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+		links := map[string]string{
+			"/etc/resolv.conf": host + "/resolv.conf",
+			"/etc/run":         host,
+			"/opt/agent":       "../etc/run/agent",
+			"/loop":            "/loop",
+			"/a":               "nonexist/../escape",
+			"/escape":          host,
+		}
+		for newname, oldname := range links {
+			if err := rooted.Symlink(oldname, newname); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+
+		// the absolute symlinks of the image point into the root, not to the host
+		if err := rooted.WriteFile("/etc/resolv.conf", []byte("nameserver 127.0.0.1\n"), 0o644); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if err := rooted.MkdirAll("/opt/agent/conf", 0o755); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if err := rooted.WriteFile("/etc/run/../run/x", []byte("x"), 0o644); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		// the elements after a missing one are resolved too
+		if err := os.WriteFile(filepath.Join(host, "hostname"), []byte("host\n"), 0o644); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if content, err := rooted.ReadFile("/a/hostname"); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%s: expected the file under the root, got %q %v", name, content, err)
+		}
+		if err := rooted.WriteFile("/a/hostname", []byte("image\n"), 0o644); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if content, err := os.ReadFile(filepath.Join(host, "hostname")); err != nil || string(content) != "host\n" {
+			t.Fatalf("%s: expected the host file unchanged, got %q %v", name, content, err)
+		}
+		if err := os.Remove(filepath.Join(host, "hostname")); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(root, host, "hostname")); err != nil {
+			t.Fatalf("%s: expected the file written under the root, %v", name, err)
+		}
+		if entries, err := os.ReadDir(host); err != nil || len(entries) != 0 {
+			t.Fatalf("%s: expected nothing written on the host, got %v %v", name, entries, err)
+		}
+		for _, file := range []string{"resolv.conf", "agent/conf", "x"} {
+			if _, err := os.Stat(filepath.Join(root, host, file)); err != nil {
+				t.Fatalf("%s: expected %s under the root, %v", name, file, err)
+			}
+		}
+		if info, err := rooted.Lstat("/opt/agent"); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			t.Fatalf("%s: expected Lstat not to follow the last element, got %v %v", name, info, err)
+		}
+		if err := rooted.Remove("/etc/run"); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(root, host, "x")); err != nil {
+			t.Fatalf("%s: expected Remove to remove the symlink only, %v", name, err)
+		}
+		if _, err := rooted.Stat("/loop"); !errors.Is(err, syscall.ELOOP) {
+			t.Fatalf("%s: expected a symlink loop error, got %v", name, err)
+		}
+	}
+}
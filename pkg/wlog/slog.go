@@ -0,0 +1,49 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogHandler writes the records to a slog.Handler, e.g. slog.NewJSONHandler
+// The records below the minimum level, or not enabled by the slog.Handler, are dropped
+type SlogHandler struct {
+	handler slog.Handler
+	level   Level
+}
+
+// NewSlogHandler returns a SlogHandler writing the records of the level or above to the handler
+func NewSlogHandler(handler slog.Handler, level Level) *SlogHandler {
+	return &SlogHandler{handler: handler, level: level}
+}
+
+// Handle writes the record with the task, action and name as attributes next to its fields
+func (h *SlogHandler) Handle(ctx context.Context, r Record) error {
+	if r.Level < h.level || !h.handler.Enabled(ctx, slog.Level(r.Level)) {
+		return nil
+	}
+	record := slog.NewRecord(r.Time, slog.Level(r.Level), r.Message, 0)
+	for _, attr := range []slog.Attr{slog.String("task", r.Task), slog.String("action", r.Action), slog.String("name", r.Name)} {
+		if attr.Value.String() != "" {
+			record.AddAttrs(attr)
+		}
+	}
+	for _, field := range r.Fields {
+		record.AddAttrs(slog.Any(field.Key, field.Value))
+	}
+	return h.handler.Handle(ctx, record)
+}
@@ -14,9 +14,111 @@
 
 package wlog
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
 type (
 	WLError string
 	WLInfo  string
 	WLWarn  string
 	WLDebug string
 )
+
+// Level is the severity of a Record, the values are the ones of slog.Level
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// Field is a key/value attribute of a Record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Record is a structured log message, with the task, the action and the name of the action which logged it if any
+type Record struct {
+	Level   Level
+	Time    time.Time
+	Task    string
+	Action  string
+	Name    string
+	Message string
+	Fields  []Field
+}
+
+// NewRecord returns the Record of a log message, a WLError, WLWarn, WLInfo, WLDebug or Record
+// Any other value is an info message formatted with fmt
+func NewRecord(msg interface{}) Record {
+	var r Record
+	switch m := msg.(type) {
+	case Record:
+		r = m
+	case WLError:
+		r = Record{Level: LevelError, Message: string(m)}
+	case WLWarn:
+		r = Record{Level: LevelWarn, Message: string(m)}
+	case WLInfo:
+		r = Record{Level: LevelInfo, Message: string(m)}
+	case WLDebug:
+		r = Record{Level: LevelDebug, Message: string(m)}
+	default:
+		r = Record{Level: LevelInfo, Message: fmt.Sprint(m)}
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	return r
+}
+
+// Legacy returns the message of the record as a WLError, WLWarn, WLInfo or WLDebug, the types of the log chan
+func (r Record) Legacy() interface{} {
+	switch {
+	case r.Level < LevelInfo:
+		return WLDebug(r.Message)
+	case r.Level < LevelWarn:
+		return WLInfo(r.Message)
+	case r.Level < LevelError:
+		return WLWarn(r.Message)
+	}
+	return WLError(r.Message)
+}
+
+// MarshalJSON returns the record as a flat JSON object, the fields are next to level, time, task, action, name and msg
+func (r Record) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(r.Fields)+6)
+	for _, field := range r.Fields {
+		m[field.Key] = field.Value
+		if err, ok := field.Value.(error); ok {
+			m[field.Key] = err.Error()
+		}
+	}
+	m["level"] = r.Level.String()
+	m["time"] = r.Time
+	m["msg"] = r.Message
+	for key, value := range map[string]string{"task": r.Task, "action": r.Action, "name": r.Name} {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	return json.Marshal(m)
+}
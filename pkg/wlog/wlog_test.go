@@ -0,0 +1,96 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		msg   interface{}
+		level Level
+	}{
+		{WLError("error"), LevelError},
+		{WLWarn("warn"), LevelWarn},
+		{WLInfo("info"), LevelInfo},
+		{WLDebug("debug"), LevelDebug},
+	}
+	for _, tc := range tests {
+		r := NewRecord(tc.msg)
+		if r.Level != tc.level || r.Time.IsZero() || r.Legacy() != tc.msg {
+			t.Fatalf("unexpected record of %#v: %+v", tc.msg, r)
+		}
+	}
+	if r := NewRecord(42); r.Level != LevelInfo || r.Message != "42" {
+		t.Fatalf("unexpected record of an int: %+v", r)
+	}
+
+	r := Record{
+		Level:   LevelWarn,
+		Time:    time.Date(2023, 1, 10, 10, 0, 0, 0, time.UTC),
+		Task:    "agent",
+		Action:  "copy",
+		Message: "retrying",
+		Fields:  []Field{{Key: "attempt", Value: 2}, {Key: "error", Value: errors.New("timeout")}},
+	}
+	if NewRecord(r).Time != r.Time {
+		t.Fatal("expected a record to be kept as is")
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"level": "WARN", "time": "2023-01-10T10:00:00Z", "task": "agent", "action": "copy",
+		"msg": "retrying", "attempt": float64(2), "error": "timeout",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected JSON %s", data)
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewSlogHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}), LevelInfo)
+	for _, r := range []Record{
+		{Level: LevelDebug, Message: "dropped"},
+		{Level: LevelError, Task: "agent", Action: "cmd", Name: "start", Message: "failed", Fields: []Field{{Key: "exit_code", Value: 3}}},
+	} {
+		if err := handler.Handle(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("expected a single JSON line, got %q: %s", buf.String(), err)
+	}
+	delete(got, "time")
+	want := map[string]interface{}{"level": "ERROR", "msg": "failed", "task": "agent", "action": "cmd", "name": "start", "exit_code": float64(3)}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected slog record %s", buf.String())
+	}
+}
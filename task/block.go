@@ -0,0 +1,127 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/actions"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/wlog"
+)
+
+// performBlock performs the actions of the block, then the rescue actions if one of them failed, and the always actions
+// The register of the block is changed if one of its actions changed, and once an action of the block failed it has
+// Failed set, the name of the action in FailedAction and its error and exit code in StdErr and ExitCode for the rescue
+// A rescued block does not fail the task, a failed rescue or always action does. An interrupted block stops at once
+func (t *Task) performBlock(ctx context.Context, run *taskRun, play *parser.Action, logCh chan interface{}) error {
+	taskName := run.name
+	start := time.Now()
+	if play.Register == "" {
+		play.Register = register.GetHash(play.Name)
+	}
+	blockRegister := &register.Register{}
+	t.registers.Set(play.Register, blockRegister)
+
+	rendered, err := t.renderAction(play, nil)
+	if err != nil {
+		run.report.addAction(play.Name, play.Action, start, StatusFailed, nil, err)
+		logCh <- actionLog(wlog.LevelError, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", taskName, play.Action, play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+		return fmt.Errorf("perform: Task: %s Action: %s, Name: %s, Error: %s", taskName, play.Action, play.Name, err.Error())
+	}
+	logCh <- actionLog(wlog.LevelInfo, taskName, play.Action, rendered.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s", taskName, play.Action, rendered.Name))
+	logCh <- actionStartEvent{Task: taskName, Name: rendered.Name, Action: play.Action, Start: start}
+	if rendered.When != nil {
+		timeout := play.Timeout
+		if timeout == 0 {
+			timeout = 10
+		}
+		satisfied, err := actions.NewWhen(rendered.When.Command, rendered.When.RVar, rendered.When.ExitCode, timeout, t.registers).WithTransport(t.opts.Transport).Execute(ctx)
+		if err != nil || !satisfied {
+			run.report.addAction(rendered.Name, play.Action, start, StatusSkipped, blockRegister, nil)
+			logCh <- actionLog(wlog.LevelWarn, taskName, play.Action, rendered.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: whenNotSatisfied", taskName, play.Action, rendered.Name))
+			return nil
+		}
+	}
+
+	status := StatusOK
+	var interrupted *InterruptedError
+	err = t.performList(ctx, run, play.Block, blockRegister, true, logCh)
+	if err != nil && !errors.As(err, &interrupted) && len(play.Rescue) > 0 {
+		logCh <- actionLog(wlog.LevelWarn, taskName, play.Action, rendered.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, rescue: %s failed", taskName, play.Action, rendered.Name, blockRegister.FailedAction))
+		if err = t.performList(ctx, run, play.Rescue, blockRegister, false, logCh); err == nil {
+			status = StatusRescued
+		}
+	}
+	if !errors.As(err, &interrupted) && len(play.Always) > 0 {
+		if alwaysErr := t.performList(ctx, run, play.Always, blockRegister, false, logCh); err == nil {
+			err = alwaysErr
+		}
+	}
+
+	if blockRegister.Changed {
+		run.notified.notify(play.Notify)
+		if status == StatusOK {
+			status = StatusChanged
+		}
+	}
+	if err == nil {
+		run.report.addAction(rendered.Name, play.Action, start, status, blockRegister, nil)
+		return nil
+	}
+	if play.IgnoreError && !errors.As(err, &interrupted) {
+		run.report.addAction(rendered.Name, play.Action, start, StatusIgnored, blockRegister, err)
+		return nil
+	}
+	run.report.addAction(rendered.Name, play.Action, start, StatusFailed, blockRegister, err)
+	return err
+}
+
+// performList performs the actions one after the other and stops at the first failure
+// The block register is changed if one of the actions changed, and records the failure if recordFailure is set
+// The actions not selected by the tags, with the ones of the block, are skipped
+func (t *Task) performList(ctx context.Context, run *taskRun, list []*parser.Action, blockRegister *register.Register, recordFailure bool, logCh chan interface{}) error {
+	blockTags := run.tags
+	defer func() { run.tags = blockTags }()
+	for _, play := range list {
+		run.tags = withTags(blockTags, play)
+		if run.filtered && !t.filters.selected(run.tags, play) {
+			t.skipFiltered(run, play, logCh)
+			continue
+		}
+		err := t.performAction(ctx, run, play, logCh)
+		aRegister := t.registers.Get(play.Register)
+		if aRegister != nil && aRegister.Changed {
+			blockRegister.Changed = true
+		}
+		if err == nil {
+			continue
+		}
+		if recordFailure {
+			blockRegister.Failed = true
+			blockRegister.FailedAction = play.Name
+			blockRegister.StdErr = err.Error()
+			if aRegister != nil {
+				blockRegister.ExitCode = aRegister.ExitCode
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/wlog"
+)
+
+// EventHandler receives the lifecycle events of the runs, see AddEventHandler
+// The events and the logs of a run are delivered to a handler in order on its own goroutine, even when tasks run
+// in parallel, so a handler needs no locking. A slow handler lags behind the run, see SetEventQueue
+type EventHandler interface {
+	OnRunStart(RunEvent)
+	OnTaskStart(TaskEvent)
+	// OnActionStart is called before an action runs, an action skipped by the filters or the resumed run only ends
+	OnActionStart(ActionEvent)
+	// OnActionEnd is called for every action of the report, an action with a loop ends once per item
+	OnActionEnd(ActionEvent)
+	OnTaskEnd(TaskEvent)
+	OnRunEnd(RunEvent)
+	// OnLog receives the log records of the level set by SetLogLevel or above, with the task and the action which logged them
+	OnLog(wlog.Record)
+}
+
+// RunEvent is the start or the end of a run, the Status, Duration and Err are set at the end
+type RunEvent struct {
+	Start    time.Time
+	Status   Status
+	Duration time.Duration
+	Err      error
+}
+
+// TaskEvent is the start or the end of a task, the Status, Duration and Err are set at the end
+type TaskEvent struct {
+	Task     string
+	Start    time.Time
+	Status   Status
+	Duration time.Duration
+	Err      error
+}
+
+// ActionEvent is the start or the end of an action, the Status, Changed, Duration, Register and Err are set at the end
+type ActionEvent struct {
+	Task     string
+	Name     string
+	Action   string
+	Start    time.Time
+	Status   Status
+	Changed  bool
+	Duration time.Duration
+	Register *register.Register
+	Err      error
+}
+
+// NopEventHandler ignores all the events, embed it to implement only some of the callbacks
+type NopEventHandler struct{}
+
+func (NopEventHandler) OnRunStart(RunEvent)       {}
+func (NopEventHandler) OnTaskStart(TaskEvent)     {}
+func (NopEventHandler) OnActionStart(ActionEvent) {}
+func (NopEventHandler) OnActionEnd(ActionEvent)   {}
+func (NopEventHandler) OnTaskEnd(TaskEvent)       {}
+func (NopEventHandler) OnRunEnd(RunEvent)         {}
+func (NopEventHandler) OnLog(wlog.Record)         {}
+
+// ChannelEventHandler sends the logs to the channel as the wlog pkg types, it is the handler of Perform and Resume
+type ChannelEventHandler struct {
+	NopEventHandler
+	LogCh chan<- interface{}
+}
+
+// OnLog sends the message of the record to the channel, see wlog.Record.Legacy
+func (h ChannelEventHandler) OnLog(r wlog.Record) {
+	h.LogCh <- r.Legacy()
+}
+
+// SlogEventHandler writes the logs to a slog.Handler, with the task, action and name as attributes
+type SlogEventHandler struct {
+	NopEventHandler
+	Handler *wlog.SlogHandler
+}
+
+// NewSlogEventHandler returns a SlogEventHandler writing the logs of the level or above to the handler
+func NewSlogEventHandler(handler slog.Handler, level wlog.Level) SlogEventHandler {
+	return SlogEventHandler{Handler: wlog.NewSlogHandler(handler, level)}
+}
+
+// OnLog writes the record, the errors of the slog.Handler are ignored like the ones of the slog.Logger
+func (h SlogEventHandler) OnLog(r wlog.Record) {
+	_ = h.Handler.Handle(context.Background(), r)
+}
+
+// logCollector collects the logs of Execute as the wlog pkg types
+type logCollector struct {
+	NopEventHandler
+	logs []interface{}
+}
+
+func (c *logCollector) OnLog(r wlog.Record) {
+	c.logs = append(c.logs, r.Legacy())
+}
+
+// the events are sent on the log chan of the run next to the logs, in these types to tell them apart
+type (
+	runStartEvent    RunEvent
+	taskStartEvent   TaskEvent
+	actionStartEvent ActionEvent
+	actionEndEvent   ActionEvent
+	taskEndEvent     TaskEvent
+	runEndEvent      RunEvent
+)
+
+// EventQueue sets how the events of a run are queued for each handler added by AddEventHandler, see SetEventQueue
+// The log chan of Perform and Resume has the same queue size, but it never drops a log
+type EventQueue struct {
+	// Size is the number of events a handler can lag behind the run, 1024 by default
+	Size int
+	// Drop drops the event for a handler with a full queue and counts it, see DroppedEvents
+	// By default the run waits for the handler
+	Drop bool
+	// FlushTimeout limits how long the end of a run waits for the handlers to receive their queued events,
+	// the events still queued then are dropped and counted. No limit by default
+	FlushTimeout time.Duration
+}
+
+const defaultEventQueueSize = 1024
+
+// eventQueue is the queue of the events of a run for one handler, drained by its own goroutine
+type eventQueue struct {
+	handler EventHandler
+	events  chan interface{}
+	// lossless is set for the log chan of Perform, the run always waits for it
+	lossless bool
+	// stopped is set once the run stops waiting for the handler, its queued events are dropped then
+	stopped atomic.Bool
+	done    chan struct{}
+}
+
+// AddEventHandler adds a handler of the events of the next runs, the handlers are called in the order they were added
+func (t *Task) AddEventHandler(handler EventHandler) {
+	t.eventHandlers = append(t.eventHandlers, handler)
+}
+
+// SetLogLevel drops the logs below the level for all the handlers, including the log chan of Perform
+// The default is wlog.LevelDebug, every log
+func (t *Task) SetLogLevel(level wlog.Level) {
+	t.logLevel = level
+}
+
+// SetEventQueue sets the queue of the events of the next runs for each event handler, a zero Size is the default
+func (t *Task) SetEventQueue(queue EventQueue) {
+	if queue.Size <= 0 {
+		queue.Size = defaultEventQueueSize
+	}
+	t.eventQueue = queue
+}
+
+// DroppedEvents returns the number of events and logs dropped for the handlers since the task was created,
+// because their queue was full or they did not receive them by the end of the run, see EventQueue
+func (t *Task) DroppedEvents() int64 {
+	return t.droppedEvents.Load()
+}
+
+// Run performs the tasks like Perform, the logs and the events are delivered to the event handlers only
+func (t *Task) Run(ctx context.Context) error {
+	return t.dispatch(nil, nil, func(logCh chan interface{}) error {
+		return t.perform(ctx, nil, logCh)
+	})
+}
+
+// dispatch runs the run with a log chan, and delivers its logs and events to the collector on the goroutine reading
+// the log chan, and to the event handlers and the lossless handler through their queues
+// It returns once the collector and the lossless handler have all of them, and the event handlers all of them
+// or the flush timeout expired
+func (t *Task) dispatch(collector *logCollector, lossless EventHandler, run func(logCh chan interface{}) error) error {
+	level := t.logLevel
+	queues := make([]*eventQueue, 0, len(t.eventHandlers)+1)
+	for _, handler := range t.eventHandlers {
+		queues = append(queues, t.startEventQueue(handler, false, level))
+	}
+	if lossless != nil {
+		queues = append(queues, t.startEventQueue(lossless, true, level))
+	}
+
+	logCh := make(chan interface{})
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		for msg := range logCh {
+			if collector != nil {
+				deliver(collector, msg, level)
+			}
+			for _, queue := range queues {
+				t.enqueue(queue, msg)
+			}
+		}
+	}()
+	err := run(logCh)
+	close(logCh)
+	<-read
+
+	for _, queue := range queues {
+		close(queue.events)
+	}
+	var timeout <-chan time.Time
+	if t.eventQueue.FlushTimeout > 0 {
+		timer := time.NewTimer(t.eventQueue.FlushTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	expired := false
+	for _, queue := range queues {
+		if queue.lossless {
+			<-queue.done
+			continue
+		}
+		if !expired {
+			select {
+			case <-queue.done:
+				continue
+			case <-timeout:
+				expired = true
+			}
+		}
+		queue.stopped.Store(true)
+		t.droppedEvents.Add(int64(len(queue.events)))
+	}
+	return err
+}
+
+// startEventQueue starts the goroutine delivering the queued events to the handler
+func (t *Task) startEventQueue(handler EventHandler, lossless bool, level wlog.Level) *eventQueue {
+	queue := &eventQueue{
+		handler:  handler,
+		events:   make(chan interface{}, t.eventQueue.Size),
+		lossless: lossless,
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(queue.done)
+		for msg := range queue.events {
+			if !queue.stopped.Load() {
+				deliver(queue.handler, msg, level)
+			}
+		}
+	}()
+	return queue
+}
+
+// enqueue adds the event to the queue of a handler, it waits for a full queue unless the events are dropped
+func (t *Task) enqueue(queue *eventQueue, msg interface{}) {
+	if queue.lossless || !t.eventQueue.Drop {
+		queue.events <- msg
+		return
+	}
+	select {
+	case queue.events <- msg:
+	default:
+		t.droppedEvents.Add(1)
+	}
+}
+
+// deliver calls the callback of the handler for an event, OnLog for a log of the level or above
+func deliver(handler EventHandler, msg interface{}, level wlog.Level) {
+	switch e := msg.(type) {
+	case runStartEvent:
+		handler.OnRunStart(RunEvent(e))
+	case taskStartEvent:
+		handler.OnTaskStart(TaskEvent(e))
+	case actionStartEvent:
+		handler.OnActionStart(ActionEvent(e))
+	case actionEndEvent:
+		handler.OnActionEnd(ActionEvent(e))
+	case taskEndEvent:
+		handler.OnTaskEnd(TaskEvent(e))
+	case runEndEvent:
+		handler.OnRunEnd(RunEvent(e))
+	default:
+		if r := wlog.NewRecord(msg); r.Level >= level {
+			handler.OnLog(r)
+		}
+	}
+}
+
+// actionLog returns the log record of an action of the task, the message is the one sent to the log chan of Perform
+func actionLog(level wlog.Level, task, action, name, msg string, fields ...wlog.Field) wlog.Record {
+	return wlog.Record{Level: level, Time: time.Now(), Task: task, Action: action, Name: name, Message: msg, Fields: fields}
+}
+
+// actionLogs returns the log chan of an action, its logs are forwarded to the log chan as records of the action
+// The returned func closes the chan and returns once the logs are forwarded, it is called once the action is done
+func actionLogs(logCh chan interface{}, task string, play *parser.Action) (chan interface{}, func()) {
+	actionCh := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range actionCh {
+			r := wlog.NewRecord(msg)
+			if r.Task == "" {
+				r.Task, r.Action, r.Name = task, play.Action, play.Name
+			}
+			logCh <- r
+		}
+	}()
+	return actionCh, func() {
+		close(actionCh)
+		<-done
+	}
+}
@@ -0,0 +1,143 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/wlog"
+)
+
+// filters select the tasks and the actions of a run, an empty include list selects everything
+type filters struct {
+	IncludeTags  []string `json:"include_tags,omitempty"`
+	ExcludeTags  []string `json:"exclude_tags,omitempty"`
+	IncludeTasks []string `json:"include_tasks,omitempty"`
+	ExcludeTasks []string `json:"exclude_tasks,omitempty"`
+}
+
+// SetTags selects the actions of the run by their tags, or the tags of their task
+// An action runs if it has one of the include tags, or include is empty, and none of the exclude tags
+func (t *Task) SetTags(include, exclude []string) {
+	t.filters.IncludeTags = include
+	t.filters.ExcludeTags = exclude
+}
+
+// SetTaskFilter selects the tasks of the priority list to run by their names
+// A task runs if it is in include, or include is empty, and not in exclude
+func (t *Task) SetTaskFilter(include, exclude []string) {
+	t.filters.IncludeTasks = include
+	t.filters.ExcludeTasks = exclude
+}
+
+// validate checks that the task filters name tasks of the priority list
+func (f filters) validate(taskList parser.TaskList) error {
+	priority := make(map[string]bool, len(taskList.Priority))
+	for _, taskName := range taskList.Priority {
+		priority[taskName] = true
+	}
+	for _, taskName := range append(append([]string(nil), f.IncludeTasks...), f.ExcludeTasks...) {
+		if !priority[taskName] {
+			return fmt.Errorf("task filter: task %q is not in the priority list", taskName)
+		}
+	}
+	return nil
+}
+
+// empty reports if the filters select everything
+func (f filters) empty() bool {
+	return len(f.IncludeTags) == 0 && len(f.ExcludeTags) == 0 && len(f.IncludeTasks) == 0 && len(f.ExcludeTasks) == 0
+}
+
+// taskSelected reports if the task runs
+func (f filters) taskSelected(taskName string) bool {
+	return (len(f.IncludeTasks) == 0 || contains(f.IncludeTasks, taskName)) && !contains(f.ExcludeTasks, taskName)
+}
+
+// actionSelected reports if an action with the tags runs
+func (f filters) actionSelected(tags []string) bool {
+	if len(f.IncludeTags) > 0 && !containsAny(f.IncludeTags, tags) {
+		return false
+	}
+	return !containsAny(f.ExcludeTags, tags)
+}
+
+// selected reports if the action with the tags runs, the tags include the ones inherited from its task and blocks
+// A block also runs if one of its nested actions does, the actions not selected are skipped when it is performed
+func (f filters) selected(tags []string, play *parser.Action) bool {
+	if f.actionSelected(tags) {
+		return true
+	}
+	if containsAny(f.ExcludeTags, tags) {
+		return false
+	}
+	for _, list := range [][]*parser.Action{play.Block, play.Rescue, play.Always} {
+		for _, nested := range list {
+			if f.selected(withTags(tags, nested), nested) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withTags returns the inherited tags with the tags of the action
+func withTags(inherited []string, play *parser.Action) []string {
+	tags := make([]string, 0, len(inherited)+len(play.Tags))
+	tags = append(tags, inherited...)
+	return append(tags, play.Tags...)
+}
+
+// stateHash returns the hash of the checkpoint, the checkpoint of a run with other filters is not resumed
+func (t *Task) stateHash() string {
+	if t.filters.empty() {
+		return t.configHash
+	}
+	data, _ := json.Marshal(t.filters)
+	return configHash(append([]byte(t.configHash), data...))
+}
+
+// skipFiltered reports an action excluded by the filters as skipped, its register only has Skipped set
+func (t *Task) skipFiltered(run *taskRun, play *parser.Action, logCh chan interface{}) {
+	if play.Register == "" {
+		play.Register = register.GetHash(play.Name)
+	}
+	logCh <- actionLog(wlog.LevelInfo, run.name, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, skipped by the filters", run.name, play.Action, play.Name))
+	aRegister := &register.Register{Skipped: true}
+	t.registers.Set(play.Register, aRegister)
+	run.report.addAction(play.Name, play.Action, time.Now(), StatusSkipped, aRegister, nil)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list, values []string) bool {
+	for _, v := range values {
+		if contains(list, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"sort"
+)
+
+type taskResult struct {
+	name string
+	err  error
+}
+
+// runGraph performs the tasks of the priority list as soon as the tasks they depend on are done
+// Independent tasks run concurrently up to the parallelism limit. After a failure no new task is started,
+// the running tasks are waited for and the first error is returned
+func (t *Task) runGraph(ctx context.Context, logCh chan interface{}) error {
+	graph := t.taskList.TaskGraph()
+
+	order := make(map[string]int, len(t.taskList.Priority))
+	for i, taskName := range t.taskList.Priority {
+		order[taskName] = i
+	}
+
+	pending := make(map[string]int, len(graph))
+	dependents := make(map[string][]string, len(graph))
+	var ready []string
+	for _, taskName := range t.taskList.Priority {
+		pending[taskName] = len(graph[taskName])
+		for _, dep := range graph[taskName] {
+			dependents[dep] = append(dependents[dep], taskName)
+		}
+		if pending[taskName] == 0 {
+			ready = append(ready, taskName)
+		}
+	}
+
+	results := make(chan taskResult)
+	running := 0
+	var firstErr error
+
+	for {
+		for firstErr == nil && len(ready) > 0 && (t.parallelism <= 0 || running < t.parallelism) {
+			taskName := ready[0]
+			ready = ready[1:]
+			running++
+			go func() {
+				results <- taskResult{name: taskName, err: t.runTask(ctx, taskName, logCh)}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		for _, dependent := range dependents[res.name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+		// keep the priority order between the tasks which are ready
+		sort.SliceStable(ready, func(i, j int) bool {
+			return order[ready[i]] < order[ready[j]]
+		})
+	}
+
+	return firstErr
+}
@@ -0,0 +1,81 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/acceldata-io/wizard/pkg/wlog"
+)
+
+// notifications are the handlers notified by the changed actions, the tasks running in parallel share them
+type notifications struct {
+	mu       sync.Mutex
+	handlers map[string]bool
+}
+
+func newNotifications() *notifications {
+	return &notifications{handlers: make(map[string]bool)}
+}
+
+func (n *notifications) notify(handlers []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, handler := range handlers {
+		n.handlers[handler] = true
+	}
+}
+
+// empty reports if no handler is notified
+func (n *notifications) empty() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.handlers) == 0
+}
+
+// take reports if the handler was notified and clears the notification
+func (n *notifications) take(handler string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	notified := n.handlers[handler]
+	delete(n.handlers, handler)
+	return notified
+}
+
+// flushHandlers runs the notified handlers once each, in the order of the handlers list
+// A handler can notify the handlers defined after it, the handlers are not selected by the tags
+func (t *Task) flushHandlers(ctx context.Context, run *taskRun, logCh chan interface{}) error {
+	run.filtered = false
+	for _, handler := range t.taskList.Handlers {
+		if !run.notified.take(handler.Name) {
+			continue
+		}
+		if t.checkpoint.handlerCompleted(run.name, handler.Name) {
+			logCh <- actionLog(wlog.LevelInfo, run.name, handler.Action, handler.Name, fmt.Sprintf("Perform: Task: %s, handler: %s completed by the resumed run", run.name, handler.Name))
+			t.skipCompleted(run, handler, logCh)
+			continue
+		}
+		logCh <- actionLog(wlog.LevelInfo, run.name, handler.Action, handler.Name, fmt.Sprintf("Perform: Task: %s, running handler: %s", run.name, handler.Name))
+		if err := t.performAction(ctx, run, handler, logCh); err != nil {
+			return err
+		}
+		if err := t.checkpoint.handlerDone(run.name, handler.Name, t.actionRegisters(handler)); err != nil {
+			logCh <- wlog.WLWarn(err.Error())
+		}
+	}
+	return nil
+}
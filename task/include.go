@@ -0,0 +1,67 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/acceldata-io/wizard/pkg/actions"
+)
+
+// includeLoader reads the included files from the embedded PackageFiles or the local disk
+// The hash of the config covers the included files, a change of an included file invalidates the checkpoint
+type includeLoader struct {
+	config []byte
+	files  [][]byte
+}
+
+func newIncludeLoader(config []byte) *includeLoader {
+	return &includeLoader{config: config}
+}
+
+func (l *includeLoader) load(file, srcType string) ([]byte, error) {
+	var data []byte
+	var err error
+	switch srcType {
+	case "embed":
+		data, err = fs.ReadFile(actions.PackageFiles, file)
+	case "local":
+		data, err = os.ReadFile(file)
+	default:
+		return nil, fmt.Errorf("wrong source type %q", srcType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.files = append(l.files, data)
+	return data, nil
+}
+
+// hash returns the hash of the config and of the included files in the order they were read
+func (l *includeLoader) hash() string {
+	if len(l.files) == 0 {
+		return configHash(l.config)
+	}
+	h := sha256.New()
+	h.Write(l.config)
+	for _, data := range l.files {
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
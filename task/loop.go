@@ -0,0 +1,140 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/wlog"
+)
+
+// performLoop performs the action once per item of its loop
+// Each iteration has its own register, named after the action's register with the index, e.g. "users[0]",
+// and the action's register aggregates them: changed if any iteration changed, the stdout joined by new lines,
+// the exit code and stderr of the first failed iteration, and the iteration registers in Results
+func (t *Task) performLoop(ctx context.Context, run *taskRun, play *parser.Action, logCh chan interface{}) error {
+	taskName := run.name
+	start := time.Now()
+	items, err := loopItems(play.Loop, t.templateConfig)
+	if err != nil {
+		run.report.addAction(play.Name, play.Action, start, StatusFailed, nil, err)
+		logCh <- actionLog(wlog.LevelError, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", taskName, play.Action, play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+		return fmt.Errorf("perform: Task: %s Action: %s, Name: %s, Error: %s", taskName, play.Action, play.Name, err.Error())
+	}
+	if play.Register == "" {
+		play.Register = register.GetHash(play.Name)
+	}
+	aggregate := &register.Register{}
+	t.registers.Set(play.Register, aggregate)
+
+	var stdOut []string
+	for i, item := range items {
+		iteration, err := t.loopIteration(play, item, i)
+		if err != nil {
+			run.report.addAction(play.Name, play.Action, start, StatusFailed, nil, err)
+			logCh <- actionLog(wlog.LevelError, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", taskName, play.Action, play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+			return fmt.Errorf("perform: Task: %s Action: %s, Name: %s, Error: %s", taskName, play.Action, play.Name, err.Error())
+		}
+		err = t.performRendered(ctx, run, iteration, logCh)
+
+		result := t.registers.Get(iteration.Register)
+		aggregate.Results = append(aggregate.Results, result)
+		aggregate.Changed = aggregate.Changed || result.Changed
+		stdOut = append(stdOut, result.StdOut)
+		aggregate.StdOut = strings.Join(stdOut, "\n")
+		if aggregate.ExitCode == 0 && aggregate.StdErr == "" {
+			aggregate.ExitCode = result.ExitCode
+			aggregate.StdErr = result.StdErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopIteration returns a copy of the action rendered for the item, with the "item" and "loop_index" template functions,
+// e.g. "{{ item }}" or "{{ (item).name }}" for an object
+func (t *Task) loopIteration(play *parser.Action, item interface{}, index int) (*parser.Action, error) {
+	iteration, err := t.renderAction(play, template.FuncMap{
+		"item":       func() interface{} { return item },
+		"loop_index": func() int { return index },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loop item %d: %s", index, err.Error())
+	}
+	iteration.Loop = nil
+	iteration.Register = fmt.Sprintf("%s[%d]", play.Register, index)
+	return iteration, nil
+}
+
+// loopItems returns the items of a loop, either a list of the config or the name of a TemplateConfig field holding a list
+// A nested field is separated by dots, e.g. "Kafka.DataDirs"
+func loopItems(loop interface{}, templateConfig interface{}) ([]interface{}, error) {
+	switch l := loop.(type) {
+	case []interface{}:
+		return l, nil
+	case string:
+		return configList(templateConfig, l)
+	}
+	return nil, fmt.Errorf("loop: expected a list or the name of a TemplateConfig field, got %T", loop)
+}
+
+// configList looks up the field of the TemplateConfig, a struct or a map with string keys, and returns its items
+func configList(config interface{}, path string) ([]interface{}, error) {
+	value := reflect.ValueOf(config)
+	for _, name := range strings.Split(path, ".") {
+		value = indirect(value)
+		switch value.Kind() {
+		case reflect.Struct:
+			value = value.FieldByName(name)
+		case reflect.Map:
+			if value.Type().Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("loop: TemplateConfig field %q is not found", path)
+			}
+			value = value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+		default:
+			return nil, fmt.Errorf("loop: TemplateConfig field %q is not found", path)
+		}
+		if !value.IsValid() || !value.CanInterface() {
+			return nil, fmt.Errorf("loop: TemplateConfig field %q is not found", path)
+		}
+	}
+
+	value = indirect(value)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, fmt.Errorf("loop: TemplateConfig field %q is not a list", path)
+	}
+	items := make([]interface{}, value.Len())
+	for i := range items {
+		items[i] = value.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// indirect follows the pointers and interfaces of the value
+func indirect(value reflect.Value) reflect.Value {
+	for (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
@@ -0,0 +1,89 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"fmt"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	config_gen "github.com/acceldata-io/wizard/internal/configen"
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+)
+
+// templateFuncs returns the func map used to render the actions: sprig, the wizard facts, "register",
+// which returns the register of a previous action, e.g. {{ (register "version").StdOut }},
+// and "var", which returns a var of the action, e.g. {{ var "java_home" }}
+func (t *Task) templateFuncs() template.FuncMap {
+	funcMap := parser.MergeFuncMap(sprig.GenericFuncMap(), t.wizardFacts)
+	funcMap["var"] = func(name string) (interface{}, error) {
+		return nil, fmt.Errorf("var %q not defined", name)
+	}
+	funcMap["register"] = func(name string) (*register.Register, error) {
+		r := t.registers.Get(name)
+		if r == nil {
+			return nil, fmt.Errorf("register %q not found", name)
+		}
+		return r, nil
+	}
+	return funcMap
+}
+
+// renderAction returns a copy of the action with its name, action_var, command and when cmd rendered as templates
+// The TemplateConfig is the dot of the templates, extraFuncs are added to the func map of the task
+func (t *Task) renderAction(play *parser.Action, extraFuncs template.FuncMap) (*parser.Action, error) {
+	funcMap := t.funcMap
+	if len(extraFuncs) > 0 || len(play.Vars) > 0 {
+		funcMap = parser.MergeFuncMap(t.funcMap, extraFuncs)
+		funcMap["var"] = func(name string) (interface{}, error) {
+			value, ok := play.Vars[name]
+			if !ok {
+				return nil, fmt.Errorf("var %q not defined", name)
+			}
+			return value, nil
+		}
+	}
+
+	rendered := *play
+	var err error
+	if rendered.Name, err = config_gen.RenderString(play.Name, funcMap, t.templateConfig); err != nil {
+		return nil, fmt.Errorf("name: %s", err.Error())
+	}
+
+	vars, err := config_gen.RenderValue(play.ActionVariables, funcMap, t.templateConfig)
+	if err != nil {
+		return nil, fmt.Errorf("action_var: %s", err.Error())
+	}
+	rendered.ActionVariables, _ = vars.(map[string]interface{})
+
+	if play.Command != nil {
+		rendered.Command = make([]string, len(play.Command))
+		for i, arg := range play.Command {
+			if rendered.Command[i], err = config_gen.RenderString(arg, funcMap, t.templateConfig); err != nil {
+				return nil, fmt.Errorf("command: %s", err.Error())
+			}
+		}
+	}
+
+	if play.When != nil {
+		when := *play.When
+		if when.Command, err = config_gen.RenderString(when.Command, funcMap, t.templateConfig); err != nil {
+			return nil, fmt.Errorf("when: %s", err.Error())
+		}
+		rendered.When = &when
+	}
+	return &rendered, nil
+}
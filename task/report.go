@@ -0,0 +1,159 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"sync"
+	"time"
+
+	"github.com/acceldata-io/wizard/pkg/register"
+)
+
+// Status is the outcome of a run, a task or an action in the RunReport
+type Status string
+
+const (
+	StatusOK      Status = "ok"
+	StatusChanged Status = "changed"
+	StatusSkipped Status = "skipped"
+	StatusFailed  Status = "failed"
+	StatusIgnored Status = "ignored"
+	// StatusRescued is a block which failed and was rescued
+	StatusRescued Status = "rescued"
+)
+
+// RunReport is the structured result of the last run of a Task, it serializes to JSON
+type RunReport struct {
+	Status     Status        `json:"status"`
+	Start      time.Time     `json:"start"`
+	End        time.Time     `json:"end"`
+	DurationMS int64         `json:"duration_ms"`
+	Error      string        `json:"error,omitempty"`
+	Tasks      []*TaskReport `json:"tasks"`
+
+	mu sync.Mutex
+	// events is the log chan of the run the events are sent to
+	events chan<- interface{}
+}
+
+// TaskReport is the result of a task, the handlers run at the end of the run are reported as the task "handlers"
+type TaskReport struct {
+	Name       string         `json:"name"`
+	Status     Status         `json:"status"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	DurationMS int64          `json:"duration_ms"`
+	Error      string         `json:"error,omitempty"`
+	Actions    []ActionReport `json:"actions"`
+
+	events chan<- interface{}
+}
+
+// ActionReport is the result of an action, an action with a loop has a report per item
+type ActionReport struct {
+	Name       string             `json:"name"`
+	Action     string             `json:"action"`
+	Status     Status             `json:"status"`
+	Start      time.Time          `json:"start"`
+	End        time.Time          `json:"end"`
+	DurationMS int64              `json:"duration_ms"`
+	Register   *register.Register `json:"register,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// Report returns the report of the last run, nil before the first run
+func (t *Task) Report() *RunReport {
+	return t.report
+}
+
+// newRunReport returns the report of a run starting now, the events of the run are sent to the events chan
+func newRunReport(events chan<- interface{}) *RunReport {
+	r := &RunReport{Status: StatusOK, Start: time.Now(), Tasks: []*TaskReport{}, events: events}
+	r.events <- runStartEvent{Start: r.Start}
+	return r
+}
+
+// startTask adds the report of a task starting now, the tasks running in parallel share the run report
+func (r *RunReport) startTask(name string) *TaskReport {
+	taskReport := &TaskReport{Name: name, Status: StatusOK, Start: time.Now(), Actions: []ActionReport{}, events: r.events}
+	r.mu.Lock()
+	r.Tasks = append(r.Tasks, taskReport)
+	r.mu.Unlock()
+	r.events <- taskStartEvent{Task: name, Start: taskReport.Start}
+	return taskReport
+}
+
+// finish sets the end and the status of the run once all the tasks are done
+func (r *RunReport) finish(err error) {
+	r.End = time.Now()
+	r.DurationMS = r.End.Sub(r.Start).Milliseconds()
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+	} else {
+		for _, taskReport := range r.Tasks {
+			if taskReport.Status == StatusChanged {
+				r.Status = StatusChanged
+			}
+		}
+	}
+	r.events <- runEndEvent{Start: r.Start, Status: r.Status, Duration: r.End.Sub(r.Start), Err: err}
+}
+
+// finish sets the end and the status of the task, changed if one of its actions changed
+func (r *TaskReport) finish(err error) {
+	r.End = time.Now()
+	r.DurationMS = r.End.Sub(r.Start).Milliseconds()
+	if err != nil {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+	}
+	r.events <- taskEndEvent{Task: r.Name, Start: r.Start, Status: r.Status, Duration: r.End.Sub(r.Start), Err: err}
+}
+
+// addAction adds the report of an action which started at start
+func (r *TaskReport) addAction(name, action string, start time.Time, status Status, aRegister *register.Register, err error) {
+	end := time.Now()
+	actionReport := ActionReport{
+		Name:       name,
+		Action:     action,
+		Status:     status,
+		Start:      start,
+		End:        end,
+		DurationMS: end.Sub(start).Milliseconds(),
+	}
+	if aRegister != nil {
+		snapshot := *aRegister
+		actionReport.Register = &snapshot
+	}
+	if err != nil {
+		actionReport.Error = err.Error()
+	}
+	if status == StatusChanged && r.Status == StatusOK {
+		r.Status = StatusChanged
+	}
+	r.Actions = append(r.Actions, actionReport)
+	r.events <- actionEndEvent{
+		Task:     r.Name,
+		Name:     name,
+		Action:   action,
+		Start:    start,
+		Status:   status,
+		Changed:  status != StatusSkipped && aRegister != nil && aRegister.Changed,
+		Duration: end.Sub(start),
+		Register: actionReport.Register,
+		Err:      err,
+	}
+}
@@ -0,0 +1,85 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/actions"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/wlog"
+)
+
+// doWithRetries runs the action until it succeeds and its until condition is true, at most retries + 1 times
+// Every attempt is appended to the Attempts of the action's register, which is reset before each retry. In check mode the action runs once
+// and the until condition is not evaluated, since the registers only hold what the actions would do
+func (t *Task) doWithRetries(ctx context.Context, taskName string, play *parser.Action, action actions.Action, logCh chan interface{}) error {
+	delay := time.Duration(play.Delay) * time.Second
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			t.resetRegister(play.Register)
+		}
+		err := action.Do(ctx, play, logCh)
+		if err == nil && play.Until != "" && !t.opts.CheckMode {
+			met, untilErr := t.registers.ParseRegisterExp(play.Until)
+			if untilErr != nil {
+				err = fmt.Errorf("until: %s", untilErr.Error())
+			} else if !met {
+				err = fmt.Errorf("until condition %q not met", play.Until)
+			}
+		}
+		t.recordAttempt(play.Register, err)
+
+		if err == nil || err.Error() == "whenNotSatisfied" || ctx.Err() != nil || attempt > play.Retries || t.opts.CheckMode {
+			return err
+		}
+		logCh <- actionLog(wlog.LevelWarn, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, attempt %d of %d failed: %s, retrying in %s", taskName, play.Action, play.Name, attempt, play.Retries+1, err.Error(), delay), wlog.Field{Key: "error", Value: err.Error()})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("retry interrupted: %w", ctx.Err())
+		case <-timer.C:
+		}
+		if play.Backoff > 0 {
+			delay = time.Duration(float64(delay) * play.Backoff)
+		}
+	}
+}
+
+// resetRegister clears the result of the previous attempt from the action's register, its attempts are kept
+func (t *Task) resetRegister(name string) {
+	aRegister := t.registers.Get(name)
+	*aRegister = register.Register{Attempts: aRegister.Attempts}
+}
+
+// recordAttempt appends the current result of the action's register to its attempts
+func (t *Task) recordAttempt(name string, err error) {
+	aRegister := t.registers.Get(name)
+	attempt := register.Attempt{
+		Changed:  aRegister.Changed,
+		StdOut:   aRegister.StdOut,
+		StdErr:   aRegister.StdErr,
+		ExitCode: aRegister.ExitCode,
+	}
+	if err != nil {
+		attempt.Err = err.Error()
+	}
+	aRegister.Attempts = append(aRegister.Attempts, attempt)
+}
@@ -0,0 +1,74 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/actions"
+	"github.com/acceldata-io/wizard/pkg/wlog"
+)
+
+// changedAction is an action performed in transactional mode which changed the system or failed while changing it
+type changedAction struct {
+	task    string
+	play    *parser.Action
+	action  actions.Action
+	changed bool
+}
+
+// recordChange keeps the action for the rollback if it changed the system or failed
+func (t *Task) recordChange(taskName string, play *parser.Action, action actions.Action, err error) {
+	changed := t.registers.Get(play.Register).Changed
+	if !changed && (err == nil || err.Error() == "whenNotSatisfied") {
+		return
+	}
+	t.changesMu.Lock()
+	defer t.changesMu.Unlock()
+	t.changes = append(t.changes, changedAction{task: taskName, play: play, action: action, changed: changed})
+}
+
+// rollback reverts the recorded actions in the reverse order and returns the error of the run
+// The rollback does not use the ctx of the run, a cancelled run is rolled back too
+func (t *Task) rollback(runErr error, logCh chan interface{}) error {
+	logCh <- wlog.WLWarn(fmt.Sprintf("Rollback: reverting %d action(s)", len(t.changes)))
+	failed := 0
+	for i := len(t.changes) - 1; i >= 0; i-- {
+		change := t.changes[i]
+		reverter, ok := change.action.(actions.Reverter)
+		if !ok {
+			if change.changed {
+				logCh <- actionLog(wlog.LevelWarn, change.task, change.play.Action, change.play.Name, fmt.Sprintf("Rollback: Task: %s Action: %s, Name: %s, cannot be reverted", change.task, change.play.Action, change.play.Name))
+			}
+			continue
+		}
+		logCh <- actionLog(wlog.LevelInfo, change.task, change.play.Action, change.play.Name, fmt.Sprintf("Rollback: Task: %s Action: %s, Name: %s", change.task, change.play.Action, change.play.Name))
+		actionCh, closeActionLogs := actionLogs(logCh, change.task, change.play)
+		err := reverter.Revert(context.Background(), actionCh)
+		closeActionLogs()
+		if err != nil {
+			logCh <- actionLog(wlog.LevelError, change.task, change.play.Action, change.play.Name, fmt.Sprintf("Rollback: Task: %s Action: %s, Name: %s, Err: %s", change.task, change.play.Action, change.play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+			failed++
+		}
+	}
+	t.changes = nil
+	if failed > 0 {
+		return fmt.Errorf("%w, rollback: %d action(s) not reverted", runErr, failed)
+	}
+	logCh <- wlog.WLInfo("Rollback: done")
+	return runErr
+}
@@ -0,0 +1,209 @@
+// Acceldata Inc. and its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// 	Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/register"
+)
+
+// state is the checkpoint of a run saved in the state file
+type state struct {
+	// ConfigHash is the hash of the config of the run, a checkpoint of another config is not resumed
+	ConfigHash string `json:"config_hash"`
+	// Completed is the number of completed actions by task, the actions of a task run one after the other
+	Completed map[string]int `json:"completed"`
+	// Handlers are the completed handlers by task, the handlers flushed at the end of the run are under "handlers"
+	Handlers map[string][]string `json:"handlers"`
+	// Registers are the registers of the completed actions
+	Registers map[string]*register.Register `json:"registers"`
+}
+
+// checkpoint saves the progress of a run to the state file, the tasks running in parallel share it
+// A nil checkpoint does nothing
+type checkpoint struct {
+	mu    sync.Mutex
+	path  string
+	state state
+}
+
+// configHash returns the hash of the config used to invalidate the checkpoints of another config
+func configHash(config []byte) string {
+	sum := sha256.Sum256(config)
+	return hex.EncodeToString(sum[:])
+}
+
+// newCheckpoint returns the checkpoint of a run, it continues the resumed state if not nil
+func newCheckpoint(path, hash string, resumed *state) *checkpoint {
+	c := &checkpoint{
+		path: path,
+		state: state{
+			ConfigHash: hash,
+			Completed:  make(map[string]int),
+			Handlers:   make(map[string][]string),
+			Registers:  make(map[string]*register.Register),
+		},
+	}
+	if resumed != nil {
+		for name, n := range resumed.Completed {
+			c.state.Completed[name] = n
+		}
+		for name, handlers := range resumed.Handlers {
+			c.state.Handlers[name] = append([]string(nil), handlers...)
+		}
+		for name, r := range resumed.Registers {
+			c.state.Registers[name] = r
+		}
+	}
+	return c
+}
+
+// loadState reads the state file, a missing file returns a nil state
+func loadState(path string) (*state, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("loadState: unable to read state file - %s - %s", path, err)
+	}
+	s := &state{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("loadState: invalid state file - %s - %s", path, err)
+	}
+	return s, nil
+}
+
+// completed returns the number of completed actions of the task
+func (c *checkpoint) completed(taskName string) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Completed[taskName]
+}
+
+// handlerCompleted reports if the handler was completed by the task
+func (c *checkpoint) handlerCompleted(taskName, handler string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, name := range c.state.Handlers[taskName] {
+		if name == handler {
+			return true
+		}
+	}
+	return false
+}
+
+// actionDone records the number of completed actions of the task with the registers of the last one, and saves the state
+func (c *checkpoint) actionDone(taskName string, completed int, registers map[string]*register.Register) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Completed[taskName] = completed
+	for name, r := range registers {
+		c.state.Registers[name] = r
+	}
+	return c.save()
+}
+
+// handlerDone records the handler as completed by the task with its registers, and saves the state
+func (c *checkpoint) handlerDone(taskName, handler string, registers map[string]*register.Register) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.state.Handlers[taskName] = append(c.state.Handlers[taskName], handler)
+	for name, r := range registers {
+		c.state.Registers[name] = r
+	}
+	return c.save()
+}
+
+// save writes the state to a temp file renamed to the state file, a crash never leaves a partial state file
+func (c *checkpoint) save() error {
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("checkpoint: %s", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("checkpoint: unable to write state file - %s - %s", c.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("checkpoint: unable to write state file - %s - %s", c.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("checkpoint: unable to write state file - %s - %s", c.path, err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("checkpoint: unable to write state file - %s - %s", c.path, err)
+	}
+	return nil
+}
+
+// remove deletes the state file once the run completed
+func (c *checkpoint) remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("checkpoint: unable to remove state file - %s - %s", c.path, err)
+	}
+	return nil
+}
+
+// actionRegisters returns a copy of the registers of a performed action, with the registers of its loop iterations
+// and of the actions of a block
+// The copies are not changed by the actions still running
+func (t *Task) actionRegisters(play *parser.Action) map[string]*register.Register {
+	registers := make(map[string]*register.Register)
+	aRegister := t.registers.Get(play.Register)
+	if aRegister == nil {
+		return registers
+	}
+	snapshot := *aRegister
+	registers[play.Register] = &snapshot
+	if play.Loop != nil {
+		for i, result := range aRegister.Results {
+			registers[fmt.Sprintf("%s[%d]", play.Register, i)] = result
+		}
+	}
+	for _, nested := range play.Nested() {
+		if nested.Register == "" {
+			continue
+		}
+		for name, r := range t.actionRegisters(nested) {
+			registers[name] = r
+		}
+	}
+	return registers
+}
@@ -15,13 +15,20 @@
 package task
 
 import (
+	"context"
 	"embed"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/acceldata-io/wizard/factory/action"
 	"github.com/acceldata-io/wizard/internal/parser"
 	"github.com/acceldata-io/wizard/pkg/actions"
+	"github.com/acceldata-io/wizard/pkg/facts"
 	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
 	"github.com/acceldata-io/wizard/pkg/wlog"
 )
 
@@ -31,103 +38,483 @@ type Task struct {
 	actionFactory  action.ActionsFactory
 	templateConfig interface{}
 	wizardFacts    map[string]interface{}
+	parallelism    int
+	opts           actions.Options
+
+	// changes are the actions to revert in transactional mode, in the order they were performed
+	changes   []changedAction
+	changesMu sync.Mutex
+	// notified are the handlers to run at the end of the run
+	notified *notifications
+	// funcMap is used to render the actions, it is built once per run
+	funcMap template.FuncMap
+	// registers are the registers of the last run
+	registers *register.Store
+	// report is the report of the last run
+	report *RunReport
+	// configHash is the hash of the config, stateFile is the checkpoint of the runs when set
+	configHash string
+	stateFile  string
+	checkpoint *checkpoint
+	// filters select the tasks and actions of the runs
+	filters filters
+	// target is the transport set by SetTransport, targetRoot the root dir set by SetTargetRoot
+	target     transport.Transport
+	targetRoot string
+	// eventHandlers receive the events of the runs, logLevel is the minimum level of their logs
+	eventHandlers []EventHandler
+	logLevel      wlog.Level
+	// eventQueue is the queue of the events for each handler, droppedEvents counts the events it dropped
+	eventQueue    EventQueue
+	droppedEvents atomic.Int64
+}
+
+// taskRun is the state of a task being performed
+type taskRun struct {
+	name string
+	// notified are the handlers notified by the actions of the task
+	notified *notifications
+	report   *TaskReport
+	// tags are the tags of the block being performed, with the ones of its task and parent blocks
+	tags []string
+	// filtered is set when the actions are selected by the tags, the handlers are not
+	filtered bool
 }
 
 // TemplateOptions are used for the template action
 // If EnableWizardFacts is set to 'true' then the wizard can use all the ENV variables and some predefined facts in the template
 // TemplateConfig is the user defined structure to use in the template
+// ConfigFormat is the format of the config, ConfigFormatJSON or ConfigFormatYAML, detected if empty
+// FactsDir is the facts.d dir of the custom facts, none if empty, e.g. facts.DefaultFactsDir, and FactProviders add custom facts after it
 type TemplateOptions struct {
 	EnableWizardFacts bool
 	TemplateConfig    interface{}
+	ConfigFormat      string
+	FactsDir          string
+	FactProviders     []facts.Provider
 }
 
+// wizardFacts returns the wizard facts with the custom facts of the facts.d dir and the providers
+func (o TemplateOptions) wizardFacts() map[string]interface{} {
+	var providers []facts.Provider
+	if o.FactsDir != "" {
+		providers = append(providers, facts.Dir{Path: o.FactsDir})
+	}
+	providers = append(providers, o.FactProviders...)
+	return parser.GetWizardFactsWithCustom(func() (map[string]interface{}, []error) {
+		return facts.Custom(context.Background(), providers...)
+	})
+}
+
+const (
+	// ConfigFormatAuto detects the format of the config, JSON if it starts with "{", YAML otherwise
+	ConfigFormatAuto = parser.FormatAuto
+	ConfigFormatJSON = parser.FormatJSON
+	ConfigFormatYAML = parser.FormatYAML
+)
+
+// ValidationError is returned by New with all the problems found in the config and their JSON paths
+type ValidationError = parser.ValidationError
+
 // New parses the input config and returns a Task, log chan, error if any
 // function parameters:
 // config -> is the user defined task list JSON
 // packageFiles -> embedded file system that the wizard will use to perform actions on
 // tmplOptions -> for template action
 func New(config []byte, packageFiles embed.FS, tmplOptions TemplateOptions) (*Task, error) {
-	taskList, err := parser.ParseConfig(config)
+	actions.PackageFiles = packageFiles
+	loader := newIncludeLoader(config)
+	taskList, err := parser.ParseConfigOptions(config, parser.ParseOptions{Format: tmplOptions.ConfigFormat, Load: loader.load})
 	if err != nil {
 		return nil, fmt.Errorf("new: %s", err.Error())
 	}
 
 	var wizardFacts map[string]interface{}
 	if tmplOptions.EnableWizardFacts {
-		wizardFacts, err = parser.ParseWizardFacts()
-		if err != nil {
-			return nil, fmt.Errorf("new: %s", err.Error())
-		}
+		wizardFacts = tmplOptions.wizardFacts()
 	}
 
 	parser.SetEnv()
 
-	actions.PackageFiles = packageFiles
+	if err = taskList.Validate(action.Validate); err != nil {
+		return nil, fmt.Errorf("new: %w", err)
+	}
 	return &Task{
 		taskList:       taskList,
 		actionFactory:  action.NewActionsFactory(),
 		templateConfig: tmplOptions.TemplateConfig,
 		wizardFacts:    wizardFacts,
+		registers:      register.NewStore(),
+		configHash:     loader.hash(),
+		logLevel:       wlog.LevelDebug,
+		eventQueue:     EventQueue{Size: defaultEventQueueSize},
 	}, nil
 }
 
+// SetParallelism limits the number of tasks performed at the same time when the tasks declare depends_on
+// 0, the default, means no limit
+func (t *Task) SetParallelism(n int) {
+	t.parallelism = n
+}
+
+// SetCheckMode enables the dry run, every action logs what it would change without changing the system
+// The registers are updated with the changes the actions would do, so the when conditions behave like in a real run
+func (t *Task) SetCheckMode(checkMode bool) {
+	t.opts.CheckMode = checkMode
+}
+
+// SetDiff enables the unified diff of the files changed by the copy and template actions
+// The diff is sent to the log chan and stored in the Diff field of the action's register,
+// set sensitive to true in the action_var to suppress the content of a file
+func (t *Task) SetDiff(diff bool) {
+	t.opts.Diff = diff
+}
+
+// SetTransactional enables the rollback of the run, when Perform fails every action which reported
+// Changed, and the failed action itself, is reverted in the reverse order
+// Files are restored from backups, created files, dirs, users and groups are removed, services return to their previous state
+// A cmd action, a removed dir or user and a service restart can not be reverted, they are logged as warnings
+func (t *Task) SetTransactional(transactional bool) {
+	t.opts.Transactional = transactional
+}
+
+// SetStateFile enables the checkpoint of the runs, the progress of the run is saved to the file after each action
+// The file is removed once the run completes, a failed run can be continued with Resume
+func (t *Task) SetStateFile(path string) {
+	t.stateFile = path
+}
+
+// SetTransport applies the actions to the target of the transport, e.g. a remote machine with transport.DialSSH
+// The src files of copy and template are still read from the local machine or the embedded files,
+// the caller closes the transport once the runs are done. The local machine is the target by default
+// A run fails with a remote target if the wizard facts are enabled, they are the facts of the local machine
+func (t *Task) SetTransport(target transport.Transport) {
+	t.target = target
+	t.setTarget()
+}
+
+// SetTargetRoot resolves the paths of the copy, template and file actions under the root dir, like a chroot,
+// e.g. to lay down files into an image being built or into a temp dir for tests without privileges.
+// The owners are looked up in the etc/passwd and etc/group files of the root, the commands are not run under the root
+// A run fails with a target root if the wizard facts are enabled, they are the facts of the local machine
+func (t *Task) SetTargetRoot(root string) {
+	t.targetRoot = root
+	t.setTarget()
+}
+
+// setTarget sets the transport of the actions from the target and the target root
+func (t *Task) setTarget() {
+	t.opts.Transport = t.target
+	if t.targetRoot != "" {
+		target := t.target
+		if target == nil {
+			target = transport.Local
+		}
+		t.opts.Transport = transport.Rooted(target, t.targetRoot)
+	}
+}
+
+// checkTarget returns an error if the wizard facts are enabled with a remote target or a target root,
+// the facts are gathered from the local machine and would not be the ones of the target
+func (t *Task) checkTarget() error {
+	if t.wizardFacts == nil {
+		return nil
+	}
+	if t.targetRoot != "" {
+		return fmt.Errorf("the wizard facts are of the local machine, they can not be used with the target root %s", t.targetRoot)
+	}
+	if t.target != nil && t.target != transport.Local {
+		return fmt.Errorf("the wizard facts are of the local machine, they can not be used with a remote target")
+	}
+	return nil
+}
+
+// Register returns the register of an action of the last run, nil if not found
+// The register of an action without the register field is named after the hash of its name, see register.GetHash
+func (t *Task) Register(name string) *register.Register {
+	return t.registers.Get(name)
+}
+
+// Registers returns the registers of the last run by name
+func (t *Task) Registers() map[string]*register.Register {
+	return t.registers.All()
+}
+
 var wizardLog chan interface{}
 
 // NewWithLog parses the config and returns task struct
 func NewWithLog(config []byte, packageFiles embed.FS, tmplOptions TemplateOptions) (*Task, chan interface{}, error) {
 	wizardLog = make(chan interface{})
-	taskList, err := parser.ParseConfig(config)
+	actions.PackageFiles = packageFiles
+	loader := newIncludeLoader(config)
+	taskList, err := parser.ParseConfigOptions(config, parser.ParseOptions{Format: tmplOptions.ConfigFormat, Load: loader.load})
 	if err != nil {
 		return nil, wizardLog, fmt.Errorf("NewWithLog: %s", err.Error())
 	}
 
 	var wizardFacts map[string]interface{}
 	if tmplOptions.EnableWizardFacts {
-		wizardFacts, err = parser.ParseWizardFacts()
-		if err != nil {
-			return nil, wizardLog, fmt.Errorf("NewWithLog: %s", err.Error())
-		}
+		wizardFacts = tmplOptions.wizardFacts()
 	}
 
 	parser.SetEnv()
 
-	actions.PackageFiles = packageFiles
+	if err = taskList.Validate(action.Validate); err != nil {
+		return nil, wizardLog, fmt.Errorf("NewWithLog: %w", err)
+	}
 	return &Task{
 		taskList:       taskList,
 		actionFactory:  action.NewActionsFactory(),
 		templateConfig: tmplOptions.TemplateConfig,
 		wizardFacts:    wizardFacts,
+		registers:      register.NewStore(),
+		configHash:     loader.hash(),
+		logLevel:       wlog.LevelDebug,
+		eventQueue:     EventQueue{Size: defaultEventQueueSize},
 	}, wizardLog, nil
 }
 
+// InterruptedError is returned when the run is cancelled, it reports the action that was running or was about to run
+type InterruptedError struct {
+	Task   string
+	Action string
+	Name   string
+	Err    error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("perform: Task: %s Action: %s, Name: %s, interrupted: %s", e.Task, e.Action, e.Name, e.Err.Error())
+}
+
+// Unwrap returns the context error which caused the interruption
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
 // Perform iterates through each task and performs actions based on the priority list
 // Takes the log chan as input parameter to input logs
 func (t *Task) Perform(logCh chan interface{}) error {
+	return t.PerformContext(context.Background(), logCh)
+}
+
+// PerformContext is the same as Perform, but the run is stopped once the ctx is cancelled
+// The running action receives the ctx, and an *InterruptedError is returned with the interrupted action
+func (t *Task) PerformContext(ctx context.Context, logCh chan interface{}) error {
+	defer close(logCh)
+	return t.dispatch(nil, ChannelEventHandler{LogCh: logCh}, func(logCh chan interface{}) error {
+		return t.perform(ctx, nil, logCh)
+	})
+}
+
+// Resume continues the run saved in the state file, see SetStateFile
+// The completed actions are skipped and their registers restored, so the when conditions behave like in the failed run
+// The state file of another config is discarded and the run starts from the first task
+func (t *Task) Resume(logCh chan interface{}) error {
+	return t.ResumeContext(context.Background(), logCh)
+}
+
+// ResumeContext is the same as Resume, but the run is stopped once the ctx is cancelled
+func (t *Task) ResumeContext(ctx context.Context, logCh chan interface{}) error {
 	defer close(logCh)
-	for _, priorityName := range t.taskList.Priority {
-		taskName := priorityName
-		taskActions := t.taskList.Tasks[taskName]
-		for _, play := range taskActions {
-			logCh <- wlog.WLInfo(fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s", taskName, play.Action, play.Name))
-			if play.Register == "" {
-				play.Register = register.GetHash(play.Name)
-			}
-			register.RMap[play.Register] = &register.Register{}
-			newAction := t.actionFactory.NewActions(play, taskName, t.templateConfig, t.wizardFacts, play.Timeout, play.Register)
-			err := newAction.Do(play, logCh)
-			if err != nil {
-				aRegister := register.RMap[play.Register]
-				aRegister.StdErr = err.Error()
-
-				if err.Error() == "whenNotSatisfied" {
-					logCh <- wlog.WLWarn(fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", taskName, play.Action, play.Name, err.Error()))
-					continue
-				} else if !play.IgnoreError {
-					logCh <- wlog.WLError(fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", taskName, play.Action, play.Name, err.Error()))
-					return fmt.Errorf("perform: Task: %s Action: %s, Name: %s, Error: %s", taskName, play.Action, play.Name, err.Error())
-				}
-			}
+	return t.dispatch(nil, ChannelEventHandler{LogCh: logCh}, func(logCh chan interface{}) error {
+		return t.resume(ctx, logCh)
+	})
+}
+
+// resume loads the state file and performs the run from it
+func (t *Task) resume(ctx context.Context, logCh chan interface{}) error {
+	if t.stateFile == "" {
+		return fmt.Errorf("resume: no state file set")
+	}
+	resumed, err := loadState(t.stateFile)
+	if err != nil {
+		return fmt.Errorf("resume: %s", err.Error())
+	}
+	if resumed == nil {
+		logCh <- wlog.WLInfo(fmt.Sprintf("Resume: no state file %s, starting from the first task", t.stateFile))
+	} else if resumed.ConfigHash != t.stateHash() {
+		logCh <- wlog.WLWarn(fmt.Sprintf("Resume: state file %s is of another config or filters, starting from the first task", t.stateFile))
+		resumed = nil
+	}
+	return t.perform(ctx, resumed, logCh)
+}
+
+// perform runs the tasks and the handlers, the actions completed in the resumed state are skipped
+func (t *Task) perform(ctx context.Context, resumed *state, logCh chan interface{}) error {
+	t.registers = register.NewStore()
+	if resumed != nil {
+		for name, r := range resumed.Registers {
+			t.registers.Set(name, r)
+		}
+	}
+	t.checkpoint = nil
+	if t.stateFile != "" {
+		t.checkpoint = newCheckpoint(t.stateFile, t.stateHash(), resumed)
+	}
+	t.opts.Registers = t.registers
+	t.changes = nil
+	t.notified = newNotifications()
+	t.funcMap = t.templateFuncs()
+	t.report = newRunReport(logCh)
+	if err := t.filters.validate(t.taskList); err != nil {
+		err = fmt.Errorf("perform: %s", err.Error())
+		t.report.finish(err)
+		return err
+	}
+	if err := t.checkTarget(); err != nil {
+		err = fmt.Errorf("perform: %s", err.Error())
+		t.report.finish(err)
+		return err
+	}
+	err := t.runGraph(ctx, logCh)
+	if err == nil && t.taskList.FlushHandlers != parser.FlushHandlersTask && !t.notified.empty() {
+		run := &taskRun{name: "handlers", notified: t.notified, report: t.report.startTask("handlers")}
+		err = t.flushHandlers(ctx, run, logCh)
+		run.report.finish(err)
+	}
+	rolledBack := err != nil && t.opts.Transactional
+	if rolledBack {
+		err = t.rollback(err, logCh)
+	}
+	// the actions reverted by the rollback are not completed anymore, Resume starts from the first task
+	if err == nil || rolledBack {
+		if rmErr := t.checkpoint.remove(); rmErr != nil {
+			logCh <- wlog.WLWarn(rmErr.Error())
+		}
+	}
+	t.report.finish(err)
+	return err
+}
+
+// runTask performs the actions of a task one after the other
+func (t *Task) runTask(ctx context.Context, taskName string, logCh chan interface{}) (err error) {
+	run := &taskRun{name: taskName, notified: t.notified, report: t.report.startTask(taskName), filtered: true}
+	defer func() { run.report.finish(err) }()
+
+	if t.taskList.FlushHandlers == parser.FlushHandlersTask {
+		run.notified = newNotifications()
+	}
+	taskSelected := t.filters.taskSelected(taskName)
+	if !taskSelected {
+		run.report.Status = StatusSkipped
+	}
+	completed := t.checkpoint.completed(taskName)
+	for i, play := range t.taskList.Tasks[taskName] {
+		run.tags = t.taskList.ActionTags(taskName, play)
+		if !taskSelected || !t.filters.selected(run.tags, play) {
+			t.skipFiltered(run, play, logCh)
+			continue
+		}
+		if i < completed {
+			t.skipCompleted(run, play, logCh)
+			continue
+		}
+		if err := t.performAction(ctx, run, play, logCh); err != nil {
+			return err
+		}
+		if err := t.checkpoint.actionDone(taskName, i+1, t.actionRegisters(play)); err != nil {
+			logCh <- wlog.WLWarn(err.Error())
+		}
+	}
+	if t.taskList.FlushHandlers == parser.FlushHandlersTask {
+		return t.flushHandlers(ctx, run, logCh)
+	}
+	return nil
+}
+
+// skipCompleted reports an action completed by the resumed run as skipped
+// Its restored register notifies the handlers again if it changed the system, as they may not have run
+func (t *Task) skipCompleted(run *taskRun, play *parser.Action, logCh chan interface{}) {
+	if play.Register == "" {
+		play.Register = register.GetHash(play.Name)
+	}
+	logCh <- actionLog(wlog.LevelInfo, run.name, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, completed by the resumed run", run.name, play.Action, play.Name))
+	aRegister := t.registers.Get(play.Register)
+	if aRegister != nil && aRegister.Changed {
+		run.notified.notify(play.Notify)
+	}
+	for _, nested := range play.Nested() {
+		if r := t.registers.Get(nested.Register); nested.Register != "" && r != nil && r.Changed {
+			run.notified.notify(nested.Notify)
+		}
+	}
+	run.report.addAction(play.Name, play.Action, time.Now(), StatusSkipped, aRegister, nil)
+}
+
+// performAction renders the action and runs it, once per item if it has a loop, or performs a block
+func (t *Task) performAction(ctx context.Context, run *taskRun, play *parser.Action, logCh chan interface{}) error {
+	if play.Action == parser.ActionBlock {
+		return t.performBlock(ctx, run, play, logCh)
+	}
+	if play.Loop != nil {
+		return t.performLoop(ctx, run, play, logCh)
+	}
+	if play.Register == "" {
+		play.Register = register.GetHash(play.Name)
+	}
+	start := time.Now()
+	rendered, err := t.renderAction(play, nil)
+	if err != nil {
+		run.report.addAction(play.Name, play.Action, start, StatusFailed, nil, err)
+		logCh <- actionLog(wlog.LevelError, run.name, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", run.name, play.Action, play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+		return fmt.Errorf("perform: Task: %s Action: %s, Name: %s, Error: %s", run.name, play.Action, play.Name, err.Error())
+	}
+	return t.performRendered(ctx, run, rendered, logCh)
+}
+
+// performRendered runs a single rendered action, an unsatisfied when condition and an ignored error are not returned
+// The handlers notified by the action are added to the notified handlers of the run if the action changed the system
+func (t *Task) performRendered(ctx context.Context, run *taskRun, play *parser.Action, logCh chan interface{}) error {
+	start := time.Now()
+	taskName := run.name
+	if ctx.Err() != nil {
+		run.report.addAction(play.Name, play.Action, start, StatusFailed, nil, ctx.Err())
+		logCh <- actionLog(wlog.LevelError, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, interrupted before start", taskName, play.Action, play.Name))
+		return &InterruptedError{Task: taskName, Action: play.Action, Name: play.Name, Err: ctx.Err()}
+	}
+	logCh <- actionLog(wlog.LevelInfo, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s", taskName, play.Action, play.Name))
+	logCh <- actionStartEvent{Task: taskName, Name: play.Name, Action: play.Action, Start: start}
+	t.registers.Set(play.Register, &register.Register{})
+	newAction := t.actionFactory.NewActions(play, taskName, t.templateConfig, t.wizardFacts, play.Timeout, play.Register, t.opts)
+	if newAction == nil {
+		err := fmt.Errorf("unknown action %q", play.Action)
+		run.report.addAction(play.Name, play.Action, start, StatusFailed, nil, err)
+		logCh <- actionLog(wlog.LevelError, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", taskName, play.Action, play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+		return fmt.Errorf("perform: Task: %s Action: %s, Name: %s, Error: %s", taskName, play.Action, play.Name, err.Error())
+	}
+	actionCh, closeActionLogs := actionLogs(logCh, taskName, play)
+	err := t.doWithRetries(ctx, taskName, play, newAction, actionCh)
+	closeActionLogs()
+	if t.opts.Transactional {
+		t.recordChange(taskName, play, newAction, err)
+	}
+	aRegister := t.registers.Get(play.Register)
+	if aRegister.Changed {
+		run.notified.notify(play.Notify)
+	}
+	if err == nil {
+		status := StatusOK
+		if aRegister.Changed {
+			status = StatusChanged
 		}
+		run.report.addAction(play.Name, play.Action, start, status, aRegister, nil)
+		return nil
+	}
+
+	aRegister.StdErr = err.Error()
+	if ctx.Err() != nil {
+		run.report.addAction(play.Name, play.Action, start, StatusFailed, aRegister, err)
+		logCh <- actionLog(wlog.LevelError, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, interrupted: %s", taskName, play.Action, play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+		return &InterruptedError{Task: taskName, Action: play.Action, Name: play.Name, Err: ctx.Err()}
+	} else if err.Error() == "whenNotSatisfied" {
+		run.report.addAction(play.Name, play.Action, start, StatusSkipped, aRegister, nil)
+		logCh <- actionLog(wlog.LevelWarn, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", taskName, play.Action, play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+	} else if !play.IgnoreError {
+		run.report.addAction(play.Name, play.Action, start, StatusFailed, aRegister, err)
+		logCh <- actionLog(wlog.LevelError, taskName, play.Action, play.Name, fmt.Sprintf("Perform: Task: %s Action: %s, Name: %s, Err: %s", taskName, play.Action, play.Name, err.Error()), wlog.Field{Key: "error", Value: err.Error()})
+		return fmt.Errorf("perform: Task: %s Action: %s, Name: %s, Error: %s", taskName, play.Action, play.Name, err.Error())
+	} else {
+		run.report.addAction(play.Name, play.Action, start, StatusIgnored, aRegister, err)
 	}
 	return nil
 }
@@ -136,19 +523,14 @@ func (t *Task) Perform(logCh chan interface{}) error {
 // Returns an []interface, error
 // []interface are logs of wlog pkg types
 func (t *Task) Execute() ([]interface{}, error) {
-	var err error
-	logs := []interface{}{}
-	logCh := make(chan interface{})
-
-	// spawns the main logic
-	go func() {
-		err = t.Perform(logCh)
-	}()
-
-	// Waits for the go routine to complete and collects logs
-	for v := range logCh {
-		logs = append(logs, v)
-	}
+	return t.ExecuteContext(context.Background())
+}
 
-	return logs, err
+// ExecuteContext is the same as Execute, but the run is stopped once the ctx is cancelled
+func (t *Task) ExecuteContext(ctx context.Context) ([]interface{}, error) {
+	collector := &logCollector{logs: []interface{}{}}
+	err := t.dispatch(collector, nil, func(logCh chan interface{}) error {
+		return t.perform(ctx, nil, logCh)
+	})
+	return collector.logs, err
 }
@@ -15,13 +15,29 @@
 package task
 
 import (
+	"context"
 	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	actions_factory_mock "github.com/acceldata-io/wizard/factory/action/mocks"
+	"github.com/acceldata-io/wizard/internal/parser"
+	"github.com/acceldata-io/wizard/pkg/actions"
 	mock_actions "github.com/acceldata-io/wizard/pkg/actions/mocks"
+	"github.com/acceldata-io/wizard/pkg/facts"
+	"github.com/acceldata-io/wizard/pkg/register"
+	"github.com/acceldata-io/wizard/pkg/transport"
+	"github.com/acceldata-io/wizard/pkg/transport/sshtest"
+	"github.com/acceldata-io/wizard/pkg/wlog"
 	"github.com/golang/mock/gomock"
 )
 
@@ -48,16 +64,27 @@ func TestNewPass(t *testing.T) {
 	}
 }
 
+func TestNewYAML(t *testing.T) {
+	file, _ := os.ReadFile("../testdata/parser_config_pass.yaml")
+	task, err := New(file, embed.FS{}, TemplateOptions{ConfigFormat: ConfigFormatYAML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(task.taskList.Tasks["hydra"]) != 9 {
+		t.Fatalf("unexpected tasks: %v", task.taskList.Tasks)
+	}
+}
+
 func TestPerformPass(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	actionsMock := mock_actions.NewMockAction(ctrl)
-	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any()).Times(2).Return(nil)
+	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(nil)
 
 	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
-	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
-	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra2", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra2", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
 
 	file, _ := os.ReadFile("../testdata/task_pass.json")
 	task, err := New(file, embed.FS{}, TemplateOptions{
@@ -83,11 +110,11 @@ func TestPerformWhenError(t *testing.T) {
 	defer ctrl.Finish()
 
 	actionsMock := mock_actions.NewMockAction(ctrl)
-	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any()).Times(2).Return(fmt.Errorf("whenNotSatisfied"))
+	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(fmt.Errorf("whenNotSatisfied"))
 
 	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
-	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
-	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra2", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra2", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
 
 	file, _ := os.ReadFile("../testdata/task_pass.json")
 	task, err := New(file, embed.FS{}, TemplateOptions{
@@ -112,10 +139,10 @@ func TestPerformIgnoreErrorFalse(t *testing.T) {
 	defer ctrl.Finish()
 
 	actionsMock := mock_actions.NewMockAction(ctrl)
-	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any()).Times(1).Return(fmt.Errorf("random error"))
+	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(fmt.Errorf("random error"))
 
 	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
-	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
 
 	file, _ := os.ReadFile("../testdata/task_pass.json")
 	task, err := New(file, embed.FS{}, TemplateOptions{
@@ -140,10 +167,10 @@ func TestPerformIgnoreErrorTrue(t *testing.T) {
 	defer ctrl.Finish()
 
 	actionsMock := mock_actions.NewMockAction(ctrl)
-	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any()).Times(1).Return(fmt.Errorf("random error"))
+	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(fmt.Errorf("random error"))
 
 	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
-	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra2", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra2", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
 
 	file, _ := os.ReadFile("../testdata/task_ignore_error_true.json")
 	task, err := New(file, embed.FS{}, TemplateOptions{
@@ -162,3 +189,1359 @@ func TestPerformIgnoreErrorTrue(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestPerformContextCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	actionsMock := mock_actions.NewMockAction(ctrl)
+	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, _ *parser.Action, _ chan interface{}) error {
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+
+	file, _ := os.ReadFile("../testdata/task_pass.json")
+	task, err := New(file, embed.FS{}, TemplateOptions{
+		EnableWizardFacts: false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task.actionFactory = actionsFactoryMock
+	_, err = task.ExecuteContext(ctx)
+
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) {
+		t.Fatalf("expected an InterruptedError, got: %v", err)
+	}
+	if interrupted.Task != "hydra" || interrupted.Action != "copy" {
+		t.Fatalf("unexpected interrupted action: %+v", interrupted)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestPerformDependsOnParallel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var started sync.WaitGroup
+	started.Add(2)
+	var mu sync.Mutex
+	done := map[string]bool{}
+
+	actionsMock := mock_actions.NewMockAction(ctrl)
+	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any(), gomock.Any()).Times(3).DoAndReturn(
+		func(_ context.Context, play *parser.Action, _ chan interface{}) error {
+			if play.Name == "start service" {
+				mu.Lock()
+				defer mu.Unlock()
+				if !done["create users"] || !done["copy binaries"] {
+					return fmt.Errorf("service started before its dependencies")
+				}
+				return nil
+			}
+			// both independent tasks have to be running at the same time to get past the barrier
+			started.Done()
+			waitCh := make(chan struct{})
+			go func() {
+				started.Wait()
+				close(waitCh)
+			}()
+			select {
+			case <-waitCh:
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("independent tasks did not run in parallel")
+			}
+			mu.Lock()
+			done[play.Name] = true
+			mu.Unlock()
+			return nil
+		})
+
+	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3).Return(actionsMock)
+
+	file, _ := os.ReadFile("../testdata/task_depends_on.json")
+	task, err := New(file, embed.FS{}, TemplateOptions{
+		EnableWizardFacts: false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.SetParallelism(2)
+
+	task.actionFactory = actionsFactoryMock
+	if _, err = task.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPerformDependsOnFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	actionsMock := mock_actions.NewMockAction(ctrl)
+	actionsMock.EXPECT().Do(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(
+		func(_ context.Context, play *parser.Action, _ chan interface{}) error {
+			if play.Name == "create users" {
+				return fmt.Errorf("random error")
+			}
+			return nil
+		})
+
+	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "users", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "binaries", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(actionsMock)
+
+	file, _ := os.ReadFile("../testdata/task_depends_on.json")
+	task, err := New(file, embed.FS{}, TemplateOptions{
+		EnableWizardFacts: false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task.actionFactory = actionsFactoryMock
+	if _, err = task.Execute(); err == nil {
+		t.Fatal("expected the failure of users to stop the service task")
+	}
+}
+
+// newActions returns a NewActions func for the factory mock, it builds the action with the registers of the run
+func newActions(build func(registers *register.Store) actions.Action) interface{} {
+	return func(_ *parser.Action, _ string, _ interface{}, _ map[string]interface{}, _ int, _ string, opts actions.Options) actions.Action {
+		return build(opts.Registers)
+	}
+}
+
+// revertAction changes the system unless it fails, and records its revert
+type revertAction struct {
+	name      string
+	err       error
+	reverted  *[]string
+	registers *register.Store
+}
+
+func (r *revertAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	r.registers.Get(play.Register).Changed = r.err == nil
+	return r.err
+}
+
+func (r *revertAction) Revert(_ context.Context, _ chan interface{}) error {
+	*r.reverted = append(*r.reverted, r.name)
+	return nil
+}
+
+func TestPerformTransactionalRollback(t *testing.T) {
+	for _, transactional := range []bool{true, false} {
+		ctrl := gomock.NewController(t)
+
+		var reverted []string
+		actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+		actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+			return &revertAction{name: "hydra", reverted: &reverted, registers: registers}
+		}))
+		actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "hydra2", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+			return &revertAction{name: "hydra2", err: fmt.Errorf("random error"), reverted: &reverted, registers: registers}
+		}))
+
+		file, _ := os.ReadFile("../testdata/task_pass.json")
+		task, err := New(file, embed.FS{}, TemplateOptions{
+			EnableWizardFacts: false,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		task.actionFactory = actionsFactoryMock
+		task.SetTransactional(transactional)
+		if _, err = task.Execute(); err == nil {
+			t.Fatal("expected the error of hydra2")
+		}
+
+		var want []string
+		if transactional {
+			want = []string{"hydra2", "hydra"}
+		}
+		if !reflect.DeepEqual(want, reverted) {
+			t.Fatalf("transactional: %v, expected reverted: %v, got: %v", transactional, want, reverted)
+		}
+		ctrl.Finish()
+	}
+}
+
+// changeAction reports a change unless its name is in unchanged, and records the performed names
+type changeAction struct {
+	unchanged map[string]bool
+	performed *[]string
+	registers *register.Store
+}
+
+func (c *changeAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	*c.performed = append(*c.performed, play.Name)
+	c.registers.Get(play.Register).Changed = !c.unchanged[play.Name]
+	return nil
+}
+
+func TestPerformHandlers(t *testing.T) {
+	for _, flush := range []string{parser.FlushHandlersRun, parser.FlushHandlersTask} {
+		ctrl := gomock.NewController(t)
+
+		var performed []string
+		actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+		actionsFactoryMock.EXPECT().NewActions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+			return &changeAction{unchanged: map[string]bool{"logging config": true}, performed: &performed, registers: registers}
+		}))
+
+		file, _ := os.ReadFile("../testdata/task_handlers.json")
+		task, err := New(file, embed.FS{}, TemplateOptions{
+			EnableWizardFacts: false,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.taskList.FlushHandlers = flush
+
+		task.actionFactory = actionsFactoryMock
+		if _, err = task.Execute(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"core config", "site config", "logging config", "restart app"}
+		if flush == parser.FlushHandlersTask {
+			want = []string{"core config", "site config", "restart app", "logging config"}
+		}
+		if !reflect.DeepEqual(want, performed) {
+			t.Fatalf("flush_handlers: %s, expected: %v, got: %v", flush, want, performed)
+		}
+		ctrl.Finish()
+	}
+}
+
+// flakyAction fails until its last output, then succeeds
+type flakyAction struct {
+	outputs   []string
+	registers *register.Store
+}
+
+func (f *flakyAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	output := f.outputs[0]
+	f.outputs = f.outputs[1:]
+	f.registers.Get(play.Register).StdOut = output
+	if output == "error" {
+		return fmt.Errorf("random error")
+	}
+	return nil
+}
+
+func TestPerformRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		outputs      []string
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "retry on error",
+			config:       `{"tasks": {"a": [{"action": "cmd", "command": ["true"], "name": "poll", "register": "poll", "retries": 2}]}, "priority": ["a"]}`,
+			outputs:      []string{"error", "error", "ok"},
+			wantAttempts: 3,
+		},
+		{
+			name:         "retry until",
+			config:       `{"tasks": {"a": [{"action": "cmd", "command": ["true"], "name": "poll", "register": "poll", "retries": 3, "until": "poll.stdout eq healthy", "backoff": 2}]}, "priority": ["a"]}`,
+			outputs:      []string{"starting", "error", "healthy"},
+			wantAttempts: 3,
+		},
+		{
+			name:         "retries exhausted",
+			config:       `{"tasks": {"a": [{"action": "cmd", "command": ["true"], "name": "poll", "register": "poll", "retries": 1, "until": "poll.stdout eq healthy"}]}, "priority": ["a"]}`,
+			outputs:      []string{"starting", "starting"},
+			wantErr:      true,
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tc := range tests {
+		ctrl := gomock.NewController(t)
+		actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+		actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "a", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+			return &flakyAction{outputs: tc.outputs, registers: registers}
+		}))
+
+		task, err := New([]byte(tc.config), embed.FS{}, TemplateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.actionFactory = actionsFactoryMock
+		_, err = task.Execute()
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("%s: expected error: %v, got: %v", tc.name, tc.wantErr, err)
+		}
+		if attempts := task.Register("poll").Attempts; len(attempts) != tc.wantAttempts || attempts[0].StdOut != tc.outputs[0] {
+			t.Fatalf("%s: expected %d attempts, got: %v", tc.name, tc.wantAttempts, attempts)
+		}
+		ctrl.Finish()
+	}
+}
+
+// failOnceAction fails its first attempt after changing the system, and succeeds without changes after
+type failOnceAction struct {
+	registers *register.Store
+	attempts  int
+}
+
+func (f *failOnceAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	f.attempts++
+	aRegister := f.registers.Get(play.Register)
+	if f.attempts == 1 {
+		aRegister.Changed, aRegister.StdErr, aRegister.ExitCode = true, "partial failure", 2
+		return fmt.Errorf("partial failure")
+	}
+	aRegister.StdOut = "done"
+	return nil
+}
+
+func TestPerformRetriesReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "a", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+		return &failOnceAction{registers: registers}
+	}))
+
+	// the until condition only sees the result of the second attempt
+	config := `{"tasks": {"a": [{"action": "cmd", "command": ["true"], "name": "poll", "register": "poll", "retries": 1, "until": "poll.exit_code eq 0"}]}, "priority": ["a"]}`
+	task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.actionFactory = actionsFactoryMock
+	if _, err = task.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	r := task.Register("poll")
+	if r.Changed || r.StdErr != "" || r.ExitCode != 0 || r.StdOut != "done" || len(r.Attempts) != 2 || !r.Attempts[0].Changed {
+		t.Fatalf("expected the register of the second attempt only, got %+v", r)
+	}
+}
+
+// echoAction sets the stdout of its register to the name of its action_var
+type echoAction struct {
+	registers *register.Store
+}
+
+func (e echoAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	aRegister := e.registers.Get(play.Register)
+	aRegister.StdOut = fmt.Sprint(play.ActionVariables["name"], " ", play.Command)
+	aRegister.Changed = play.ActionVariables["name"] != "kafka"
+	return nil
+}
+
+func TestPerformLoop(t *testing.T) {
+	type templateConfig struct {
+		Services struct {
+			Names []string
+		}
+	}
+	config := templateConfig{}
+	config.Services.Names = []string{"kafka", "zookeeper"}
+
+	tests := []struct {
+		name       string
+		loop       string
+		wantStdOut string
+	}{
+		{
+			name:       "list",
+			loop:       `[{"name": "kafka"}, {"name": "zookeeper"}]`,
+			wantStdOut: "kafka [echo 0 kafka]\nzookeeper [echo 1 zookeeper]",
+		},
+		{
+			name:       "TemplateConfig field",
+			loop:       `"Services.Names"`,
+			wantStdOut: "kafka [echo 0 kafka]\nzookeeper [echo 1 zookeeper]",
+		},
+	}
+
+	for _, tc := range tests {
+		ctrl := gomock.NewController(t)
+		actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+		actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "a", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+			return echoAction{registers: registers}
+		}))
+
+		name := `{{ item }}`
+		if tc.name == "list" {
+			name = `{{ (item).name }}`
+		}
+		task, err := New([]byte(`{"tasks": {"a": [{"action": "cmd", "name": "service", "register": "services", "loop": `+tc.loop+`,
+			"command": ["echo", "{{ loop_index }}", "`+name+`"], "action_var": {"name": "`+name+`"}}]}, "priority": ["a"]}`), embed.FS{}, TemplateOptions{TemplateConfig: config})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.actionFactory = actionsFactoryMock
+		if _, err = task.Execute(); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		aggregate := task.Register("services")
+		if aggregate.StdOut != tc.wantStdOut || !aggregate.Changed || len(aggregate.Results) != 2 {
+			t.Fatalf("%s: unexpected register: %+v", tc.name, aggregate)
+		}
+		if task.Register("services[0]").Changed || !task.Register("services[1]").Changed {
+			t.Fatalf("%s: unexpected iteration registers", tc.name)
+		}
+		ctrl.Finish()
+	}
+}
+
+// recordAction records the actions it performs and sets its stdout
+type recordAction struct {
+	stdOut    string
+	plays     *[]*parser.Action
+	registers *register.Store
+}
+
+func (r recordAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	*r.plays = append(*r.plays, play)
+	r.registers.Get(play.Register).StdOut = r.stdOut
+	return nil
+}
+
+func TestPerformRenderActions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var plays []*parser.Action
+	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), "a", gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2).DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+		return recordAction{stdOut: "1.2", plays: &plays, registers: registers}
+	}))
+
+	config := struct{ Dir string }{Dir: "/opt/agent"}
+	task, err := New([]byte(`{"tasks": {"a": [
+		{"action": "cmd", "name": "version", "register": "version", "command": ["cat", "{{ .Dir }}/VERSION"]},
+		{"action": "cmd", "name": "install {{ upper \"agent\" }}", "command": ["install.sh", "{{ .Dir }}/{{ (register \"version\").StdOut }}"],
+			"action_var": {"dest": ["{{ .Dir }}/conf"]}, "when": {"cmd": "test -d {{ .Dir }}"}}
+	]}, "priority": ["a"]}`), embed.FS{}, TemplateOptions{TemplateConfig: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.actionFactory = actionsFactoryMock
+	if _, err = task.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(plays[0].Command, []string{"cat", "/opt/agent/VERSION"}) {
+		t.Fatalf("unexpected command: %v", plays[0].Command)
+	}
+	install := plays[1]
+	if install.Name != "install AGENT" || !reflect.DeepEqual(install.Command, []string{"install.sh", "/opt/agent/1.2"}) ||
+		!reflect.DeepEqual(install.ActionVariables, map[string]interface{}{"dest": []interface{}{"/opt/agent/conf"}}) || install.When.Command != "test -d /opt/agent" {
+		t.Fatalf("unexpected action: %+v", install)
+	}
+	if task.taskList.Tasks["a"][1].Command[1] != `{{ .Dir }}/{{ (register "version").StdOut }}` {
+		t.Fatal("the action of the task list should not be modified")
+	}
+}
+
+func TestConcurrentRunsRegisters(t *testing.T) {
+	var wg sync.WaitGroup
+	tasks := make([]*Task, 4)
+	errs := make([]error, len(tasks))
+	for i := range tasks {
+		config := fmt.Sprintf(`{"tasks": {"a": [
+			{"action": "cmd", "name": "echo", "register": "out", "command": ["echo", "-n", "run %d"], "until": "out.exit_code eq 0"}
+		]}, "priority": ["a"]}`, i)
+		task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tasks[i] = task
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = tasks[i].Execute()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, task := range tasks {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if got := task.Register("out").StdOut; got != fmt.Sprintf("run %d", i) {
+			t.Fatalf("run %d: unexpected stdout %q", i, got)
+		}
+	}
+}
+
+// statusAction changes the system or returns an error depending on the name of the action
+type statusAction struct {
+	registers *register.Store
+}
+
+func (s statusAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	switch play.Name {
+	case "changed":
+		s.registers.Get(play.Register).Changed = true
+	case "skipped":
+		return fmt.Errorf("whenNotSatisfied")
+	case "ignored", "failed":
+		return fmt.Errorf("random error")
+	}
+	return nil
+}
+
+func TestPerformReport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(5).DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+		return statusAction{registers: registers}
+	}))
+
+	task, err := New([]byte(`{"tasks": {
+		"a": [
+			{"action": "cmd", "command": ["true"], "name": "changed"},
+			{"action": "cmd", "command": ["true"], "name": "ok"},
+			{"action": "cmd", "command": ["true"], "name": "skipped"},
+			{"action": "cmd", "command": ["true"], "name": "ignored", "ignore_error": true}
+		],
+		"b": [{"action": "cmd", "command": ["true"], "name": "failed"}]
+	}, "priority": ["a", "b"]}`), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.actionFactory = actionsFactoryMock
+	if _, err = task.Execute(); err == nil {
+		t.Fatal("expected the error of b")
+	}
+
+	report := task.Report()
+	if report.Status != StatusFailed || report.Error != err.Error() || len(report.Tasks) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Tasks[0].Status != StatusChanged || report.Tasks[1].Status != StatusFailed {
+		t.Fatalf("unexpected task status: %s, %s", report.Tasks[0].Status, report.Tasks[1].Status)
+	}
+	for _, action := range append(report.Tasks[0].Actions, report.Tasks[1].Actions...) {
+		if string(action.Status) != action.Name {
+			t.Fatalf("action %s: unexpected status %s", action.Name, action.Status)
+		}
+		if action.Register == nil || action.End.Before(action.Start) {
+			t.Fatalf("action %s: unexpected report: %+v", action.Name, action)
+		}
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(reportJSON), `"name":"changed","action":"cmd","status":"changed"`) {
+		t.Fatalf("unexpected JSON: %s", reportJSON)
+	}
+}
+
+// resumeAction counts the runs of each action, b1 fails until failB1 is cleared
+type resumeAction struct {
+	runs      map[string]int
+	failB1    *bool
+	registers *register.Store
+}
+
+func (r resumeAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	r.runs[play.Name]++
+	aRegister := r.registers.Get(play.Register)
+	aRegister.StdOut = play.Name
+	aRegister.Changed = true
+	if play.Name == "b1" && *r.failB1 {
+		return fmt.Errorf("random error")
+	}
+	return nil
+}
+
+// resume runs Resume and drains the log chan
+func resume(task *Task) error {
+	logCh := make(chan interface{})
+	done := make(chan error)
+	go func() { done <- task.Resume(logCh) }()
+	for range logCh {
+	}
+	return <-done
+}
+
+func TestResume(t *testing.T) {
+	config := `{"tasks": {
+		"a": [
+			{"action": "cmd", "command": ["true"], "name": "a1", "register": "a1", "notify": ["h"]},
+			{"action": "cmd", "command": ["true"], "name": "a2"}
+		],
+		"b": [{"action": "cmd", "command": ["true"], "name": "b1"}]
+	}, "priority": ["a", "b"], "handlers": [{"action": "cmd", "command": ["true"], "name": "h"}]}`
+
+	for _, changedConfig := range []bool{false, true} {
+		runs := make(map[string]int)
+		failB1 := true
+		newTask := func(config string) *Task {
+			ctrl := gomock.NewController(t)
+			actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+			actionsFactoryMock.EXPECT().NewActions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+				return resumeAction{runs: runs, failB1: &failB1, registers: registers}
+			}))
+			task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			task.actionFactory = actionsFactoryMock
+			return task
+		}
+		stateFile := t.TempDir() + "/state.json"
+
+		task := newTask(config)
+		task.SetStateFile(stateFile)
+		if _, err := task.Execute(); err == nil {
+			t.Fatal("expected the error of b1")
+		}
+		if _, err := os.Stat(stateFile); err != nil {
+			t.Fatalf("expected the state file: %s", err)
+		}
+
+		failB1 = false
+		resumeConfig := config
+		if changedConfig {
+			resumeConfig += "\n"
+		}
+		task = newTask(resumeConfig)
+		task.SetStateFile(stateFile)
+		if err := resume(task); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]int{"a1": 1, "a2": 1, "b1": 2, "h": 1}
+		if changedConfig {
+			expected = map[string]int{"a1": 2, "a2": 2, "b1": 2, "h": 1}
+		}
+		if !reflect.DeepEqual(runs, expected) {
+			t.Fatalf("changed config %v: unexpected runs %v", changedConfig, runs)
+		}
+		if r := task.Register("a1"); r == nil || r.StdOut != "a1" || !r.Changed {
+			t.Fatalf("expected the register of a1 to be restored, got %+v", r)
+		}
+		if status := task.Report().Tasks[0].Actions[0].Status; !changedConfig && status != StatusSkipped {
+			t.Fatalf("expected a1 to be reported as skipped, got %s", status)
+		}
+		if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+			t.Fatalf("expected the state file to be removed, got %v", err)
+		}
+	}
+}
+
+func TestResumeAfterRollback(t *testing.T) {
+	dir := t.TempDir()
+	config := fmt.Sprintf(`{"tasks": {"a": [
+		{"action": "file", "name": "touch", "action_var": {"files": [{"dest": "%[1]s/touched"}], "state": "touch", "permission": "0640", "owner": "root", "group": "root"}},
+		{"action": "cmd", "name": "check", "command": ["test", "-e", "%[1]s/ready"]}
+	]}, "priority": ["a"]}`, dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.SetTransactional(true)
+	task.SetStateFile(stateFile)
+	if _, err := task.Execute(); err == nil {
+		t.Fatal("expected the error of check")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "touched")); !os.IsNotExist(err) {
+		t.Fatalf("expected the touch to be reverted, got %v", err)
+	}
+	// the reverted touch is not completed, the resumed run performs it again
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Fatalf("expected the state file to be removed by the rollback, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ready"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := resume(task); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "touched")); err != nil {
+		t.Fatalf("expected the touch to be performed again, got %v", err)
+	}
+}
+
+func TestPerformFilters(t *testing.T) {
+	config := `{"tasks": {
+		"users": [{"action": "cmd", "command": ["true"], "name": "create user", "register": "user"}],
+		"agent": [
+			{"action": "cmd", "command": ["true"], "name": "copy agent", "register": "copy"},
+			{"action": "cmd", "command": ["true"], "name": "render config", "register": "render", "tags": ["config"]}
+		],
+		"service": [{"action": "cmd", "command": ["true"], "name": "start agent", "register": "start"}]
+	}, "task_tags": {"users": ["users"], "service": ["config"]}, "priority": ["users", "agent", "service"]}`
+
+	tests := []struct {
+		name                       string
+		includeTags, excludeTags   []string
+		includeTasks, excludeTasks []string
+		expected                   []string
+	}{
+		{name: "no filters", expected: []string{"create user", "copy agent", "render config", "start agent"}},
+		{name: "include tags", includeTags: []string{"config"}, expected: []string{"render config", "start agent"}},
+		{name: "exclude tags", excludeTags: []string{"users", "config"}, expected: []string{"copy agent"}},
+		{name: "include tasks", includeTasks: []string{"agent"}, expected: []string{"copy agent", "render config"}},
+		{name: "exclude tasks and include tags", includeTags: []string{"config"}, excludeTasks: []string{"service"}, expected: []string{"render config"}},
+	}
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		var plays []*parser.Action
+		actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+		actionsFactoryMock.EXPECT().NewActions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+			return recordAction{plays: &plays, registers: registers}
+		}))
+
+		task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.actionFactory = actionsFactoryMock
+		task.SetTags(test.includeTags, test.excludeTags)
+		task.SetTaskFilter(test.includeTasks, test.excludeTasks)
+		if _, err = task.Execute(); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		var performed []string
+		for _, play := range plays {
+			performed = append(performed, play.Name)
+		}
+		if !reflect.DeepEqual(performed, test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, performed)
+		}
+
+		reportSkipped, registerSkipped := 0, 0
+		for _, taskReport := range task.Report().Tasks {
+			for _, action := range taskReport.Actions {
+				if action.Status == StatusSkipped {
+					reportSkipped++
+				}
+			}
+		}
+		for _, name := range []string{"user", "copy", "render", "start"} {
+			if task.Register(name).Skipped {
+				registerSkipped++
+			}
+		}
+		if reportSkipped != 4-len(test.expected) || registerSkipped != reportSkipped {
+			t.Fatalf("%s: expected %d skipped actions, got %d in the report and %d in the registers", test.name, 4-len(test.expected), reportSkipped, registerSkipped)
+		}
+	}
+
+	task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.SetTaskFilter([]string{"unknown"}, nil)
+	if _, err = task.Execute(); err == nil || !strings.Contains(err.Error(), `task "unknown" is not in the priority list`) {
+		t.Fatalf("expected unknown task error, got: %v", err)
+	}
+}
+
+func TestPerformFiltersBlock(t *testing.T) {
+	config := `{"tasks": {"agent": [
+		{"action": "block", "name": "install", "register": "install", "tags": ["install"], "block": [
+			{"action": "cmd", "command": ["true"], "name": "copy agent", "register": "copy"},
+			{"action": "cmd", "command": ["true"], "name": "render config", "register": "render", "tags": ["config"]}
+		], "always": [{"action": "cmd", "command": ["true"], "name": "cleanup", "register": "cleanup", "tags": ["cleanup"]}]}
+	]}, "priority": ["agent"]}`
+
+	tests := []struct {
+		name                     string
+		includeTags, excludeTags []string
+		expected                 []string
+		skipped                  []string
+	}{
+		{name: "no filters", expected: []string{"copy agent", "render config", "cleanup"}},
+		{name: "include nested tag", includeTags: []string{"config"}, expected: []string{"render config"}, skipped: []string{"copy", "cleanup"}},
+		{name: "include block tag", includeTags: []string{"install"}, expected: []string{"copy agent", "render config", "cleanup"}},
+		{name: "exclude nested tag", excludeTags: []string{"config", "cleanup"}, expected: []string{"copy agent"}, skipped: []string{"render", "cleanup"}},
+		{name: "exclude block tag", includeTags: []string{"config"}, excludeTags: []string{"install"}, skipped: []string{"install"}},
+	}
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		var plays []*parser.Action
+		actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+		actionsFactoryMock.EXPECT().NewActions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+			return recordAction{plays: &plays, registers: registers}
+		}))
+
+		task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.actionFactory = actionsFactoryMock
+		task.SetTags(test.includeTags, test.excludeTags)
+		if _, err = task.Execute(); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		var performed []string
+		for _, play := range plays {
+			performed = append(performed, play.Name)
+		}
+		if !reflect.DeepEqual(performed, test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, performed)
+		}
+		for _, name := range test.skipped {
+			if !task.Register(name).Skipped {
+				t.Fatalf("%s: expected %s to be skipped", test.name, name)
+			}
+		}
+	}
+}
+
+func TestNewUnknownAction(t *testing.T) {
+	_, err := New([]byte(`{"tasks": {"a": [{"action": "kafka_topic", "name": "create topic"}]}, "priority": ["a"]}`), embed.FS{}, TemplateOptions{})
+	if err == nil || !strings.Contains(err.Error(), `unknown action "kafka_topic"`) {
+		t.Fatalf("expected unknown action error, got: %v", err)
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	_, err := New([]byte(`{"tasks": {"agent": [
+		{"action": "copy", "name": "copy agent", "action_var": {"src_type": "disk", "src": "/tmp/agent", "dest": "/opt/agent", "permission": "0755", "owner": "root", "group": "root"}},
+		{"action": "user", "name": "create user", "action_var": {"name": "agent", "home": "/opt/agent", "shell": "/bin/sh", "uid": "996", "gid": "996"}},
+		{"action": "file", "name": "touch log", "action_var": {"files": [{"dest": "/var/log/agent.log"}], "state": "touch", "permission": "0644", "owner": "root", "group": "root", "force": "{{ .Force }}"}},
+		{"action": "cmd", "name": "start"}
+	]}, "priority": ["agent"]}`), embed.FS{}, TemplateOptions{})
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a *ValidationError, got: %v", err)
+	}
+	var paths []string
+	for _, problem := range verr.Problems {
+		paths = append(paths, problem.Path)
+	}
+	if expected := []string{"$.tasks.agent[0]", "$.tasks.agent[1]", "$.tasks.agent[3]"}; !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("expected problems at %v, got:\n%s", expected, err)
+	}
+}
+
+func TestNewIncludeVars(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/java.yaml", []byte(`
+tasks:
+  install:
+    - action: cmd
+      name: install java
+      command: [install-java, '{{ var "version" }}']
+priority: [install]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	var plays []*parser.Action
+	actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+	actionsFactoryMock.EXPECT().NewActions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+		return recordAction{plays: &plays, registers: registers}
+	}))
+
+	task, err := New([]byte(`{"tasks": {}, "include": [{"file": "`+dir+`/java.yaml", "src_type": "local", "vars": {"version": "11"}}], "priority": ["java"]}`), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.actionFactory = actionsFactoryMock
+	if _, err = task.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if len(plays) != 1 || !reflect.DeepEqual(plays[0].Command, []string{"install-java", "11"}) {
+		t.Fatalf("expected the command rendered with the include vars, got %v", plays)
+	}
+}
+
+type blockAction struct {
+	plays     *[]*parser.Action
+	registers *register.Store
+}
+
+func (b blockAction) Do(_ context.Context, play *parser.Action, _ chan interface{}) error {
+	*b.plays = append(*b.plays, play)
+	aRegister := b.registers.Get(play.Register)
+	if strings.HasPrefix(play.Name, "fail") {
+		aRegister.ExitCode = 2
+		return errors.New("exit status 2")
+	}
+	aRegister.Changed = true
+	return nil
+}
+
+func TestPerformBlock(t *testing.T) {
+	tests := []struct {
+		name, rescue   string
+		expected       []string
+		expectedStatus Status
+		expectedErr    bool
+	}{
+		{
+			name:           "rescued",
+			rescue:         `, "rescue": [{"action": "cmd", "name": "rollback", "command": ["rollback", "{{ (register \"install\").FailedAction }}", "{{ (register \"install\").ExitCode }}"]}]`,
+			expected:       []string{"copy", "fail start", "rollback", "cleanup"},
+			expectedStatus: StatusRescued,
+		},
+		{
+			name:           "not rescued",
+			expected:       []string{"copy", "fail start", "cleanup"},
+			expectedStatus: StatusFailed,
+			expectedErr:    true,
+		},
+	}
+	for _, test := range tests {
+		ctrl := gomock.NewController(t)
+		var plays []*parser.Action
+		actionsFactoryMock := actions_factory_mock.NewMockActionsFactory(ctrl)
+		actionsFactoryMock.EXPECT().NewActions(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(newActions(func(registers *register.Store) actions.Action {
+			return blockAction{plays: &plays, registers: registers}
+		}))
+
+		task, err := New([]byte(`{"tasks": {"a": [
+			{"action": "block", "name": "install", "register": "install", "block": [
+				{"action": "cmd", "name": "copy", "command": ["true"]},
+				{"action": "cmd", "name": "fail start", "command": ["true"]},
+				{"action": "cmd", "name": "never", "command": ["true"]}
+			]`+test.rescue+`, "always": [{"action": "cmd", "name": "cleanup", "command": ["true"]}]}
+		]}, "priority": ["a"]}`), embed.FS{}, TemplateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.actionFactory = actionsFactoryMock
+		if _, err = task.Execute(); (err != nil) != test.expectedErr {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+
+		var performed []string
+		for _, play := range plays {
+			performed = append(performed, play.Name)
+		}
+		if !reflect.DeepEqual(performed, test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, performed)
+		}
+		if test.rescue != "" && !reflect.DeepEqual(plays[2].Command, []string{"rollback", "fail start", "2"}) {
+			t.Fatalf("%s: expected the failure in the rescue command, got %v", test.name, plays[2].Command)
+		}
+		r := task.Register("install")
+		if !r.Failed || r.FailedAction != "fail start" || r.ExitCode != 2 || !strings.Contains(r.StdErr, "exit status 2") || !r.Changed {
+			t.Fatalf("%s: unexpected block register %+v", test.name, r)
+		}
+		actionReports := task.Report().Tasks[0].Actions
+		if status := actionReports[len(actionReports)-1].Status; status != test.expectedStatus {
+			t.Fatalf("%s: expected the block to be %s, got %s", test.name, test.expectedStatus, status)
+		}
+	}
+}
+
+func TestPerformSSH(t *testing.T) {
+	server, err := sshtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	remote, err := transport.DialSSH(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	src, dest := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "agent.conf"), []byte("port=8080\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf(`{"tasks": {"agent": [
+		{"action": "file", "name": "create dir", "action_var": {"files": [{"dest": "%[2]s/conf"}], "dir": true, "state": "touch", "permission": "0750", "owner": "root", "group": "root"}},
+		{"action": "copy", "name": "copy config", "register": "copy", "action_var": {"src_type": "local", "src": "%[1]s/agent.conf", "dest": "%[2]s/conf/agent.conf", "permission": "0640", "owner": "root", "group": "root"}},
+		{"action": "cmd", "name": "read config", "register": "read", "command": ["cat", "%[2]s/conf/agent.conf"], "when": {"cmd": "test -f %[2]s/conf/agent.conf"}}
+	]}, "priority": ["agent"]}`, src, dest)
+
+	for _, changed := range []bool{true, false} {
+		task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.SetTransport(remote)
+		if _, err := task.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if r := task.Register("copy"); r.Changed != changed {
+			t.Fatalf("expected the copy to be changed %v, got %+v", changed, r)
+		}
+		if r := task.Register("read"); r.StdOut != "port=8080\n" {
+			t.Fatalf("unexpected output of the command over ssh %+v", r)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dest, "conf", "agent.conf")); err != nil || info.Mode().Perm() != 0o640 {
+		t.Fatalf("expected the config copied over ssh, got %v %v", info, err)
+	}
+}
+
+func TestPerformTargetRoot(t *testing.T) {
+	src, root := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "agent.conf"), []byte("port=8080\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "agent.tmpl"), []byte("port={{ .Port }}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the owner only exists in the root, with the ids of the current user to run without privileges
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	passwd := fmt.Sprintf("wizard-agent:x:%d:%d::/opt/agent:/bin/false\n", os.Getuid(), os.Getgid())
+	if err := os.WriteFile(filepath.Join(root, "etc", "passwd"), []byte(passwd), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	group := fmt.Sprintf("wizard-agent:x:%d:\n", os.Getgid())
+	if err := os.WriteFile(filepath.Join(root, "etc", "group"), []byte(group), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf(`{"tasks": {"agent": [
+		{"action": "file", "name": "create dir", "action_var": {"files": [{"dest": "/opt/agent/conf"}], "dir": true, "state": "touch", "permission": "0750", "owner": "wizard-agent", "group": "wizard-agent"}},
+		{"action": "copy", "name": "copy config", "register": "copy", "action_var": {"src_type": "local", "src": "%[1]s/agent.conf", "dest": "/opt/agent/conf/agent.conf", "permission": "0640", "owner": "wizard-agent", "group": "wizard-agent"}},
+		{"action": "template", "name": "render config", "register": "template", "action_var": {"src_type": "local", "src": "%[1]s/agent.tmpl", "dest": "/opt/agent/conf/agent.properties", "permission": "0640", "owner": "wizard-agent", "group": "wizard-agent"}},
+		{"action": "file", "name": "link config", "action_var": {"files": [{"src": "/opt/agent/conf/agent.conf", "dest": "/etc/agent.conf"}], "state": "link", "permission": "0640", "owner": "wizard-agent", "group": "wizard-agent"}}
+	]}, "priority": ["agent"]}`, src)
+
+	for _, changed := range []bool{true, false} {
+		task, err := New([]byte(config), embed.FS{}, TemplateOptions{TemplateConfig: struct{ Port int }{8080}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task.SetTargetRoot(root)
+		if _, err := task.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if r := task.Register("copy"); r.Changed != changed {
+			t.Fatalf("expected the copy to be changed %v, got %+v", changed, r)
+		}
+		if r := task.Register("template"); r.Changed != changed {
+			t.Fatalf("expected the template to be changed %v, got %+v", changed, r)
+		}
+	}
+	for _, name := range []string{"agent.conf", "agent.properties"} {
+		content, err := os.ReadFile(filepath.Join(root, "opt", "agent", "conf", name))
+		if err != nil || string(content) != "port=8080\n" {
+			t.Fatalf("expected %s under the root, got %q %v", name, content, err)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(root, "etc", "agent.conf")); err != nil || link != "/opt/agent/conf/agent.conf" {
+		t.Fatalf("expected the link under the root to the path in the root, got %q %v", link, err)
+	}
+	if _, err := os.Stat("/opt/agent/conf/agent.conf"); err == nil {
+		t.Fatal("expected nothing written outside the root")
+	}
+
+	// systemctl would manage the services of the host
+	task, err := New([]byte(`{"tasks": {"agent": [{"action": "systemd", "name": "start agent", "action_var": {"name": "agent", "state": "started"}}]},
+		"priority": ["agent"]}`), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.SetTargetRoot(root)
+	if _, err := task.Execute(); err == nil || !strings.Contains(err.Error(), "not supported under the target root") {
+		t.Fatalf("expected the systemd action to be rejected under the root, got %v", err)
+	}
+}
+
+func TestWizardFactsTarget(t *testing.T) {
+	server, err := sshtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	remote, err := transport.DialSSH(server.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	config := `{"tasks": {"a": [{"action": "cmd", "name": "os", "command": ["echo", "{{ (facts).OS.ID }}"]}]}, "priority": ["a"]}`
+	for name, setTarget := range map[string]func(*Task){
+		"remote":      func(task *Task) { task.SetTransport(remote) },
+		"target root": func(task *Task) { task.SetTargetRoot(t.TempDir()) },
+	} {
+		task, err := New([]byte(config), embed.FS{}, TemplateOptions{EnableWizardFacts: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		setTarget(task)
+		if _, err := task.Execute(); err == nil || !strings.Contains(err.Error(), "the wizard facts are of the local machine") {
+			t.Fatalf("%s: expected the wizard facts to be rejected, got %v", name, err)
+		}
+	}
+}
+
+// eventRecorder records the events as strings, and the number of logs
+type eventRecorder struct {
+	NopEventHandler
+	events []string
+	logs   int
+}
+
+func (r *eventRecorder) OnRunStart(RunEvent) { r.events = append(r.events, "run start") }
+func (r *eventRecorder) OnTaskStart(e TaskEvent) {
+	r.events = append(r.events, "task start "+e.Task)
+}
+
+func (r *eventRecorder) OnActionStart(e ActionEvent) {
+	r.events = append(r.events, "action start "+e.Name)
+}
+
+func (r *eventRecorder) OnActionEnd(e ActionEvent) {
+	r.events = append(r.events, fmt.Sprintf("action end %s %s changed=%v err=%v", e.Name, e.Status, e.Changed, e.Err != nil))
+}
+
+func (r *eventRecorder) OnTaskEnd(e TaskEvent) {
+	r.events = append(r.events, fmt.Sprintf("task end %s %s", e.Task, e.Status))
+}
+
+func (r *eventRecorder) OnRunEnd(e RunEvent) {
+	r.events = append(r.events, fmt.Sprintf("run end %s err=%v", e.Status, e.Err != nil))
+}
+
+func (r *eventRecorder) OnLog(wlog.Record) { r.logs++ }
+
+func TestEventHandler(t *testing.T) {
+	config := fmt.Sprintf(`{"tasks": {"a": [
+		{"action": "cmd", "name": "echo", "command": ["echo", "hello"]},
+		{"action": "file", "name": "touch", "action_var": {"files": [{"dest": "%s/touched"}], "state": "touch", "permission": "0640", "owner": "root", "group": "root"}},
+		{"action": "cmd", "name": "fail", "command": ["false"], "ignore_error": true}
+	]}, "priority": ["a"]}`, t.TempDir())
+	want := []string{
+		"run start",
+		"task start a",
+		"action start echo",
+		"action end echo ok changed=false err=false",
+		"action start touch",
+		"action end touch changed changed=true err=false",
+		"action start fail",
+		"action end fail ignored changed=false err=true",
+		"task end a changed",
+		"run end changed err=false",
+	}
+
+	task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := &eventRecorder{}
+	task.AddEventHandler(recorder)
+	if err := task.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recorder.events, want) {
+		t.Fatalf("unexpected events\n%s", strings.Join(recorder.events, "\n"))
+	}
+
+	// the channel of Perform is one more handler, it receives the same logs
+	recorder.events, recorder.logs = nil, 0
+	logCh := make(chan interface{})
+	go func() {
+		if err := task.Perform(logCh); err != nil {
+			t.Error(err)
+		}
+	}()
+	logs := 0
+	for range logCh {
+		logs++
+	}
+	if !reflect.DeepEqual(recorder.events, want) || logs == 0 || logs != recorder.logs {
+		t.Fatalf("unexpected events %v, %d logs on the channel, %d logs to the handler", recorder.events, logs, recorder.logs)
+	}
+}
+
+// stuckHandler blocks on its first log until released
+type stuckHandler struct {
+	NopEventHandler
+	release chan struct{}
+}
+
+func (h stuckHandler) OnLog(wlog.Record) { <-h.release }
+
+func TestStuckEventHandler(t *testing.T) {
+	config := `{"tasks": {"a": [
+		{"action": "cmd", "name": "echo", "command": ["echo", "hello"]},
+		{"action": "cmd", "name": "echo again", "command": ["echo", "hello"]}
+	]}, "priority": ["a"]}`
+	task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	defer close(release)
+	task.AddEventHandler(stuckHandler{release: release})
+	task.SetEventQueue(EventQueue{Size: 2, Drop: true, FlushTimeout: 50 * time.Millisecond})
+
+	done := make(chan struct{})
+	var logs []interface{}
+	go func() {
+		defer close(done)
+		logs, err = task.Execute()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the stuck handler not to stall Execute")
+	}
+	if err != nil || len(logs) == 0 {
+		t.Fatalf("expected the logs of Execute, got %d logs %v", len(logs), err)
+	}
+	if task.DroppedEvents() == 0 {
+		t.Fatal("expected the events of the stuck handler to be dropped")
+	}
+
+	// the log chan of Perform never drops a log, even read slowly
+	logCh := make(chan interface{})
+	go func() {
+		if err := task.Perform(logCh); err != nil {
+			t.Error(err)
+		}
+	}()
+	received := 0
+	for range logCh {
+		time.Sleep(time.Millisecond)
+		received++
+	}
+	if received != len(logs) {
+		t.Fatalf("expected the %d logs on the log chan, got %d", len(logs), received)
+	}
+}
+
+func TestLogRecords(t *testing.T) {
+	config := `{"tasks": {"a": [
+		{"action": "cmd", "name": "echo", "command": ["echo", "hello"]},
+		{"action": "cmd", "name": "fail", "command": ["false"], "ignore_error": true}
+	]}, "priority": ["a"]}`
+	task, err := New([]byte(config), embed.FS{}, TemplateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	task.AddEventHandler(NewSlogEventHandler(slog.NewJSONHandler(&buf, nil), wlog.LevelInfo))
+	if err := task.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// every log of the actions has the task and the action
+	names := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["task"] != "a" || record["action"] != "cmd" {
+			t.Fatalf("expected the task and the action in the record %s", line)
+		}
+		names[record["name"].(string)] = true
+	}
+	if !names["echo"] || !names["fail"] {
+		t.Fatalf("expected the logs of both actions, got %s", buf.String())
+	}
+
+	// the minimum level applies to the log chan too
+	task.SetLogLevel(wlog.LevelError)
+	logs, err := task.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, log := range logs {
+		if _, ok := log.(wlog.WLError); !ok {
+			t.Fatalf("expected only the error logs, got %#v", log)
+		}
+	}
+}
+
+func TestPerformFacts(t *testing.T) {
+	config := `{"tasks": {"a": [
+		{"action": "cmd", "name": "family", "register": "family", "command": ["echo", "-n", "{{ (facts).OS.Family }}"]},
+		{"action": "block", "name": "redhat only", "when": {"cmd": "test '{{ (facts).OS.Family }}' = redhat"}, "block": [
+			{"action": "cmd", "name": "redhat", "register": "redhat", "command": ["echo", "-n", "redhat"]}
+		]}
+	]}, "priority": ["a"]}`
+	want, err := facts.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := New([]byte(config), embed.FS{}, TemplateOptions{EnableWizardFacts: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if r := task.Register("family"); r.StdOut != want.OS.Family {
+		t.Fatalf("expected the os family %q, got %+v", want.OS.Family, r)
+	}
+	if r := task.Register("redhat"); (r != nil) != (want.OS.Family == "redhat") {
+		t.Fatalf("expected the when condition on the os family, got %+v", r)
+	}
+}
+
+func TestPerformCustomFacts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "node.json"), []byte(`{"role": "kafka-broker"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "rack"), []byte("#!/bin/sh\necho '\"r12\"'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"tasks": {"a": [
+		{"action": "cmd", "name": "custom", "register": "custom", "command": ["echo", "-n", "{{ (facts).Custom.node.role }} {{ (facts).Custom.rack }} {{ (facts).Custom.cluster }}"]}
+	]}, "priority": ["a"]}`
+	provider := facts.ProviderFunc(func(context.Context) (map[string]interface{}, error) {
+		return map[string]interface{}{"cluster": "prod"}, nil
+	})
+	task, err := New([]byte(config), embed.FS{}, TemplateOptions{EnableWizardFacts: true, FactsDir: dir, FactProviders: []facts.Provider{provider}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if r := task.Register("custom"); r.StdOut != "kafka-broker r12 prod" {
+		t.Fatalf("unexpected custom facts %+v", r)
+	}
+
+	// a failing provider only misses its facts, its error is in CustomErrors
+	failing := facts.ProviderFunc(func(context.Context) (map[string]interface{}, error) {
+		return nil, errors.New("cluster manager unreachable")
+	})
+	config = `{"tasks": {"a": [
+		{"action": "cmd", "name": "custom", "register": "custom", "command": ["echo", "-n", "{{ (facts).Custom.rack }} {{ (facts).Architecture }} {{ (facts).CustomErrors }}"]}
+	]}, "priority": ["a"]}`
+	task, err = New([]byte(config), embed.FS{}, TemplateOptions{EnableWizardFacts: true, FactsDir: dir, FactProviders: []facts.Provider{failing}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if r := task.Register("custom"); !strings.HasPrefix(r.StdOut, "r12 ") || strings.HasPrefix(r.StdOut, "r12  ") ||
+		!strings.HasSuffix(r.StdOut, " [Custom: cluster manager unreachable]") {
+		t.Fatalf("expected the facts with the error of the provider, got %+v", r)
+	}
+}